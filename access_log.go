@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/labstack/echo/v4"
+	"github.com/xompass/vsaas-rest/http_errors"
+)
+
+// endpointContextKey stores the EndpointContext of a request in its echo.Context
+const endpointContextKey = "_rest.endpointContext"
+
+// AccessLogConfig configures the access log, one record per request logged
+// through the application logger
+type AccessLogConfig struct {
+	Enabled bool
+
+	// SampleRate is the fraction of the successful requests logged, from 0 to 1.
+	// Requests answered with a status >= 400 are always logged. Defaults to 1.
+	SampleRate float64
+	// SampleRates overrides SampleRate for the endpoints with the given names,
+	// e.g. to log 1% of a high-volume endpoint
+	SampleRates map[string]float64
+
+	ExcludePaths     []string // Route templates or request paths never logged, e.g. "/healthz"
+	ExcludeEndpoints []string // Names of the endpoints never logged
+}
+
+// sampleRate returns the rate of the endpoint named endpoint
+func (config *AccessLogConfig) sampleRate(endpoint string) float64 {
+	if rate, ok := config.SampleRates[endpoint]; ok {
+		return rate
+	}
+	if config.SampleRate == 0 {
+		return 1
+	}
+	return config.SampleRate
+}
+
+// accessLogMiddleware logs every request once it is answered
+func (receiver *RestApp) accessLogMiddleware(config AccessLogConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if slices.Contains(config.ExcludePaths, c.Path()) || slices.Contains(config.ExcludePaths, c.Request().URL.Path) {
+				return next(c)
+			}
+
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// Send the error response now, so the record has its status
+				c.Error(err)
+			}
+
+			var endpoint string
+			eCtx, _ := c.Get(endpointContextKey).(*EndpointContext)
+			if eCtx != nil {
+				endpoint = eCtx.Endpoint.Name
+			}
+
+			if slices.Contains(config.ExcludeEndpoints, endpoint) {
+				return err
+			}
+
+			status := c.Response().Status
+			if status < http.StatusBadRequest {
+				if rate := config.sampleRate(endpoint); rate < 1 && rand.Float64() >= rate {
+					return err
+				}
+			}
+
+			receiver.logAccess(c, eCtx, status, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+func (receiver *RestApp) logAccess(c echo.Context, eCtx *EndpointContext, status int, latency time.Duration, err error) {
+	req := c.Request()
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("route", c.Path()),
+		slog.String("path", req.URL.Path),
+		slog.Int("status", status),
+		slog.Int64("bytes", c.Response().Size),
+		slog.Float64("latencyMs", float64(latency.Microseconds())/1000),
+		slog.String("ip", c.RealIP()),
+		slog.String("userAgent", req.UserAgent()),
+	}
+
+	if eCtx != nil {
+		attrs = append(attrs, slog.String("endpoint", eCtx.Endpoint.Name))
+		if eCtx.Principal != nil {
+			attrs = append(attrs, slog.String("principalId", eCtx.Principal.GetPrincipalID()))
+		}
+	}
+
+	var errResponse http_errors.ErrorResponse
+	if errors.As(err, &errResponse) {
+		attrs = append(attrs, slog.String("errorCode", errResponse.ErrorCode))
+	}
+
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	} else if status >= http.StatusBadRequest {
+		level = slog.LevelWarn
+	}
+
+	receiver.logger.LogAttrs(req.Context(), level, "request", attrs...)
+}
@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	app := NewRestApp(RestAppOptions{
+		LogFormat: LogFormatJSON,
+		LogOutput: &buf,
+		AccessLog: &AccessLogConfig{
+			Enabled:          true,
+			SampleRates:      map[string]float64{"ListDevices": 0},
+			ExcludePaths:     []string{"/healthz"},
+			ExcludeEndpoints: []string{"Internal"},
+		},
+	})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1", role: "admin"}, testToken{valid: true})
+
+	api := app.Group("/api")
+	app.RegisterEndpoint(&Endpoint{Name: "GetDevice", Method: MethodGET, Path: "/devices/:id", Handler: func(c *EndpointContext) error {
+		if c.EchoCtx.Param("id") == "missing" {
+			return http_errors.NotFoundErrorWithCode("DEVICE_NOT_FOUND", "Device not found")
+		}
+		return c.JSON(map[string]string{"id": c.EchoCtx.Param("id")})
+	}}, api)
+	app.RegisterEndpoint(&Endpoint{Name: "ListDevices", Method: MethodGET, Path: "/devices", Handler: func(c *EndpointContext) error {
+		if c.EchoCtx.QueryParam("fail") != "" {
+			return http_errors.InternalServerError("Failed")
+		}
+		return c.NoContent()
+	}}, api)
+	app.RegisterEndpoint(&Endpoint{Name: "Internal", Method: MethodGET, Path: "/internal", Handler: func(c *EndpointContext) error {
+		return c.NoContent()
+	}}, api)
+	app.EchoApp.GET("/healthz", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	for _, path := range []string{"/api/devices/d1", "/api/devices/missing", "/api/devices", "/api/devices?fail=1", "/api/internal", "/healthz", "/unknown"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("User-Agent", "test-agent")
+		_, err := app.Test(req)
+		require.NoError(t, err)
+	}
+
+	var records []map[string]any
+	for _, record := range logRecords(t, &buf) {
+		if record["msg"] == "request" {
+			records = append(records, record)
+		}
+	}
+	require.Len(t, records, 4, "excluded and sampled out requests are not logged")
+
+	ok := records[0]
+	assert.Equal(t, "INFO", ok["level"])
+	assert.Equal(t, http.MethodGet, ok["method"])
+	assert.Equal(t, "/api/devices/:id", ok["route"])
+	assert.Equal(t, "/api/devices/d1", ok["path"])
+	assert.Equal(t, float64(http.StatusOK), ok["status"])
+	assert.Greater(t, ok["bytes"], float64(0))
+	assert.Contains(t, ok, "latencyMs")
+	assert.Equal(t, "GetDevice", ok["endpoint"])
+	assert.Equal(t, "u1", ok["principalId"])
+	assert.Equal(t, "test-agent", ok["userAgent"])
+	assert.NotEmpty(t, ok["ip"])
+	assert.NotEmpty(t, ok["requestId"])
+	assert.NotContains(t, ok, "errorCode")
+
+	assert.Equal(t, "WARN", records[1]["level"])
+	assert.Equal(t, float64(http.StatusNotFound), records[1]["status"])
+	assert.Equal(t, "DEVICE_NOT_FOUND", records[1]["errorCode"])
+
+	assert.Equal(t, "ERROR", records[2]["level"], "errors are logged even when sampled out")
+	assert.Equal(t, "ListDevices", records[2]["endpoint"])
+
+	assert.Equal(t, float64(http.StatusNotFound), records[3]["status"], "unmatched routes are logged")
+	assert.NotContains(t, records[3], "endpoint")
+}
@@ -3,13 +3,18 @@ package rest
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-errors/errors"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
@@ -18,31 +23,80 @@ import (
 
 type AuditLogConfig struct {
 	Enabled bool
-	Handler func(ctx *EndpointContext, response any, affectedModelId any) error
+	Handler func(ctx *EndpointContext, response any, affectedModelId any) error // Called synchronously by RespondAndLog, before the response is sent
+
+	// Asynchronous pipeline. Events are queued and written to Sinks in batches
+	// by a background goroutine, and the queue is flushed by Destroy.
+	Sinks         []AuditSink
+	QueueSize     int                 // Events waiting to be written. Defaults to 1024
+	BatchSize     int                 // Events written at once. Defaults to 100
+	FlushInterval time.Duration       // Max time an event waits for its batch to fill. Defaults to 1s
+	Overflow      AuditOverflowPolicy // What happens when the queue is full. Defaults to AuditOverflowBlock
+	MaxRetries    int                 // Retries of a failed batch before its events are dropped. Defaults to 3, negative retries until Destroy
+	RetryBackoff  time.Duration       // Wait before the first retry, doubled on each retry. Defaults to 100ms
+	FlushTimeout  time.Duration       // Max time Destroy waits for the queue to be written. Defaults to 10s
+
+	// DisableChanges stops recording the documents changed by the repositories
+	// in AuditEvent.Changes, which costs extra reads per update and delete.
+	// UpdateMany and DeleteMany read every matching document; inserted
+	// documents, including the ones inserted by Upsert, are not recorded.
+	DisableChanges bool
+
+	// ResponseBodyLimit is the number of bytes of JSON, XML and text responses
+	// kept in AuditEvent.ResponseBody. Zero keeps no body. Response bodies are
+	// not redacted, so enable it only when the responses carry no secrets.
+	ResponseBodyLimit int
 }
 
 type RestAppOptions struct {
-	Name              string
-	Port              uint16
-	Datasource        *database.Datasource
-	LogLevel          LogLevel
-	EnableRateLimiter bool
-	Authorizer        Authorizer
-	AuditLogConfig    *AuditLogConfig
-	CORS              *CORSConfig     // Configuración de CORS
-	Security          *SecurityConfig // Configuración de Security middleware
+	Name               string
+	Port               uint16
+	Datasource         *database.Datasource
+	LogLevel           LogLevel
+	LogFormat          LogFormat    // Format of the application logs, LogFormatText (default) or LogFormatJSON
+	LogOutput          io.Writer    // Destination of the application logs. Defaults to os.Stdout
+	LogHandler         slog.Handler // Handler of the application logs, takes precedence over LogFormat and LogOutput
+	EnableRateLimiter  bool
+	RateLimitStore     RateLimitStore        // Optional store for rate limit counters. Defaults to Redis when EnableRateLimiter is set
+	DefaultRateLimits  []RateLimit           // Limits of the endpoints without RateLimiter or RateLimits. NewRestApp panics when one is invalid
+	Redis              *RedisConfig          // Redis of the rate limiter. Defaults to the REDIS_* environment variables
+	RedisClient        redis.UniversalClient // Redis client of the rate limiter, takes precedence over Redis. Destroy does not close it
+	RateLimitKeyPrefix string                // Prepended to every rate limit key, e.g. to share a Redis between applications
+	RateLimitFailOpen  bool                  // If true, requests are allowed when the rate limit store fails. Otherwise they get a 503
+	Authorizer         Authorizer
+	RoleHierarchy      RoleHierarchy // Optional role hierarchy used when matching Endpoint.Roles
+	AuditLogConfig     *AuditLogConfig
+	AccessLog          *AccessLogConfig // Logs every request through the application logger when enabled
+	Metrics            *MetricsConfig   // Serves Prometheus metrics when enabled
+	Tracing            *TracingConfig   // Records OpenTelemetry spans of the requests and repository operations when enabled
+	ShutdownTimeout    time.Duration    // Max time Shutdown waits for the in-flight requests and the OnShutdown hooks. Defaults to 30s
+	Health             *HealthConfig    // Serves the liveness and readiness endpoints when enabled
+	CORS               *CORSConfig      // Configuración de CORS
+	Security           *SecurityConfig  // Configuración de Security middleware
 }
 
 type RestApp struct {
 	EchoApp           *echo.Echo
 	Datasource        *database.Datasource
-	redisClient       *redis.Client
+	redisClient       redis.UniversalClient // Client created by the application, closed by Destroy
+	rateLimitStore    RateLimitStore
 	options           RestAppOptions
 	ValidatorInstance *validator.Validate
 	environment       string
 	authorizer        Authorizer
+	roleHierarchy     RoleHierarchy
 	auditLogConfig    AuditLogConfig
+	auditPipeline     *auditPipeline
+	metrics           *appMetrics // Set when RestAppOptions.Metrics is enabled
+	tracing           *appTracing // Set when RestAppOptions.Tracing is enabled
 	logger            *slog.Logger
+	registry          endpointRegistry
+	startHooks        []LifecycleHook // See OnStart
+	shutdownHooks     []LifecycleHook // See OnShutdown
+	livenessChecks    []namedHealthCheck
+	readinessChecks   []namedHealthCheck
+	shuttingDown      atomic.Bool // Set by Shutdown, fails the readiness endpoint
+	destroyOnce       sync.Once
 }
 
 func (receiver *RestApp) GetEnvironment() string {
@@ -58,22 +112,24 @@ func (receiver *RestApp) GetEnvironment() string {
 }
 
 func (receiver *RestApp) Debugf(format string, args ...any) {
-	receiver.log(LogLevelDebug, format, args...)
+	receiver.log(context.Background(), LogLevelDebug, format, args...)
 }
 
 func (receiver *RestApp) Infof(format string, args ...any) {
-	receiver.log(LogLevelInfo, format, args...)
+	receiver.log(context.Background(), LogLevelInfo, format, args...)
 }
 
 func (receiver *RestApp) Warnf(format string, args ...any) {
-	receiver.log(LogLevelWarn, format, args...)
+	receiver.log(context.Background(), LogLevelWarn, format, args...)
 }
 
 func (receiver *RestApp) Errorf(format string, args ...any) {
-	receiver.log(LogLevelError, format, args...)
+	receiver.log(context.Background(), LogLevelError, format, args...)
 }
 
-func (receiver *RestApp) log(level LogLevel, format string, args ...any) {
+// log formats and logs a message. Messages logged with the context of a
+// request include its ID.
+func (receiver *RestApp) log(ctx context.Context, level LogLevel, format string, args ...any) {
 	if receiver == nil || receiver.logger == nil || receiver.options.LogLevel > level {
 		return
 	}
@@ -93,7 +149,7 @@ func (receiver *RestApp) log(level LogLevel, format string, args ...any) {
 	}
 
 	message := fmt.Sprintf(format, args...)
-	receiver.logger.Log(context.Background(), slogLevel, message)
+	receiver.logger.Log(ctx, slogLevel, message)
 }
 
 func (receiver *RestApp) Authorize(ctx *EndpointContext) error {
@@ -103,7 +159,7 @@ func (receiver *RestApp) Authorize(ctx *EndpointContext) error {
 	}
 	principal, token, err := receiver.authorizer(ctx)
 	if err != nil {
-		receiver.Errorf("Authorization error: %v", err)
+		ctx.Logger().Error("Authorization error", "error", err)
 		return err
 	}
 	if principal == nil {
@@ -115,7 +171,15 @@ func (receiver *RestApp) Authorize(ctx *EndpointContext) error {
 	return nil
 }
 
+// NewRestApp creates the application. It panics when a limit of
+// DefaultRateLimits is invalid.
 func NewRestApp(appOptions RestAppOptions) *RestApp {
+	for _, limit := range appOptions.DefaultRateLimits {
+		if err := limit.validate(); err != nil {
+			panic(errors.Errorf("DefaultRateLimits: %v", err))
+		}
+	}
+
 	// Construir configuración de Echo a partir de RestAppOptions
 	echoConfig := EchoAppConfig{
 		CORS:     appOptions.CORS,
@@ -133,7 +197,11 @@ func NewRestApp(appOptions RestAppOptions) *RestApp {
 		echoConfig.Security = defaultConfig.Security
 	}
 
+	logger := newLogger(appOptions)
+	echoConfig.Logger = logger
+
 	e := NewEchoApp(echoConfig)
+	e.Pre(requestIDMiddleware())
 
 	validate := validator.New()
 	registerTagNameFunc(validate)
@@ -143,30 +211,90 @@ func NewRestApp(appOptions RestAppOptions) *RestApp {
 		Datasource:        appOptions.Datasource,
 		options:           appOptions,
 		ValidatorInstance: validate,
-		logger: slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slog.Level(appOptions.LogLevel),
-		})),
+		logger:            logger,
+	}
+
+	if appOptions.Datasource != nil {
+		appOptions.Datasource.SetLogger(logger)
+	}
+
+	if appOptions.AccessLog != nil && appOptions.AccessLog.Enabled {
+		e.Use(app.accessLogMiddleware(*appOptions.AccessLog))
+	}
+
+	if appOptions.Metrics != nil && appOptions.Metrics.Enabled {
+		app.metrics = newAppMetrics(*appOptions.Metrics)
+		path := appOptions.Metrics.Path
+		if path == "" {
+			path = defaultMetricsPath
+		}
+		e.GET(path, app.metrics.handler())
+
+		if appOptions.Datasource != nil {
+			appOptions.Datasource.SetOperationObserver(app.metrics.observeOperation)
+		}
+	}
+
+	if appOptions.Health != nil && appOptions.Health.Enabled {
+		app.registerHealthEndpoints(*appOptions.Health)
+	}
+
+	if appOptions.Tracing != nil && appOptions.Tracing.Enabled {
+		app.tracing = newAppTracing(*appOptions.Tracing, appOptions.Name)
+		if appOptions.Datasource != nil {
+			appOptions.Datasource.SetTracerProvider(app.tracing.provider)
+		}
 	}
 
 	if appOptions.Authorizer != nil {
 		app.authorizer = appOptions.Authorizer
 	}
 
-	if appOptions.EnableRateLimiter {
-		app.redisClient = newRedisClient()
+	if appOptions.RoleHierarchy != nil {
+		app.roleHierarchy = appOptions.RoleHierarchy
+	}
+
+	if appOptions.RateLimitStore != nil {
+		app.rateLimitStore = appOptions.RateLimitStore
+	} else if appOptions.RedisClient != nil {
+		app.rateLimitStore = NewRedisRateLimitStore(appOptions.RedisClient)
+	} else if appOptions.EnableRateLimiter {
+		app.redisClient = newRedisClient(appOptions.Redis, app.logger)
+		app.rateLimitStore = NewRedisRateLimitStore(app.redisClient)
 	}
 
 	if appOptions.AuditLogConfig != nil {
 		app.auditLogConfig = *appOptions.AuditLogConfig
+		if app.auditLogConfig.Enabled && len(app.auditLogConfig.Sinks) > 0 {
+			app.auditPipeline = newAuditPipeline(app, app.auditLogConfig)
+		}
 	}
 
 	return app
 }
 
+// Destroy flushes the audit log and the spans and closes the datasource
+// connectors and the Redis client created by the application. Calling it
+// again does nothing. Run calls it on shutdown.
 func (receiver *RestApp) Destroy() error {
 	if receiver == nil {
 		return nil
 	}
+	receiver.destroyOnce.Do(receiver.destroy)
+	return nil
+}
+
+func (receiver *RestApp) destroy() {
+	// Audit sinks may write to the datasource, so the queue is flushed first
+	if receiver.auditPipeline != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), receiver.auditPipeline.config.FlushTimeout)
+		err := receiver.auditPipeline.close(ctx)
+		cancel()
+		if err != nil {
+			receiver.Errorf("Failed to flush the audit log: %v", err)
+		}
+	}
+
 	if receiver.Datasource != nil {
 		receiver.Datasource.Destroy()
 	}
@@ -175,11 +303,49 @@ func (receiver *RestApp) Destroy() error {
 		receiver.redisClient.Close()
 	}
 
-	return nil
+	// Last, so the spans of the work above are exported
+	if receiver.tracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		err := receiver.tracing.shutdown(ctx)
+		cancel()
+		if err != nil {
+			receiver.Errorf("Failed to flush the spans: %v", err)
+		}
+	}
 }
 
+// Test runs req through the full Echo stack (middleware, endpoint pipeline and
+// error handler) without opening a network listener, and returns the recorded
+// response. The optional timeout is in milliseconds, defaults to 1000 and can
+// be disabled with -1.
 func (receiver *RestApp) Test(req *http.Request, timeout ...int) (*http.Response, error) {
-	return nil, nil
+	timeoutMs := 1000
+	if len(timeout) > 0 {
+		timeoutMs = timeout[0]
+	}
+
+	recorder := httptest.NewRecorder()
+	if timeoutMs < 0 {
+		receiver.EchoApp.ServeHTTP(recorder, req)
+		return recorder.Result(), nil
+	}
+
+	reqCtx, cancel := context.WithTimeout(req.Context(), time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+	req = req.WithContext(reqCtx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		receiver.EchoApp.ServeHTTP(recorder, req)
+	}()
+
+	select {
+	case <-done:
+		return recorder.Result(), nil
+	case <-reqCtx.Done():
+		return nil, fmt.Errorf("test: request %s %s timed out after %dms", req.Method, req.URL.Path, timeoutMs)
+	}
 }
 
 func (receiver *RestApp) Start() error {
@@ -191,20 +357,31 @@ func (receiver *RestApp) Group(path string, m ...MiddlewareFunc) *RouterGroup {
 	for _, handler := range m {
 		g.Use(convertMiddleware(handler))
 	}
-	return &RouterGroup{echoGroup: g}
+	return &RouterGroup{echoGroup: g, prefix: path}
 }
 
-func (receiver *RestApp) RegisterEndpoint(ep *Endpoint, r *RouterGroup) {
+// RegisterEndpoint registers ep under the router group r. It fails when the
+// method of ep is not supported, when another endpoint has its name or when
+// its method and path are already registered.
+func (receiver *RestApp) RegisterEndpoint(ep *Endpoint, r *RouterGroup) error {
 	if ep == nil {
-		return
+		return nil
 	}
 
-	var router *echo.Group = r.echoGroup
+	if ep.typedErr != nil {
+		return ep.typedErr
+	}
 
-	if ep.FileUploadConfig != nil {
-		ep.echoFileUploadHandler = NewEchoFileUploadHandler(ep.FileUploadConfig)
+	if err := ep.validateProduces(); err != nil {
+		return err
 	}
 
+	if err := ep.validateRateLimits(); err != nil {
+		return err
+	}
+
+	var router *echo.Group = r.echoGroup
+
 	var executor func(path string, handler echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
 	switch ep.Method {
 	case MethodGET:
@@ -219,31 +396,52 @@ func (receiver *RestApp) RegisterEndpoint(ep *Endpoint, r *RouterGroup) {
 		executor = router.PATCH
 	case MethodDELETE:
 		executor = router.DELETE
+	case MethodOPTIONS:
+		executor = router.OPTIONS
+	default:
+		return errors.Errorf("unsupported HTTP method %s for endpoint %s", ep.Method, ep.Name)
+	}
+
+	if err := receiver.registry.add(ep, r.prefix+ep.Path); err != nil {
+		return err
 	}
 
-	if executor != nil {
-		ep.app = receiver
+	ep.app = receiver
 
-		if ep.Method == MethodPOST || ep.Method == MethodPUT || ep.Method == MethodPATCH {
-			if ep.BodyParams != nil {
-				registerStruct(ep.BodyParams())
-			}
+	if ep.FileUploadConfig != nil {
+		ep.echoFileUploadHandler = NewEchoFileUploadHandler(ep.FileUploadConfig)
+		ep.echoFileUploadHandler.logger = receiver.logger
+		ep.echoFileUploadHandler.metrics = receiver.metrics
+		ep.echoFileUploadHandler.endpoint = ep.Name
+	}
+
+	if ep.Method == MethodPOST || ep.Method == MethodPUT || ep.Method == MethodPATCH {
+		if ep.BodyParams != nil {
+			registerStruct(ep.BodyParams())
 		}
+	}
 
-		executor(ep.Path, ep.run)
-	} else {
-		log.Fatalf("Unsupported HTTP method %s for endpoint %s", ep.Method, ep.Name)
-		return
+	middlewares := make([]echo.MiddlewareFunc, len(ep.Middlewares))
+	for i, middleware := range ep.Middlewares {
+		middlewares[i] = convertMiddleware(middleware)
 	}
+
+	executor(ep.Path, ep.run, middlewares...).Name = ep.Name
+	return nil
 }
 
-func (receiver *RestApp) RegisterEndpoints(endpoints []*Endpoint, r *RouterGroup) {
+// RegisterEndpoints registers endpoints under the router group r, stopping at
+// the first one that fails
+func (receiver *RestApp) RegisterEndpoints(endpoints []*Endpoint, r *RouterGroup) error {
 	for _, ep := range endpoints {
 		if ep == nil {
 			continue
 		}
-		receiver.RegisterEndpoint(ep, r)
+		if err := receiver.RegisterEndpoint(ep, r); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // Group creates a subgroup with the specified path and middleware
@@ -252,7 +450,7 @@ func (rg *RouterGroup) Group(path string, m ...MiddlewareFunc) *RouterGroup {
 	for _, handler := range m {
 		g.Use(convertMiddleware(handler))
 	}
-	return &RouterGroup{echoGroup: g}
+	return &RouterGroup{echoGroup: g, prefix: rg.prefix + path}
 }
 
 // Use adds middleware to the router group
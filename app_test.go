@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestApp_Test(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	api := app.Group("/api")
+
+	app.RegisterEndpoints([]*Endpoint{
+		{
+			Name:    "Ping",
+			Method:  MethodGET,
+			Path:    "/ping",
+			Public:  true,
+			Handler: func(c *EndpointContext) error { return c.JSON(map[string]string{"pong": "ok"}) },
+		},
+		{
+			Name:   "Slow",
+			Method: MethodGET,
+			Path:   "/slow",
+			Public: true,
+			Handler: func(c *EndpointContext) error {
+				time.Sleep(200 * time.Millisecond)
+				return c.NoContent()
+			},
+		},
+	}, api)
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/ping", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.JSONEq(t, `{"pong":"ok"}`, string(body))
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/missing", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode, "errors go through the error handler")
+
+	_, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/slow", nil), 20)
+	assert.Error(t, err)
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/slow", nil), -1)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+}
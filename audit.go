@@ -0,0 +1,318 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Defaults of the audit pipeline
+const (
+	defaultAuditQueueSize     = 1024
+	defaultAuditBatchSize     = 100
+	defaultAuditFlushInterval = time.Second
+	defaultAuditMaxRetries    = 3
+	defaultAuditRetryBackoff  = 100 * time.Millisecond
+	defaultAuditFlushTimeout  = 10 * time.Second
+	maxAuditRetryBackoff      = 30 * time.Second
+)
+
+// AuditEvent is the record of an audited request, sent to the audit sinks
+type AuditEvent struct {
+	ID            string        `json:"id" bson:"_id"` // Unique, so sinks can discard events written twice by a retry
+	Time          time.Time     `json:"time" bson:"time"`
+	Endpoint      string        `json:"endpoint" bson:"endpoint"`
+	Method        string        `json:"method" bson:"method"`
+	Path          string        `json:"path" bson:"path"`
+	ActionType    string        `json:"actionType,omitempty" bson:"actionType,omitempty"`
+	Model         string        `json:"model,omitempty" bson:"model,omitempty"`
+	ModelID       any           `json:"modelId,omitempty" bson:"modelId,omitempty"`
+	PrincipalID   string        `json:"principalId,omitempty" bson:"principalId,omitempty"`
+	PrincipalRole string        `json:"principalRole,omitempty" bson:"principalRole,omitempty"`
+	IPAddress     string        `json:"ipAddress" bson:"ipAddress"`
+	RequestID     string        `json:"requestId,omitempty" bson:"requestId,omitempty"`
+	StatusCode    int           `json:"statusCode" bson:"statusCode"`
+	DurationMs    int64         `json:"durationMs" bson:"durationMs"`                         // Time from the start of the request until the response
+	Changes       []AuditChange `json:"changes,omitempty" bson:"changes,omitempty"`           // Documents changed by the request, see AuditChange
+	ResponseBody  string        `json:"responseBody,omitempty" bson:"responseBody,omitempty"` // Start of the JSON, XML or text response, see AuditLogConfig.ResponseBodyLimit
+}
+
+// AuditSink stores audit events. Sinks receive the events in batches from a
+// single goroutine; a failed batch is retried with the same events.
+type AuditSink interface {
+	WriteEvents(ctx context.Context, events []AuditEvent) error
+}
+
+// AuditOverflowPolicy decides what happens to an event when the audit queue is full
+type AuditOverflowPolicy string
+
+const (
+	// AuditOverflowBlock makes the request wait until the queue has room. No
+	// event is lost, but a slow sink adds latency once the queue is full.
+	AuditOverflowBlock AuditOverflowPolicy = "block"
+	// AuditOverflowDrop discards the event and logs it, so requests never wait
+	AuditOverflowDrop AuditOverflowPolicy = "drop"
+)
+
+// newAuditEvent builds the event of the request handled by ctx, answered with
+// statusCode and body
+func newAuditEvent(ctx *EndpointContext, statusCode int, body []byte) AuditEvent {
+	event := AuditEvent{
+		ID:           bson.NewObjectID().Hex(),
+		Time:         time.Now(),
+		Endpoint:     ctx.Endpoint.Name,
+		Method:       ctx.EchoCtx.Request().Method,
+		Path:         ctx.EchoCtx.Request().URL.Path,
+		ActionType:   ctx.Endpoint.ActionType,
+		Model:        ctx.Endpoint.Model,
+		ModelID:      ctx.auditModelID,
+		IPAddress:    ctx.IpAddress,
+		RequestID:    ctx.RequestID,
+		StatusCode:   statusCode,
+		Changes:      ctx.auditChanges.auditChanges(),
+		ResponseBody: string(body),
+	}
+
+	if !ctx.startTime.IsZero() {
+		event.DurationMs = time.Since(ctx.startTime).Milliseconds()
+	}
+
+	if ctx.Principal != nil {
+		event.PrincipalID = ctx.Principal.GetPrincipalID()
+		event.PrincipalRole = ctx.Principal.GetPrincipalRole()
+	}
+
+	return event
+}
+
+// auditResponseWriter keeps the first bytes of the JSON, XML and text
+// responses written through it. Other content, like files, is not kept.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	response *echo.Response
+	limit    int
+	body     []byte
+	checked  bool // Whether the Content-Type was checked, on the first write
+	capture  bool
+}
+
+// newAuditResponseWriter wraps the writer of response. A zero or negative
+// limit keeps no body.
+func newAuditResponseWriter(response *echo.Response, limit int) *auditResponseWriter {
+	return &auditResponseWriter{ResponseWriter: response.Writer, response: response, limit: limit}
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if !w.checked {
+		w.checked = true
+		w.capture = w.limit > 0 && isAuditedContentType(w.response.Header().Get(echo.HeaderContentType))
+	}
+
+	if w.capture {
+		if room := w.limit - len(w.body); room > 0 {
+			w.body = append(w.body, b[:min(room, len(b))]...)
+		}
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the Flusher and Hijacker of the writer
+func (w *auditResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func isAuditedContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml")
+}
+
+// auditPipeline queues audit events and writes them to the sinks in batches
+// from a background goroutine, so sinks never delay responses
+type auditPipeline struct {
+	app     *RestApp
+	config  AuditLogConfig
+	queue   chan AuditEvent
+	mu      sync.RWMutex // Guards closed. Held for reading while sending to queue
+	closed  bool
+	done    chan struct{}
+	ctx     context.Context // Canceled when a flush times out, to abort writes and retries
+	cancel  context.CancelFunc
+	dropped atomic.Int64
+}
+
+func newAuditPipeline(app *RestApp, config AuditLogConfig) *auditPipeline {
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultAuditQueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultAuditBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultAuditFlushInterval
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = defaultAuditMaxRetries
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultAuditRetryBackoff
+	}
+	if config.FlushTimeout <= 0 {
+		config.FlushTimeout = defaultAuditFlushTimeout
+	}
+	if config.Overflow == "" {
+		config.Overflow = AuditOverflowBlock
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pipeline := &auditPipeline{
+		app:    app,
+		config: config,
+		queue:  make(chan AuditEvent, config.QueueSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	go pipeline.run()
+	return pipeline
+}
+
+// enqueue adds event to the queue, applying the overflow policy when it is
+// full. It reports whether the event was queued.
+func (p *auditPipeline) enqueue(ctx context.Context, event AuditEvent) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.drop(ctx, 1, "the audit pipeline is closed")
+		return false
+	}
+
+	select {
+	case p.queue <- event:
+		return true
+	default:
+	}
+
+	if p.config.Overflow == AuditOverflowDrop {
+		p.drop(ctx, 1, "the audit queue is full")
+		return false
+	}
+
+	select {
+	case p.queue <- event:
+		return true
+	case <-ctx.Done():
+		p.drop(ctx, 1, "the request ended while waiting for the audit queue")
+		return false
+	}
+}
+
+// run batches the queued events until the queue is closed
+func (p *auditPipeline) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]AuditEvent, 0, p.config.BatchSize)
+	for {
+		select {
+		case event, ok := <-p.queue:
+			if !ok {
+				p.write(batch)
+				return
+			}
+
+			batch = append(batch, event)
+			if len(batch) >= p.config.BatchSize {
+				p.write(batch)
+				batch = make([]AuditEvent, 0, p.config.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.write(batch)
+				batch = make([]AuditEvent, 0, p.config.BatchSize)
+			}
+		}
+	}
+}
+
+// write sends batch to every sink, retrying failures with exponential backoff
+func (p *auditPipeline) write(batch []AuditEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	for _, sink := range p.config.Sinks {
+		backoff := p.config.RetryBackoff
+		for attempt := 0; ; attempt++ {
+			err := sink.WriteEvents(p.ctx, batch)
+			if err == nil {
+				break
+			}
+
+			if (p.config.MaxRetries > 0 && attempt >= p.config.MaxRetries) || p.ctx.Err() != nil {
+				p.drop(p.ctx, len(batch), "the audit sink failed: "+err.Error())
+				break
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-p.ctx.Done():
+			}
+			backoff = min(backoff*2, maxAuditRetryBackoff)
+		}
+	}
+}
+
+// drop counts and logs discarded events. ctx is the request of the event, if any.
+func (p *auditPipeline) drop(ctx context.Context, count int, reason string) {
+	p.dropped.Add(int64(count))
+	p.app.log(ctx, LogLevelError, "Dropped %d audit events: %s", count, reason)
+}
+
+// close stops accepting events and waits until the queued ones are written.
+// When ctx ends first, pending writes are aborted and their events dropped.
+// Sinks implementing io.Closer are closed afterwards.
+func (p *auditPipeline) close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+
+	var err error
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		p.cancel()
+		<-p.done
+	}
+	p.cancel()
+
+	for _, sink := range p.config.Sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,234 @@
+package rest
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xompass/vsaas-rest/database"
+)
+
+// AuditRedacted replaces the value of the fields tagged `audit:"redact"`
+const AuditRedacted = "[REDACTED]"
+
+// AuditChange is a document modified through a Repository during an audited
+// request. Documents use the JSON field names of the model. Fields tagged
+// `audit:"redact"` are replaced by AuditRedacted and fields tagged
+// `audit:"-"` are left out.
+type AuditChange struct {
+	Model     string             `json:"model" bson:"model"`
+	ID        any                `json:"id" bson:"id"`
+	Operation string             `json:"operation" bson:"operation"` // database.ChangeUpdate or database.ChangeDelete
+	Before    map[string]any     `json:"before,omitempty" bson:"before,omitempty"`
+	After     map[string]any     `json:"after,omitempty" bson:"after,omitempty"`
+	Diff      []AuditFieldChange `json:"diff,omitempty" bson:"diff,omitempty"` // Fields changed by an update
+}
+
+// AuditFieldChange is a field changed by an update. Nested fields use dotted
+// paths, e.g. "address.city".
+type AuditFieldChange struct {
+	Field  string `json:"field" bson:"field"`
+	Before any    `json:"before" bson:"before"`
+	After  any    `json:"after" bson:"after"`
+}
+
+// auditChangeRecorder collects the changes made by the repositories during a request
+type auditChangeRecorder struct {
+	mu      sync.Mutex
+	changes []database.Change
+}
+
+func (recorder *auditChangeRecorder) RecordChange(change database.Change) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.changes = append(recorder.changes, change)
+}
+
+// auditChanges converts the recorded changes, redacting and diffing the documents
+func (recorder *auditChangeRecorder) auditChanges() []AuditChange {
+	if recorder == nil {
+		return nil
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	var changes []AuditChange
+	for _, change := range recorder.changes {
+		auditChange := AuditChange{
+			Model:     change.Model,
+			ID:        change.ID,
+			Operation: change.Operation,
+			Before:    auditDocument(change.Before),
+			After:     auditDocument(change.After),
+		}
+		if change.Operation == database.ChangeUpdate {
+			auditChange.Diff = diffAuditDocuments("", auditChange.Before, auditChange.After)
+		}
+		changes = append(changes, auditChange)
+	}
+
+	return changes
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// auditDocument converts a document to a map keyed by its JSON field names,
+// applying the audit tags. It returns nil for documents that are not structs.
+func auditDocument(doc any) map[string]any {
+	value := reflect.ValueOf(doc)
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := map[string]any{}
+	addAuditFields(fields, value)
+	return fields
+}
+
+func addAuditFields(fields map[string]any, value reflect.Value) {
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		auditTag := field.Tag.Get("audit")
+		if auditTag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+
+		// Embedded structs without a json name are flattened, as encoding/json does
+		if field.Anonymous && name == "" {
+			for fieldValue.Kind() == reflect.Pointer {
+				if fieldValue.IsNil() {
+					break
+				}
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct {
+				addAuditFields(fields, fieldValue)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if auditTag == "redact" {
+			fields[name] = AuditRedacted
+			continue
+		}
+
+		fields[name] = auditValue(fieldValue)
+	}
+}
+
+// auditValue converts nested structs, slices and maps so their audit tags are applied
+func auditValue(value reflect.Value) any {
+	if !value.IsValid() {
+		return nil
+	}
+
+	if value.Type() == timeType || value.Type().Implements(jsonMarshalerType) || value.Type().Implements(textMarshalerType) {
+		return value.Interface()
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return auditValue(value.Elem())
+	case reflect.Struct:
+		fields := map[string]any{}
+		addAuditFields(fields, value)
+		return fields
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return value.Interface()
+		}
+		items := make([]any, value.Len())
+		for i := range value.Len() {
+			items[i] = auditValue(value.Index(i))
+		}
+		return items
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+		if value.Type().Key().Kind() != reflect.String {
+			return value.Interface()
+		}
+		items := make(map[string]any, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			items[iter.Key().String()] = auditValue(iter.Value())
+		}
+		return items
+	}
+
+	return value.Interface()
+}
+
+// diffAuditDocuments returns the fields whose value differs between before
+// and after, sorted by field. Nested documents are compared field by field.
+func diffAuditDocuments(prefix string, before map[string]any, after map[string]any) []AuditFieldChange {
+	keys := map[string]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	var changes []AuditFieldChange
+	for key := range keys {
+		field := prefix + key
+		beforeValue, afterValue := before[key], after[key]
+
+		beforeMap, beforeIsMap := beforeValue.(map[string]any)
+		afterMap, afterIsMap := afterValue.(map[string]any)
+		if beforeIsMap && afterIsMap {
+			changes = append(changes, diffAuditDocuments(field+".", beforeMap, afterMap)...)
+			continue
+		}
+
+		if !reflect.DeepEqual(beforeValue, afterValue) {
+			changes = append(changes, AuditFieldChange{Field: field, Before: beforeValue, After: afterValue})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b AuditFieldChange) int { return strings.Compare(a.Field, b.Field) })
+	return changes
+}
@@ -0,0 +1,246 @@
+package rest
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"github.com/go-errors/errors"
+	"github.com/xompass/vsaas-rest/database"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const defaultAuditMaxBackups = 5
+
+// MongoAuditSink inserts the audit events in a MongoDB collection
+type MongoAuditSink struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAuditSink writes the events to collection, in the database of the
+// Mongo connector named connectorName of datasource
+func NewMongoAuditSink(datasource *database.Datasource, connectorName string, collection string) (*MongoAuditSink, error) {
+	connector, err := datasource.GetConnector(connectorName)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoConnector, ok := connector.(*database.MongoConnector)
+	if !ok {
+		return nil, errors.Errorf("connector %s is not a MongoConnector", connectorName)
+	}
+
+	client, ok := mongoConnector.GetDriver().(*mongo.Client)
+	if !ok || client == nil {
+		return nil, errors.Errorf("connector %s is not connected", connectorName)
+	}
+
+	return &MongoAuditSink{collection: client.Database(mongoConnector.GetDatabaseName()).Collection(collection)}, nil
+}
+
+func (sink *MongoAuditSink) WriteEvents(ctx context.Context, events []AuditEvent) error {
+	documents := make([]any, len(events))
+	for i, event := range events {
+		documents[i] = event
+	}
+
+	// Unordered, so the events after a failed one are still inserted. Events
+	// already inserted by a previous attempt fail with a duplicate key error.
+	_, err := sink.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if onlyDuplicateKeyErrors(err) {
+		return nil
+	}
+	return err
+}
+
+func onlyDuplicateKeyErrors(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		if !writeErr.HasErrorCode(11000) {
+			return false
+		}
+	}
+	return true
+}
+
+// JSONLinesAuditSinkOptions configures a JSONLinesAuditSink
+type JSONLinesAuditSinkOptions struct {
+	Path       string // File the events are appended to
+	MaxSize    int64  // Size in bytes at which the file is rotated. Zero disables rotation
+	MaxBackups int    // Rotated files kept, from Path.1 (newest) to Path.MaxBackups. Defaults to 5
+}
+
+// JSONLinesAuditSink appends the audit events to a file, one JSON object per line
+type JSONLinesAuditSink struct {
+	mu      sync.Mutex
+	options JSONLinesAuditSinkOptions
+	file    *os.File
+	size    int64
+}
+
+func NewJSONLinesAuditSink(opts JSONLinesAuditSinkOptions) (*JSONLinesAuditSink, error) {
+	if opts.Path == "" {
+		return nil, errors.New("the audit file path is required")
+	}
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = defaultAuditMaxBackups
+	}
+
+	sink := &JSONLinesAuditSink{options: opts}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+func (sink *JSONLinesAuditSink) WriteEvents(ctx context.Context, events []AuditEvent) error {
+	var data []byte
+	for _, event := range events {
+		line, err := sonic.Marshal(event)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.file == nil {
+		return errors.New("the audit file is closed")
+	}
+
+	if sink.options.MaxSize > 0 && sink.size > 0 && sink.size+int64(len(data)) > sink.options.MaxSize {
+		if err := sink.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := sink.file.Write(data)
+	sink.size += int64(n)
+	return err
+}
+
+// Close closes the file. Events written afterwards fail.
+func (sink *JSONLinesAuditSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.file == nil {
+		return nil
+	}
+
+	err := sink.file.Close()
+	sink.file = nil
+	return err
+}
+
+func (sink *JSONLinesAuditSink) open() error {
+	file, err := os.OpenFile(sink.options.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	sink.file = file
+	sink.size = info.Size()
+	return nil
+}
+
+// rotate shifts the backups, drops the oldest one and starts a new file. The
+// caller must hold the lock.
+func (sink *JSONLinesAuditSink) rotate() error {
+	if err := sink.file.Close(); err != nil {
+		return err
+	}
+	sink.file = nil
+
+	path := sink.options.Path
+	backup := func(n int) string { return path + "." + strconv.Itoa(n) }
+
+	if err := os.Remove(backup(sink.options.MaxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := sink.options.MaxBackups - 1; n >= 1; n-- {
+		if err := os.Rename(backup(n), backup(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(path, backup(1)); err != nil {
+		return err
+	}
+
+	return sink.open()
+}
+
+// SlogAuditSink logs the audit events with a slog.Logger, e.g. to ship them
+// with the application logs
+type SlogAuditSink struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewSlogAuditSink logs the events at info level. A nil logger uses slog.Default().
+func NewSlogAuditSink(logger *slog.Logger) *SlogAuditSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogAuditSink{logger: logger, level: slog.LevelInfo}
+}
+
+func (sink *SlogAuditSink) WriteEvents(ctx context.Context, events []AuditEvent) error {
+	for _, event := range events {
+		sink.logger.LogAttrs(ctx, sink.level, "audit", event.slogAttrs()...)
+	}
+	return nil
+}
+
+// slogAttrs returns the fields of the event as log attributes
+func (event AuditEvent) slogAttrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("id", event.ID),
+		slog.Time("time", event.Time),
+		slog.String("endpoint", event.Endpoint),
+		slog.String("method", event.Method),
+		slog.String("path", event.Path),
+		slog.String("ipAddress", event.IPAddress),
+		slog.Int("statusCode", event.StatusCode),
+		slog.Int64("durationMs", event.DurationMs),
+	}
+
+	for _, attr := range []slog.Attr{
+		slog.String("actionType", event.ActionType),
+		slog.String("model", event.Model),
+		slog.String("principalId", event.PrincipalID),
+		slog.String("principalRole", event.PrincipalRole),
+		slog.String("requestId", event.RequestID),
+	} {
+		if attr.Value.String() != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+
+	if event.ModelID != nil {
+		attrs = append(attrs, slog.Any("modelId", event.ModelID))
+	}
+
+	if len(event.Changes) > 0 {
+		attrs = append(attrs, slog.Any("changes", event.Changes))
+	}
+
+	return attrs
+}
@@ -0,0 +1,487 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/database"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// memoryAuditSink records the batches it receives. Its first failures writes fail.
+type memoryAuditSink struct {
+	mu       sync.Mutex
+	batches  [][]AuditEvent
+	failures int
+	gate     chan struct{} // When set, writes wait for it to be closed
+}
+
+func (s *memoryAuditSink) WriteEvents(ctx context.Context, events []AuditEvent) error {
+	if s.gate != nil {
+		<-s.gate
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink unavailable")
+	}
+
+	s.batches = append(s.batches, append([]AuditEvent(nil), events...))
+	return nil
+}
+
+func (s *memoryAuditSink) events() []AuditEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []AuditEvent
+	for _, batch := range s.batches {
+		events = append(events, batch...)
+	}
+	return events
+}
+
+func (s *memoryAuditSink) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sizes := []int{}
+	for _, batch := range s.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func newTestAuditPipeline(config AuditLogConfig) *auditPipeline {
+	return newAuditPipeline(NewRestApp(RestAppOptions{LogLevel: LogLevelError}), config)
+}
+
+func TestAuditPipeline_Batches(t *testing.T) {
+	sink := &memoryAuditSink{}
+	pipeline := newTestAuditPipeline(AuditLogConfig{Sinks: []AuditSink{sink}, BatchSize: 2, FlushInterval: time.Hour})
+
+	for i := range 5 {
+		assert.True(t, pipeline.enqueue(context.Background(), AuditEvent{Endpoint: fmt.Sprint(i)}))
+	}
+	require.NoError(t, pipeline.close(context.Background()))
+
+	assert.Equal(t, []int{2, 2, 1}, sink.batchSizes(), "the last batch is flushed on close")
+	assert.False(t, pipeline.enqueue(context.Background(), AuditEvent{}), "closed pipelines reject events")
+}
+
+func TestAuditPipeline_FlushInterval(t *testing.T) {
+	sink := &memoryAuditSink{}
+	pipeline := newTestAuditPipeline(AuditLogConfig{Sinks: []AuditSink{sink}, BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	t.Cleanup(func() { _ = pipeline.close(context.Background()) })
+
+	pipeline.enqueue(context.Background(), AuditEvent{Endpoint: "a"})
+	assert.Eventually(t, func() bool { return len(sink.events()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestAuditPipeline_Retries(t *testing.T) {
+	sink := &memoryAuditSink{failures: 2}
+	pipeline := newTestAuditPipeline(AuditLogConfig{Sinks: []AuditSink{sink}, RetryBackoff: time.Millisecond})
+	pipeline.enqueue(context.Background(), AuditEvent{Endpoint: "a"})
+	require.NoError(t, pipeline.close(context.Background()))
+	assert.Len(t, sink.events(), 1)
+	assert.Zero(t, pipeline.dropped.Load())
+
+	sink = &memoryAuditSink{failures: 3}
+	pipeline = newTestAuditPipeline(AuditLogConfig{Sinks: []AuditSink{sink}, MaxRetries: 2, RetryBackoff: time.Millisecond})
+	pipeline.enqueue(context.Background(), AuditEvent{Endpoint: "a"})
+	require.NoError(t, pipeline.close(context.Background()))
+	assert.Empty(t, sink.events())
+	assert.Equal(t, int64(1), pipeline.dropped.Load())
+}
+
+func TestAuditPipeline_Overflow(t *testing.T) {
+	gate := make(chan struct{})
+	sink := &memoryAuditSink{gate: gate}
+	pipeline := newTestAuditPipeline(AuditLogConfig{Sinks: []AuditSink{sink}, QueueSize: 1, BatchSize: 1, Overflow: AuditOverflowDrop})
+
+	// The first event is held by the blocked sink, the second fills the queue
+	require.True(t, pipeline.enqueue(context.Background(), AuditEvent{Endpoint: "a"}))
+	require.Eventually(t, func() bool { return len(pipeline.queue) == 0 }, time.Second, time.Millisecond)
+	require.True(t, pipeline.enqueue(context.Background(), AuditEvent{Endpoint: "b"}))
+	assert.False(t, pipeline.enqueue(context.Background(), AuditEvent{Endpoint: "c"}))
+	assert.Equal(t, int64(1), pipeline.dropped.Load())
+
+	pipeline.config.Overflow = AuditOverflowBlock
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.False(t, pipeline.enqueue(ctx, AuditEvent{Endpoint: "d"}), "blocked requests give up when their context ends")
+
+	close(gate)
+	require.NoError(t, pipeline.close(context.Background()))
+	assert.Len(t, sink.events(), 2)
+}
+
+func TestAuditPipeline_FlushTimeout(t *testing.T) {
+	gate := make(chan struct{})
+	sink := &memoryAuditSink{gate: gate}
+	pipeline := newTestAuditPipeline(AuditLogConfig{Sinks: []AuditSink{sink}, BatchSize: 1})
+	pipeline.enqueue(context.Background(), AuditEvent{Endpoint: "a"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		close(gate)
+	}()
+	assert.ErrorIs(t, pipeline.close(ctx), context.DeadlineExceeded)
+}
+
+func TestAuditPipeline_RespondAndLogAndDestroy(t *testing.T) {
+	sink := &memoryAuditSink{}
+	app := NewRestApp(RestAppOptions{
+		LogLevel:       LogLevelError,
+		AuditLogConfig: &AuditLogConfig{Enabled: true, Sinks: []AuditSink{sink}, FlushInterval: time.Hour},
+	})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1", role: "admin"}, testToken{valid: true})
+
+	app.RegisterEndpoint(&Endpoint{
+		Name:       "CreateReport",
+		Method:     MethodPOST,
+		Path:       "/reports",
+		ActionType: "create",
+		Model:      "Report",
+		Handler: func(c *EndpointContext) error {
+			return c.RespondAndLog(map[string]string{"id": "r1"}, "r1", ResponseTypeJSON, http.StatusCreated)
+		},
+	}, app.Group("/api"))
+
+	res, err := app.Test(httptest.NewRequest(http.MethodPost, "/api/reports", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Empty(t, sink.events(), "events are written in the background")
+
+	require.NoError(t, app.Destroy())
+	events := sink.events()
+	require.Len(t, events, 1)
+	assert.NotEmpty(t, events[0].ID)
+	assert.Equal(t, "CreateReport", events[0].Endpoint)
+	assert.Equal(t, http.MethodPost, events[0].Method)
+	assert.Equal(t, "/api/reports", events[0].Path)
+	assert.Equal(t, "create", events[0].ActionType)
+	assert.Equal(t, "Report", events[0].Model)
+	assert.Equal(t, "r1", events[0].ModelID)
+	assert.Equal(t, "u1", events[0].PrincipalID)
+	assert.Equal(t, "admin", events[0].PrincipalRole)
+	assert.Empty(t, events[0].ResponseBody, "bodies are only kept with a ResponseBodyLimit")
+}
+
+type auditTestAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street" audit:"redact"`
+}
+
+// AuditTestBase is exported because bson skips unexported embedded structs
+type AuditTestBase struct {
+	ID bson.ObjectID `json:"id" bson:"_id,omitempty"`
+}
+
+// auditTestAccount is a model with audit tags, stored in a memory connector
+type auditTestAccount struct {
+	AuditTestBase `bson:",inline"`
+	Name          string           `json:"name" bson:"name"`
+	Password      string           `json:"password" bson:"password" audit:"redact"`
+	Internal      string           `json:"internal" bson:"internal" audit:"-"`
+	Address       auditTestAddress `json:"address" bson:"address"`
+	Created       time.Time        `json:"created" bson:"created"`
+}
+
+func (m auditTestAccount) GetTableName() string     { return "accounts" }
+func (m auditTestAccount) GetModelName() string     { return "Account" }
+func (m auditTestAccount) GetConnectorName() string { return "memory" }
+func (m auditTestAccount) GetId() any               { return m.ID }
+
+func TestAuditPipeline_AllResponses(t *testing.T) {
+	sink := &memoryAuditSink{}
+	app := NewRestApp(RestAppOptions{
+		LogLevel:       LogLevelError,
+		RateLimitStore: NewMemoryRateLimitStore(),
+		AuditLogConfig: &AuditLogConfig{Enabled: true, Sinks: []AuditSink{sink}, ResponseBodyLimit: 20},
+	})
+	// Requests without a role are anonymous
+	app.authorizer = func(c *EndpointContext) (Principal, AuthToken, error) {
+		role := c.EchoCtx.Request().Header.Get("X-Role")
+		if role == "" {
+			return nil, nil, nil
+		}
+		return testPrincipal{id: "u1", role: role}, testToken{valid: true}, nil
+	}
+
+	api := app.Group("/api")
+	for _, ep := range []*Endpoint{
+		{Name: "Plain", Method: MethodGET, Path: "/plain", Handler: func(c *EndpointContext) error {
+			return c.JSON(map[string]string{"message": "a response longer than the limit"})
+		}},
+		{Name: "Admin", Method: MethodGET, Path: "/admin", Roles: []EndpointRole{testRole("admin")}, Handler: func(c *EndpointContext) error {
+			return c.NoContent()
+		}},
+		{Name: "Missing", Method: MethodGET, Path: "/missing", Handler: func(c *EndpointContext) error {
+			return http_errors.NotFoundErrorWithCode("REPORT_NOT_FOUND", "Report not found")
+		}},
+		{Name: "Limited", Method: MethodGET, Path: "/limited", RateLimits: []RateLimit{{Max: 1, Window: time.Minute}}, Handler: func(c *EndpointContext) error {
+			return c.NoContent()
+		}},
+		{Name: "Binary", Method: MethodGET, Path: "/binary", Handler: func(c *EndpointContext) error {
+			return c.EchoCtx.Blob(http.StatusOK, "application/octet-stream", []byte("binary"))
+		}},
+		{Name: "Skipped", Method: MethodGET, Path: "/skipped", AuditDisabled: true, Handler: func(c *EndpointContext) error {
+			return c.NoContent()
+		}},
+	} {
+		app.RegisterEndpoint(ep, api)
+	}
+
+	requests := []struct {
+		path   string
+		role   string
+		status int
+	}{
+		{"/api/plain", "user", http.StatusOK},
+		{"/api/admin", "", http.StatusUnauthorized},
+		{"/api/admin", "user", http.StatusForbidden},
+		{"/api/missing", "user", http.StatusNotFound},
+		{"/api/limited", "user", http.StatusNoContent},
+		{"/api/limited", "user", http.StatusTooManyRequests},
+		{"/api/binary", "user", http.StatusOK},
+		{"/api/skipped", "user", http.StatusNoContent},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(http.MethodGet, r.path, nil)
+		req.Header.Set("X-Role", r.role)
+		res, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, r.status, res.StatusCode, r.path)
+	}
+
+	require.NoError(t, app.Destroy())
+	events := sink.events()
+	require.Len(t, events, len(requests)-1, "AuditDisabled endpoints are not audited")
+
+	for i, event := range events {
+		assert.Equal(t, requests[i].status, event.StatusCode, requests[i].path)
+	}
+
+	assert.Equal(t, `{"message":"a respon`, events[0].ResponseBody, "bodies are cut at ResponseBodyLimit")
+	assert.Empty(t, events[1].PrincipalID)
+	assert.Contains(t, events[1].ResponseBody, "Authenti", "error responses are kept")
+	assert.Equal(t, "u1", events[2].PrincipalID)
+	assert.Contains(t, events[3].ResponseBody, "Report n")
+	assert.Contains(t, events[5].ResponseBody, "Rate lim")
+	assert.Empty(t, events[6].ResponseBody, "binary bodies are not kept")
+}
+
+func TestAuditDocument(t *testing.T) {
+	id := bson.NewObjectID()
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	doc := auditDocument(&auditTestAccount{
+		AuditTestBase: AuditTestBase{ID: id},
+		Name:          "Ana",
+		Password:      "secret",
+		Internal:      "hidden",
+		Address:       auditTestAddress{City: "Santiago", Street: "Main 123"},
+		Created:       created,
+	})
+
+	assert.Equal(t, map[string]any{
+		"id":       id,
+		"name":     "Ana",
+		"password": AuditRedacted,
+		"address":  map[string]any{"city": "Santiago", "street": AuditRedacted},
+		"created":  created,
+	}, doc)
+	assert.Nil(t, auditDocument(nil))
+	assert.Nil(t, auditDocument("not a struct"))
+}
+
+func TestDiffAuditDocuments(t *testing.T) {
+	before := map[string]any{"name": "Ana", "age": 30, "address": map[string]any{"city": "Santiago", "zip": "1"}, "tags": []any{"a"}}
+	after := map[string]any{"name": "Ana", "age": 31, "address": map[string]any{"city": "Lima", "zip": "1"}, "email": "ana@example.com", "tags": []any{"a"}}
+
+	assert.Equal(t, []AuditFieldChange{
+		{Field: "address.city", Before: "Santiago", After: "Lima"},
+		{Field: "age", Before: 30, After: 31},
+		{Field: "email", Before: nil, After: "ana@example.com"},
+	}, diffAuditDocuments("", before, after))
+	assert.Empty(t, diffAuditDocuments("", before, before))
+}
+
+func TestAuditPipeline_Changes(t *testing.T) {
+	ds := &database.Datasource{}
+	require.NoError(t, ds.AddConnector(database.NewMemoryConnector("memory")))
+	accounts, err := database.NewInMemoryRepository[auditTestAccount](ds, database.RepositoryOptions{})
+	require.NoError(t, err)
+
+	id := bson.NewObjectID()
+	_, err = accounts.Insert(context.Background(), auditTestAccount{AuditTestBase: AuditTestBase{ID: id}, Name: "Ana", Password: "old"})
+	require.NoError(t, err)
+
+	newApp := func(config AuditLogConfig) (*RestApp, *memoryAuditSink) {
+		sink := &memoryAuditSink{}
+		config.Enabled = true
+		config.Sinks = []AuditSink{sink}
+		app := NewRestApp(RestAppOptions{LogLevel: LogLevelError, AuditLogConfig: &config})
+		app.authorizer = authorizerFor(testPrincipal{id: "u1", role: "admin"}, testToken{valid: true})
+		app.RegisterEndpoint(&Endpoint{
+			Name:       "UpdateAccount",
+			Method:     MethodPATCH,
+			Path:       "/accounts",
+			ActionType: "update",
+			Model:      "Account",
+			Handler: func(c *EndpointContext) error {
+				update := bson.M{"$set": bson.M{"name": "Bea", "password": "new"}}
+				if err := accounts.UpdateById(c.Context(), id, update); err != nil {
+					return err
+				}
+				return c.RespondAndLog(nil, id, ResponseTypeNoContent, http.StatusNoContent)
+			},
+		}, app.Group("/api"))
+		return app, sink
+	}
+
+	app, sink := newApp(AuditLogConfig{})
+	req := httptest.NewRequest(http.MethodPatch, "/api/accounts", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	res, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	require.NoError(t, app.Destroy())
+
+	events := sink.events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "req-1", events[0].RequestID)
+	assert.Equal(t, http.StatusNoContent, events[0].StatusCode)
+	assert.GreaterOrEqual(t, events[0].DurationMs, int64(0))
+	require.Len(t, events[0].Changes, 1)
+
+	change := events[0].Changes[0]
+	assert.Equal(t, "Account", change.Model)
+	assert.Equal(t, id, change.ID)
+	assert.Equal(t, database.ChangeUpdate, change.Operation)
+	assert.Equal(t, "Ana", change.Before["name"])
+	assert.Equal(t, "Bea", change.After["name"])
+	assert.Equal(t, []AuditFieldChange{{Field: "name", Before: "Ana", After: "Bea"}}, change.Diff, "redacted fields never show their values")
+
+	app, sink = newApp(AuditLogConfig{DisableChanges: true})
+	res, err = app.Test(httptest.NewRequest(http.MethodPatch, "/api/accounts", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	require.NoError(t, app.Destroy())
+
+	events = sink.events()
+	require.Len(t, events, 1)
+	assert.Empty(t, events[0].Changes)
+}
+
+func TestJSONLinesAuditSink_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewJSONLinesAuditSink(JSONLinesAuditSinkOptions{Path: path, MaxSize: 150, MaxBackups: 2})
+	require.NoError(t, err)
+
+	for i := range 4 {
+		require.NoError(t, sink.WriteEvents(context.Background(), []AuditEvent{{ID: fmt.Sprint(i), Endpoint: "GetReport", Method: http.MethodGet}}))
+	}
+	require.NoError(t, sink.Close())
+	assert.Error(t, sink.WriteEvents(context.Background(), []AuditEvent{{}}))
+
+	readIDs := func(path string) []string {
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer file.Close()
+
+		ids := []string{}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var event AuditEvent
+			require.NoError(t, sonic.Unmarshal(scanner.Bytes(), &event))
+			ids = append(ids, event.ID)
+		}
+		return ids
+	}
+
+	// Each event takes about 100 bytes, so every write after the first rotates
+	assert.Equal(t, []string{"3"}, readIDs(path))
+	assert.Equal(t, []string{"2"}, readIDs(path+".1"))
+	assert.Equal(t, []string{"1"}, readIDs(path+".2"))
+	assert.NoFileExists(t, path+".3", "older backups are removed")
+}
+
+func TestSlogAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewSlogAuditSink(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	require.NoError(t, sink.WriteEvents(context.Background(), []AuditEvent{{ID: "e1", Endpoint: "GetReport", PrincipalID: "u1", ModelID: "r1"}}))
+
+	var record map[string]any
+	require.NoError(t, sonic.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "audit", record["msg"])
+	assert.Equal(t, "e1", record["id"])
+	assert.Equal(t, "GetReport", record["endpoint"])
+	assert.Equal(t, "u1", record["principalId"])
+	assert.Equal(t, "r1", record["modelId"])
+	assert.NotContains(t, record, "principalRole", "empty fields are omitted")
+}
+
+// TestMongoAuditSink needs a MongoDB server, e.g. MONGO_TEST_URI=mongodb://localhost:27017
+func TestMongoAuditSink(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	dbName := fmt.Sprintf("vsaas_rest_test_%d", time.Now().UnixNano())
+	connector, err := database.NewMongoConnector(&database.MongoConnectorOpts{
+		ClientOptions: *options.Client().ApplyURI(uri),
+		Name:          "mongodb",
+		Database:      dbName,
+	})
+	require.NoError(t, err)
+
+	ds := &database.Datasource{}
+	require.NoError(t, ds.AddConnector(connector))
+
+	sink, err := NewMongoAuditSink(ds, "mongodb", "audit")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = sink.collection.Database().Drop(context.Background())
+		_ = connector.Disconnect()
+	})
+
+	events := []AuditEvent{{ID: "e1", Endpoint: "GetReport"}, {ID: "e2", Endpoint: "GetReport"}}
+	require.NoError(t, sink.WriteEvents(context.Background(), events[:1]))
+	require.NoError(t, sink.WriteEvents(context.Background(), events), "retried events are not inserted twice")
+
+	count, err := sink.collection.CountDocuments(context.Background(), bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestNewMongoAuditSink_ConnectorMismatch(t *testing.T) {
+	ds := &database.Datasource{}
+	require.NoError(t, ds.AddConnector(database.NewMemoryConnector("memory")))
+
+	_, err := NewMongoAuditSink(ds, "memory", "audit")
+	assert.ErrorContains(t, err, "is not a MongoConnector")
+}
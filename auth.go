@@ -1,10 +1,24 @@
 package rest
 
+import (
+	"fmt"
+	"slices"
+
+	"github.com/xompass/vsaas-rest/http_errors"
+)
+
 type Principal interface {
 	GetPrincipalID() string
 	GetPrincipalRole() string
 }
 
+// TenantPrincipal is implemented by principals that belong to a tenant, e.g.
+// to rate limit all the users of a customer together
+type TenantPrincipal interface {
+	Principal
+	GetTenantID() string
+}
+
 type Authorizer func(*EndpointContext) (Principal, AuthToken, error)
 
 type AuthToken interface {
@@ -14,3 +28,96 @@ type AuthToken interface {
 	GetToken() string
 	GetExpiresAt() int64
 }
+
+// ScopedAuthToken is implemented by tokens that carry scopes. Endpoints with a
+// Scope can only be reached with a token implementing this interface.
+type ScopedAuthToken interface {
+	AuthToken
+	HasScope(scope string) bool
+}
+
+// RoleHierarchy decides whether a principal role satisfies a role required by an endpoint.
+type RoleHierarchy interface {
+	Implies(role string, required string) bool
+}
+
+// StaticRoleHierarchy maps a role to the roles it directly implies,
+// e.g. {"admin": {"operator"}, "operator": {"viewer"}}. Implication is transitive.
+type StaticRoleHierarchy map[string][]string
+
+func (h StaticRoleHierarchy) Implies(role string, required string) bool {
+	if role == required {
+		return true
+	}
+
+	visited := map[string]bool{role: true}
+	pending := []string{role}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		for _, implied := range h[current] {
+			if implied == required {
+				return true
+			}
+			if !visited[implied] {
+				visited[implied] = true
+				pending = append(pending, implied)
+			}
+		}
+	}
+
+	return false
+}
+
+// Error codes returned by the access control stage
+const (
+	AUTH_REQUIRED      = "AUTHENTICATION_REQUIRED"
+	AUTH_INVALID_TOKEN = "INVALID_TOKEN"
+	AUTH_FORBIDDEN     = "INSUFFICIENT_ROLE"
+	AUTH_MISSING_SCOPE = "INSUFFICIENT_SCOPE"
+)
+
+// checkAccess enforces Endpoint.Public, Endpoint.Roles and Endpoint.Scope
+// against the principal and token resolved by the Authorizer. Non-public
+// endpoints require both a principal and a valid token.
+func (receiver *RestApp) checkAccess(ctx *EndpointContext) error {
+	ep := ctx.Endpoint
+	if ep.Public {
+		return nil
+	}
+
+	if ctx.Principal == nil {
+		return http_errors.UnauthorizedErrorWithCode(AUTH_REQUIRED, "Authentication required")
+	}
+
+	if ctx.Token == nil || !ctx.Token.IsValid() {
+		return http_errors.UnauthorizedErrorWithCode(AUTH_INVALID_TOKEN, "Invalid or expired token")
+	}
+
+	if len(ep.Roles) > 0 && !receiver.hasAnyRole(ctx.Principal.GetPrincipalRole(), ep.Roles) {
+		return http_errors.ForbiddenErrorWithCode(AUTH_FORBIDDEN,
+			fmt.Sprintf("Role '%s' is not allowed to access this endpoint", ctx.Principal.GetPrincipalRole()))
+	}
+
+	if ep.Scope != "" {
+		scoped, ok := ctx.Token.(ScopedAuthToken)
+		if !ok || !scoped.HasScope(ep.Scope) {
+			return http_errors.ForbiddenErrorWithCode(AUTH_MISSING_SCOPE,
+				fmt.Sprintf("Token does not have the required scope '%s'", ep.Scope))
+		}
+	}
+
+	return nil
+}
+
+func (receiver *RestApp) hasAnyRole(role string, allowed []EndpointRole) bool {
+	return slices.ContainsFunc(allowed, func(required EndpointRole) bool {
+		if required == nil {
+			return false
+		}
+		if required.RoleName() == role {
+			return true
+		}
+		return receiver.roleHierarchy != nil && receiver.roleHierarchy.Implies(role, required.RoleName())
+	})
+}
@@ -0,0 +1,192 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+)
+
+type testRole string
+
+func (r testRole) RoleName() string { return string(r) }
+
+type testPrincipal struct {
+	id   string
+	role string
+}
+
+func (p testPrincipal) GetPrincipalID() string   { return p.id }
+func (p testPrincipal) GetPrincipalRole() string { return p.role }
+
+type testToken struct {
+	valid  bool
+	scopes []string
+}
+
+func (t testToken) IsValid() bool              { return t.valid }
+func (t testToken) GetUserId() string          { return "user-1" }
+func (t testToken) GetUserType() string        { return "user" }
+func (t testToken) GetToken() string           { return "token" }
+func (t testToken) GetExpiresAt() int64        { return 0 }
+func (t testToken) HasScope(scope string) bool { return slices.Contains(t.scopes, scope) }
+
+func runAuthEndpoint(t *testing.T, app *RestApp, ep *Endpoint) error {
+	t.Helper()
+
+	ep.Method = MethodGET
+	ep.Path = "/secure"
+	ep.Handler = func(c *EndpointContext) error {
+		return c.JSON(map[string]string{"status": "ok"})
+	}
+	ep.app = app
+
+	req := httptest.NewRequest(http.MethodGet, "/secure", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	return ep.run(c)
+}
+
+func authorizerFor(principal Principal, token AuthToken) Authorizer {
+	return func(*EndpointContext) (Principal, AuthToken, error) {
+		return principal, token, nil
+	}
+}
+
+func requireStatus(t *testing.T, err error, status int, code string) {
+	t.Helper()
+
+	require.Error(t, err)
+	errResponse, ok := err.(http_errors.ErrorResponse)
+	require.True(t, ok, "expected ErrorResponse, got %T", err)
+	assert.Equal(t, status, errResponse.StatusCode)
+	assert.Equal(t, code, errResponse.ErrorCode)
+}
+
+func TestCheckAccess_PublicEndpoint(t *testing.T) {
+	app := createTestApp()
+
+	err := runAuthEndpoint(t, app, &Endpoint{Name: "public", Public: true})
+	assert.NoError(t, err)
+}
+
+func TestCheckAccess_MissingPrincipal(t *testing.T) {
+	app := createTestApp()
+	app.authorizer = authorizerFor(nil, nil)
+
+	err := runAuthEndpoint(t, app, &Endpoint{Name: "private"})
+	requireStatus(t, err, http.StatusUnauthorized, AUTH_REQUIRED)
+}
+
+func TestCheckAccess_InvalidToken(t *testing.T) {
+	app := createTestApp()
+	app.authorizer = authorizerFor(testPrincipal{id: "1", role: "admin"}, testToken{valid: false})
+
+	err := runAuthEndpoint(t, app, &Endpoint{Name: "private"})
+	requireStatus(t, err, http.StatusUnauthorized, AUTH_INVALID_TOKEN)
+}
+
+func TestCheckAccess_MissingToken(t *testing.T) {
+	app := createTestApp()
+	app.authorizer = authorizerFor(testPrincipal{id: "1", role: "admin"}, nil)
+
+	err := runAuthEndpoint(t, app, &Endpoint{Name: "private"})
+	requireStatus(t, err, http.StatusUnauthorized, AUTH_INVALID_TOKEN)
+
+	err = runAuthEndpoint(t, app, &Endpoint{Name: "public", Public: true})
+	assert.NoError(t, err)
+}
+
+func TestCheckAccess_Roles(t *testing.T) {
+	tests := []struct {
+		name      string
+		role      string
+		roles     []EndpointRole
+		hierarchy RoleHierarchy
+		allowed   bool
+	}{
+		{name: "no roles required", role: "viewer", allowed: true},
+		{name: "exact role", role: "operator", roles: []EndpointRole{testRole("operator")}, allowed: true},
+		{name: "role not allowed", role: "viewer", roles: []EndpointRole{testRole("operator")}, allowed: false},
+		{
+			name:      "implied role",
+			role:      "admin",
+			roles:     []EndpointRole{testRole("viewer")},
+			hierarchy: StaticRoleHierarchy{"admin": {"operator"}, "operator": {"viewer"}},
+			allowed:   true,
+		},
+		{
+			name:      "hierarchy is not symmetric",
+			role:      "viewer",
+			roles:     []EndpointRole{testRole("admin")},
+			hierarchy: StaticRoleHierarchy{"admin": {"operator"}, "operator": {"viewer"}},
+			allowed:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp()
+			app.roleHierarchy = tt.hierarchy
+			app.authorizer = authorizerFor(testPrincipal{id: "1", role: tt.role}, testToken{valid: true})
+
+			err := runAuthEndpoint(t, app, &Endpoint{Name: "roles", Roles: tt.roles})
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				requireStatus(t, err, http.StatusForbidden, AUTH_FORBIDDEN)
+			}
+		})
+	}
+}
+
+func TestCheckAccess_Scope(t *testing.T) {
+	app := createTestApp()
+
+	app.authorizer = authorizerFor(testPrincipal{id: "1", role: "admin"}, testToken{valid: true, scopes: []string{"devices:read"}})
+	err := runAuthEndpoint(t, app, &Endpoint{Name: "scoped", Scope: "devices:read"})
+	assert.NoError(t, err)
+
+	err = runAuthEndpoint(t, app, &Endpoint{Name: "scoped", Scope: "devices:write"})
+	requireStatus(t, err, http.StatusForbidden, AUTH_MISSING_SCOPE)
+
+	app.authorizer = authorizerFor(testPrincipal{id: "1", role: "admin"}, testToken{valid: true})
+	err = runAuthEndpoint(t, app, &Endpoint{Name: "scoped", Scope: "devices:read"})
+	requireStatus(t, err, http.StatusForbidden, AUTH_MISSING_SCOPE)
+}
+
+func TestStaticRoleHierarchy_Cycles(t *testing.T) {
+	hierarchy := StaticRoleHierarchy{"a": {"b"}, "b": {"a"}}
+
+	assert.True(t, hierarchy.Implies("a", "b"))
+	assert.True(t, hierarchy.Implies("a", "a"))
+	assert.False(t, hierarchy.Implies("a", "c"))
+}
+
+func TestCheckAccess_BeforeBodyParsing(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	app.authorizer = authorizerFor(nil, nil)
+	api := app.Group("/api")
+
+	require.NoError(t, app.RegisterEndpoint(&Endpoint{
+		Name:       "CreateDevice",
+		Method:     MethodPOST,
+		Path:       "/devices",
+		BodyParams: func() any { return &map[string]any{} },
+		Handler:    func(ctx *EndpointContext) error { return ctx.NoContent() },
+	}, api))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/devices", strings.NewReader("{invalid"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res, err := app.Test(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "unauthenticated requests are rejected before the body is read")
+}
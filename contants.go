@@ -16,12 +16,13 @@ const (
 type EndpointMethod string
 
 const (
-	MethodHEAD   EndpointMethod = "Head"
-	MethodGET    EndpointMethod = "Get"
-	MethodPOST   EndpointMethod = "Post"
-	MethodPUT    EndpointMethod = "Put"
-	MethodPATCH  EndpointMethod = "Patch"
-	MethodDELETE EndpointMethod = "Delete"
+	MethodHEAD    EndpointMethod = "Head"
+	MethodGET     EndpointMethod = "Get"
+	MethodPOST    EndpointMethod = "Post"
+	MethodPUT     EndpointMethod = "Put"
+	MethodPATCH   EndpointMethod = "Patch"
+	MethodDELETE  EndpointMethod = "Delete"
+	MethodOPTIONS EndpointMethod = "Options"
 )
 
 type ParamLocation string
@@ -28,6 +28,7 @@ type MiddlewareFunc func(HandlerFunc) HandlerFunc
 // RouterGroup wraps framework-specific router groups to provide a generic interface
 type RouterGroup struct {
 	echoGroup *echo.Group
+	prefix    string // Full path prefix of the group
 }
 
 // EchoContext wraps echo.Context to implement our generic Context interface
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"slices"
+)
+
+// Operations reported to a ChangeRecorder
+const (
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Change is a document modified by a repository. Before and After are the
+// documents (values of the model type) read before and after the operation;
+// After is nil for deletes.
+type Change struct {
+	Model     string
+	ID        any
+	Operation string
+	Before    any
+	After     any
+}
+
+// ChangeRecorder receives the changes made by the repositories with a context
+// returned by WithChangeRecorder, e.g. to audit them
+type ChangeRecorder interface {
+	RecordChange(change Change)
+}
+
+type changeRecorderKey struct{}
+
+// WithChangeRecorder returns a context that makes the repositories report the
+// documents changed by UpdateOne, UpdateById, FindOneAndUpdate, UpdateMany,
+// Upsert, DeleteOne, DeleteById and DeleteMany to recorder, one change per
+// document. Documents inserted by Insert, Create, FindOneOrCreate and Upsert
+// are not reported. Each reported change costs extra reads, and UpdateMany and
+// DeleteMany read every matching document, so the recorder should only be set
+// when the changes are used.
+func WithChangeRecorder(ctx context.Context, recorder ChangeRecorder) context.Context {
+	return context.WithValue(ctx, changeRecorderKey{}, recorder)
+}
+
+// ChangeRecorderFrom returns the recorder of ctx, or nil
+func ChangeRecorderFrom(ctx context.Context) ChangeRecorder {
+	recorder, _ := ctx.Value(changeRecorderKey{}).(ChangeRecorder)
+	return recorder
+}
+
+// recordChange runs apply, which updates or deletes the document matching
+// filter, and reports the document before and after it to the recorder of
+// ctx. The reads are not atomic with apply, so a concurrent write may be
+// reported as part of the change.
+func recordChange[T IModel](ctx context.Context, repository Repository[T], filter *FilterBuilder, operation string, apply func() error) error {
+	recorder := ChangeRecorderFrom(ctx)
+	if recorder == nil {
+		return apply()
+	}
+
+	before, findErr := repository.FindOne(ctx, changeFilter(filter))
+	if err := apply(); err != nil {
+		return err
+	}
+
+	if findErr != nil || before == nil {
+		return nil
+	}
+
+	change := Change{
+		Model:     (*before).GetModelName(),
+		ID:        (*before).GetId(),
+		Operation: operation,
+		Before:    *before,
+	}
+
+	if operation == ChangeUpdate {
+		if after, err := repository.FindById(ctx, change.ID, nil); err == nil && after != nil {
+			change.After = *after
+		}
+	}
+
+	recorder.RecordChange(change)
+	return nil
+}
+
+// recordChanges runs apply, which updates or deletes every document matching
+// filter, and reports a change per document to the recorder of ctx, like
+// recordChange. It reads every matching document before apply, and again
+// after it for updates.
+func recordChanges[T IModel](ctx context.Context, repository Repository[T], filter *FilterBuilder, operation string, apply func() (int64, error)) (int64, error) {
+	recorder := ChangeRecorderFrom(ctx)
+	if recorder == nil {
+		return apply()
+	}
+
+	before, findErr := repository.Find(ctx, changeFilter(filter))
+	count, err := apply()
+	if err != nil {
+		return count, err
+	}
+
+	if findErr != nil || len(before) == 0 {
+		return count, nil
+	}
+
+	ids := make([]any, len(before))
+	for i, doc := range before {
+		ids[i] = doc.GetId()
+	}
+
+	after := map[any]T{}
+	if operation == ChangeUpdate {
+		docs, err := repository.Find(ctx, NewFilter().WithWhere(NewWhere().In(ID, ids)))
+		if err == nil {
+			for _, doc := range docs {
+				after[doc.GetId()] = doc
+			}
+		}
+	}
+
+	for i, doc := range before {
+		change := Change{
+			Model:     doc.GetModelName(),
+			ID:        ids[i],
+			Operation: operation,
+			Before:    doc,
+		}
+		if doc, ok := after[ids[i]]; ok {
+			change.After = doc
+		}
+		recorder.RecordChange(change)
+	}
+
+	return count, nil
+}
+
+// changeFilter returns a filter with only the where clause of filter, so the
+// recorded documents are complete whatever the fields, includes and order the
+// caller asked for
+func changeFilter(filter *FilterBuilder) *FilterBuilder {
+	if filter == nil {
+		return NewFilter()
+	}
+
+	where := NewFilter()
+	where.where = slices.Clone(filter.where)
+	where.err = filter.err
+	return where
+}
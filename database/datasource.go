@@ -1,7 +1,13 @@
 package database
 
 import (
+	"log/slog"
+	"slices"
+	"strings"
+
 	"github.com/go-errors/errors"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Connector es una interfaz genérica para cualquier tipo de conector de base de datos
@@ -18,6 +24,9 @@ type Datasource struct {
 	repositories         map[string]any       // Repositories registered in the datasource.
 	models               map[string]IModel    // Models registered in the datasource.
 	connectorByModelName map[string]Connector // Connectors by model name.
+	logger               *slog.Logger         // Set on the connectors, see SetLogger
+	operationObserver    OperationObserver    // See SetOperationObserver
+	tracer               trace.Tracer         // See SetTracerProvider
 }
 
 func (receiver *Datasource) AddConnector(connector Connector) error {
@@ -29,6 +38,10 @@ func (receiver *Datasource) AddConnector(connector Connector) error {
 		receiver.connectors = make(map[string]Connector)
 	}
 
+	if setter, ok := connector.(loggerSetter); ok && receiver.logger != nil {
+		setter.SetLogger(receiver.logger)
+	}
+
 	receiver.connectors[connector.GetName()] = connector
 	return nil
 }
@@ -96,6 +109,20 @@ func (receiver *Datasource) GetConnector(name string) (Connector, error) {
 	return connector, nil
 }
 
+// GetConnectors returns the connectors of the datasource, sorted by name
+func (receiver *Datasource) GetConnectors() []Connector {
+	if receiver == nil {
+		return nil
+	}
+
+	connectors := make([]Connector, 0, len(receiver.connectors))
+	for _, connector := range receiver.connectors {
+		connectors = append(connectors, connector)
+	}
+	slices.SortFunc(connectors, func(a, b Connector) int { return strings.Compare(a.GetName(), b.GetName()) })
+	return connectors
+}
+
 func (receiver *Datasource) GetModel(modelName string) (IModel, error) {
 	if receiver == nil {
 		return nil, errors.New("datasource is nil")
@@ -176,6 +203,75 @@ func GetDatasourceModelRepository[T IModel](datasource *Datasource, model T) (Re
 	return nil, errors.Errorf("the repository for model %s is not of the expected type", model.GetModelName())
 }
 
+// getRelatedFinder returns the repository registered for modelName, used to
+// resolve includes that target that model.
+func (receiver *Datasource) getRelatedFinder(modelName string) (relatedFinder, error) {
+	if receiver == nil {
+		return nil, errors.New("datasource is nil")
+	}
+
+	repository, ok := receiver.repositories[modelName]
+	if !ok {
+		return nil, http_errors.InternalServerErrorWithCode(RELATION_TARGET_NOT_FOUND, "no repository registered for related model "+modelName)
+	}
+
+	finder, ok := repository.(relatedFinder)
+	if !ok {
+		return nil, http_errors.InternalServerErrorWithCode(RELATION_TARGET_NOT_FOUND, "the repository for model "+modelName+" does not support includes")
+	}
+
+	return finder, nil
+}
+
+// validateSchemaRelations checks the relations of schema. Declared relations
+// also require their target models to be registered in the datasource, so
+// models referenced before their repository exists must be registered first
+// with RegisterModel. The relations inferred from the model struct are only
+// checked when checkInferred is set.
+func (receiver *Datasource) validateSchemaRelations(schema *Schema, checkInferred bool) error {
+	if err := schema.validateRelations(checkInferred); err != nil {
+		return err
+	}
+
+	for _, relation := range schema.Relations {
+		if _, inferred := relation.(*Relation); inferred && !checkInferred {
+			continue
+		}
+
+		for _, model := range relation.relatedModels() {
+			if _, err := receiver.GetModel(model.GetModelName()); err != nil {
+				return errors.Errorf("relation %s of model %s targets model %s, which is not registered in the datasource", relation.GetName(), schema.Name, model.GetModelName())
+			}
+		}
+	}
+
+	return nil
+}
+
+/**
+ * ValidateRelations validates the relations of every registered repository,
+ * including the relations inferred from the model structs.
+ * This method should be called after all repositories are created.
+ */
+func (receiver *Datasource) ValidateRelations() error {
+	if receiver == nil {
+		return errors.New("datasource is nil")
+	}
+
+	for modelName, repository := range receiver.repositories {
+		finder, ok := repository.(relatedFinder)
+		if !ok {
+			continue
+		}
+
+		if err := receiver.validateSchemaRelations(finder.GetSchema(), true); err != nil {
+			return errors.Errorf("invalid relations for model %s: %v", modelName, err)
+		}
+	}
+
+	return nil
+}
+
 /**
  * EnsureIndexes ensures that all indexes defined in registered models are created.
  * This method should be called after all models are registered.
@@ -196,22 +292,12 @@ func (receiver *Datasource) EnsureIndexes() error {
 			return errors.Errorf("failed to get connector for model %s: %v", modelName, err)
 		}
 
-		// Check if connector is MongoDB
-		if mongoConnector, ok := connector.(*MongoConnector); ok {
-			indexManager := mongoConnector.GetIndexManager()
-			if indexManager != nil {
-				if err := indexManager.EnsureIndexes(model); err != nil {
-					return errors.Errorf("failed to ensure indexes for model %s: %v", modelName, err)
-				}
+		indexManager := connectorIndexManager(connector)
+		if indexManager != nil {
+			if err := indexManager.EnsureIndexes(model); err != nil {
+				return errors.Errorf("failed to ensure indexes for model %s: %v", modelName, err)
 			}
 		}
-		// Future: Add support for other database types here
-		// else if postgresConnector, ok := connector.(*PostgresConnector); ok {
-		//     indexManager := postgresConnector.GetIndexManager()
-		//     if err := indexManager.EnsureIndexes(model); err != nil {
-		//         return err
-		//     }
-		// }
 	}
 
 	return nil
@@ -232,14 +318,27 @@ func (receiver *Datasource) EnsureIndexesForModel(model IModel) error {
 		return errors.Errorf("failed to get connector for model %s: %v", model.GetModelName(), err)
 	}
 
-	// Check if connector is MongoDB
-	if mongoConnector, ok := connector.(*MongoConnector); ok {
-		indexManager := mongoConnector.GetIndexManager()
-		if indexManager != nil {
-			return indexManager.EnsureIndexes(model)
+	indexManager := connectorIndexManager(connector)
+	if indexManager != nil {
+		return indexManager.EnsureIndexes(model)
+	}
+
+	return nil
+}
+
+// connectorIndexManager returns the index manager of connector, or nil if the
+// connector does not manage indexes
+func connectorIndexManager(connector Connector) IndexManager {
+	switch c := connector.(type) {
+	case *MongoConnector:
+		if indexManager := c.GetIndexManager(); indexManager != nil {
+			return indexManager
+		}
+	case *PostgresConnector:
+		if indexManager := c.GetIndexManager(); indexManager != nil {
+			return indexManager
 		}
 	}
-	// Future: Add support for other database types
 
 	return nil
 }
@@ -79,6 +79,17 @@ func (b *FilterBuilder) Include(relation string, scope *lbq.Filter) *FilterBuild
 	return b
 }
 
+// GetIncludes returns the relations requested by this filter.
+func (b *FilterBuilder) GetIncludes() []lbq.Include {
+	return b.include
+}
+
+// SetIncludes replaces the relations requested by this filter.
+func (b *FilterBuilder) SetIncludes(includes []lbq.Include) *FilterBuilder {
+	b.include = includes
+	return b
+}
+
 func (f *FilterBuilder) WithWhere(builder *WhereBuilder) *FilterBuilder {
 	where, err := builder.Build()
 	if err != nil {
@@ -18,17 +18,11 @@ type MongoIndexableModel interface {
 	DefineMongoIndexes() []MongoIndexDefinition
 }
 
-// PostgresIndexableModel defines models that can specify Postgres indexes (future)
+// PostgresIndexableModel defines models that can specify Postgres indexes
 type PostgresIndexableModel interface {
 	DefinePostgresIndexes() []PostgresIndexDefinition
 }
 
-// PostgresIndexDefinition placeholder for future Postgres support
-type PostgresIndexDefinition struct {
-	IndexDefinition
-	// Postgres-specific options will go here
-}
-
 // IndexManager is a generic interface for managing database indexes
 type IndexManager interface {
 	// EnsureIndexes creates the indexes for a given model
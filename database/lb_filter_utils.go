@@ -1,7 +1,7 @@
 package database
 
 import (
-	"log"
+	"log/slog"
 	"reflect"
 	"strings"
 	"time"
@@ -220,7 +220,7 @@ func buildWhere(where lbq.Where, parentField string, fields map[string]*Field) (
 
 				_field, exists := getFieldIfExists(key, fields)
 				if !exists {
-					log.Println("Field does not exist:", key)
+					slog.Debug("Filter field does not exist", "field", key)
 					warningList = append(warningList, "field `"+key+"` does not exist")
 					continue
 				}
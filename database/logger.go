@@ -0,0 +1,33 @@
+package database
+
+import "log/slog"
+
+// loggerSetter is implemented by the connectors that log, like the index
+// managers of MongoConnector and PostgresConnector
+type loggerSetter interface {
+	SetLogger(logger *slog.Logger)
+}
+
+// SetLogger makes the connectors of the datasource, including the ones added
+// later, log to logger instead of slog.Default(). RestApp sets its logger on
+// its datasource.
+func (receiver *Datasource) SetLogger(logger *slog.Logger) {
+	if receiver == nil {
+		return
+	}
+
+	receiver.logger = logger
+	for _, connector := range receiver.connectors {
+		if setter, ok := connector.(loggerSetter); ok {
+			setter.SetLogger(logger)
+		}
+	}
+}
+
+// loggerOrDefault returns logger, or slog.Default() when it is nil
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatasource_SetLogger(t *testing.T) {
+	before := &MongoConnector{options: &MongoConnectorOpts{Name: "before"}}
+	after := &PostgresConnector{options: &PostgresConnectorOpts{Name: "after"}}
+
+	ds := &Datasource{}
+	require.NoError(t, ds.AddConnector(before))
+	require.NoError(t, ds.AddConnector(NewMemoryConnector("memory")))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	ds.SetLogger(logger)
+	require.NoError(t, ds.AddConnector(after))
+
+	assert.Same(t, logger, before.logger)
+	assert.Same(t, logger, after.logger, "connectors added later get the logger too")
+
+	NewMongoIndexManager(before).logger().Info("index")
+	assert.Contains(t, buf.String(), "msg=index")
+	assert.Same(t, slog.Default(), NewMongoIndexManager(&MongoConnector{}).logger())
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type MemoryConnector struct {
+	name        string
+	mu          sync.Mutex
+	collections map[string]*memoryCollection
+}
+
+// memoryCollection holds the documents of a table in insertion order
+type memoryCollection struct {
+	mu   sync.RWMutex
+	docs []bson.M
+}
+
+/**
+ * NewMemoryConnector creates a connector that keeps every collection in memory.
+ * It is meant for tests and prototypes: data is lost when the process exits.
+ */
+func NewMemoryConnector(name string) *MemoryConnector {
+	if name == "" {
+		name = "memory"
+	}
+
+	return &MemoryConnector{
+		name:        name,
+		collections: map[string]*memoryCollection{},
+	}
+}
+
+func (receiver *MemoryConnector) Ping() error {
+	return nil
+}
+
+/**
+ * Disconnect drops every collection of the connector.
+ */
+func (receiver *MemoryConnector) Disconnect() error {
+	receiver.Reset()
+	return nil
+}
+
+/**
+ * GetDriver returns the connector itself, as there is no underlying client.
+ */
+func (receiver *MemoryConnector) GetDriver() any {
+	return receiver
+}
+
+func (receiver *MemoryConnector) GetName() string {
+	return receiver.name
+}
+
+func (receiver *MemoryConnector) GetDatabaseName() string {
+	return receiver.name
+}
+
+/**
+ * Reset drops every collection of the connector.
+ */
+func (receiver *MemoryConnector) Reset() {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	receiver.collections = map[string]*memoryCollection{}
+}
+
+func (receiver *MemoryConnector) collection(name string) *memoryCollection {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	collection, ok := receiver.collections[name]
+	if !ok {
+		collection = &memoryCollection{}
+		receiver.collections[name] = collection
+	}
+
+	return collection
+}
@@ -0,0 +1,651 @@
+package database
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/xompass/vsaas-rest/http_errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Error codes for the in-memory query engine
+const (
+	MEMORY_UNSUPPORTED_OPERATOR = "MEMORY_UNSUPPORTED_OPERATOR"
+	MEMORY_INVALID_OPERATOR     = "MEMORY_INVALID_OPERATOR"
+)
+
+// matchMemoryQuery evaluates a MongoDB query, as built by adaptLoopbackFilter,
+// against doc.
+func matchMemoryQuery(doc bson.M, query bson.M) (bool, error) {
+	for key, condition := range query {
+		var matched bool
+		var err error
+
+		switch key {
+		case "$and", "$or", "$nor":
+			matched, err = matchMemoryLogical(doc, key, condition)
+		default:
+			if strings.HasPrefix(key, COMMAND_PREFIX) {
+				return false, unsupportedMemoryOperator(key)
+			}
+			value, found := lookupMemoryPath(doc, key)
+			matched, err = matchMemoryCondition(value, found, condition)
+		}
+
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchMemoryLogical(doc bson.M, operator string, condition any) (bool, error) {
+	clauses, ok := memorySlice(condition)
+	if !ok {
+		return false, http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, operator+" requires an array")
+	}
+
+	for _, clause := range clauses {
+		query, ok := memoryMap(clause)
+		if !ok {
+			return false, http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, operator+" requires an array of documents")
+		}
+
+		matched, err := matchMemoryQuery(doc, query)
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case operator == "$and" && !matched:
+			return false, nil
+		case operator == "$or" && matched:
+			return true, nil
+		case operator == "$nor" && matched:
+			return false, nil
+		}
+	}
+
+	return operator != "$or", nil
+}
+
+func matchMemoryCondition(value any, found bool, condition any) (bool, error) {
+	operators, ok := memoryMap(condition)
+	if !ok || !isMemoryOperatorMap(operators) {
+		return memoryEquals(value, found, condition), nil
+	}
+
+	for operator, operand := range operators {
+		matched, err := matchMemoryOperator(value, found, operator, operand, operators)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchMemoryOperator(value any, found bool, operator string, operand any, operators bson.M) (bool, error) {
+	switch operator {
+	case "$eq":
+		return memoryEquals(value, found, operand), nil
+	case "$ne":
+		return !memoryEquals(value, found, operand), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		return memoryAnyElement(value, func(element any) bool {
+			cmp, ok := compareMemoryValues(element, operand)
+			if !ok {
+				return false
+			}
+			switch operator {
+			case "$gt":
+				return cmp > 0
+			case "$gte":
+				return cmp >= 0
+			case "$lt":
+				return cmp < 0
+			default:
+				return cmp <= 0
+			}
+		}), nil
+	case "$in", "$nin":
+		candidates, ok := memorySlice(operand)
+		if !ok {
+			return false, http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, operator+" requires an array")
+		}
+		in := slices.ContainsFunc(candidates, func(candidate any) bool {
+			return memoryEquals(value, found, candidate)
+		})
+		return in == (operator == "$in"), nil
+	case "$exists":
+		exists, ok := operand.(bool)
+		if !ok {
+			return false, http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, "$exists requires a boolean")
+		}
+		return found == exists, nil
+	case "$regex":
+		options, _ := operators["$options"].(string)
+		re, err := compileMemoryRegex(operand, options)
+		if err != nil {
+			return false, err
+		}
+		return memoryAnyElement(value, func(element any) bool {
+			s, ok := element.(string)
+			return ok && re.MatchString(s)
+		}), nil
+	case "$options":
+		// Consumed by $regex
+		return true, nil
+	case "$not":
+		matched, err := matchMemoryCondition(value, found, operand)
+		return !matched, err
+	case "$type":
+		if normalizeMemoryValue(operand) != float64(10) && operand != "null" {
+			return false, unsupportedMemoryOperator(fmt.Sprintf("$type %v", operand))
+		}
+		return found && value == nil, nil
+	default:
+		return false, unsupportedMemoryOperator(operator)
+	}
+}
+
+func compileMemoryRegex(pattern any, options string) (*regexp.Regexp, error) {
+	var expr string
+	switch p := pattern.(type) {
+	case string:
+		expr = p
+	case bson.Regex:
+		expr = p.Pattern
+		options += p.Options
+	case *regexp.Regexp:
+		return p, nil
+	default:
+		return nil, http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, fmt.Sprintf("invalid $regex value: %T", pattern))
+	}
+
+	flags := ""
+	for _, option := range options {
+		if strings.ContainsRune("ims", option) && !strings.ContainsRune(flags, option) {
+			flags += string(option)
+		}
+	}
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, "invalid $regex value: "+err.Error())
+	}
+
+	return re, nil
+}
+
+// memoryEquals reports whether value equals target. As in MongoDB, a nil
+// target also matches missing fields and an array matches when any of its
+// elements does.
+func memoryEquals(value any, found bool, target any) bool {
+	if target == nil {
+		return !found || value == nil
+	}
+
+	if !found {
+		return false
+	}
+
+	if equalMemoryValues(value, target) {
+		return true
+	}
+
+	if _, isArray := memorySlice(target); isArray {
+		return false
+	}
+
+	return memoryAnyElement(value, func(element any) bool {
+		return equalMemoryValues(element, target)
+	})
+}
+
+func memoryAnyElement(value any, predicate func(any) bool) bool {
+	if elements, ok := memorySlice(value); ok {
+		return slices.ContainsFunc(elements, predicate)
+	}
+	return predicate(value)
+}
+
+func equalMemoryValues(a any, b any) bool {
+	if cmp, ok := compareMemoryValues(a, b); ok {
+		return cmp == 0
+	}
+
+	a, b = normalizeMemoryValue(a), normalizeMemoryValue(b)
+	if as, ok := memorySlice(a); ok {
+		bs, ok := memorySlice(b)
+		return ok && slices.EqualFunc(as, bs, equalMemoryValues)
+	}
+
+	if am, ok := memoryMap(a); ok {
+		bm, ok := memoryMap(b)
+		if !ok || len(am) != len(bm) {
+			return false
+		}
+		for key, value := range am {
+			other, ok := bm[key]
+			if !ok || !equalMemoryValues(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// compareMemoryValues compares two scalar values of the same kind. The second
+// result is false when the values cannot be compared.
+func compareMemoryValues(a any, b any) (int, bool) {
+	a, b = normalizeMemoryValue(a), normalizeMemoryValue(b)
+
+	switch av := a.(type) {
+	case float64:
+		if bv, ok := b.(float64); ok {
+			return cmp.Compare(av, bv), true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			return av.Compare(bv), true
+		}
+	case bson.ObjectID:
+		if bv, ok := b.(bson.ObjectID); ok {
+			return strings.Compare(av.Hex(), bv.Hex()), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0, true
+			case bv:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// normalizeMemoryValue converts the values produced by the BSON codec and by
+// the filter parser to a common representation: numbers become float64 and
+// dates become time.Time with millisecond precision.
+func normalizeMemoryValue(value any) any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case bson.DateTime:
+		return v.Time().UTC()
+	case time.Time:
+		return bson.NewDateTimeFromTime(v).Time().UTC()
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		return normalizeMemoryValue(rv.Elem().Interface())
+	}
+
+	return value
+}
+
+func isMemoryOperatorMap(m bson.M) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for key := range m {
+		if !strings.HasPrefix(key, COMMAND_PREFIX) {
+			return false
+		}
+	}
+	return true
+}
+
+func memoryMap(value any) (bson.M, bool) {
+	switch v := value.(type) {
+	case bson.M:
+		return v, true
+	case map[string]any:
+		return v, true
+	case bson.D:
+		m := make(bson.M, len(v))
+		for _, elem := range v {
+			m[elem.Key] = elem.Value
+		}
+		return m, true
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+		m := make(bson.M, rv.Len())
+		for _, key := range rv.MapKeys() {
+			m[key.String()] = rv.MapIndex(key).Interface()
+		}
+		return m, true
+	}
+
+	return nil, false
+}
+
+func memorySlice(value any) ([]any, bool) {
+	switch v := value.(type) {
+	case bson.A:
+		return v, true
+	case []any:
+		return v, true
+	case []byte, bson.D:
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	elements := make([]any, rv.Len())
+	for i := range elements {
+		elements[i] = rv.Index(i).Interface()
+	}
+	return elements, true
+}
+
+// lookupMemoryPath returns the value at a dotted path of doc
+func lookupMemoryPath(doc bson.M, path string) (any, bool) {
+	var current any = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := memoryMap(current)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setMemoryPath sets the value at a dotted path of doc, creating the missing
+// embedded documents.
+func setMemoryPath(doc bson.M, path string, value any) error {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part]
+		if !ok || next == nil {
+			child := bson.M{}
+			current[part] = child
+			current = child
+			continue
+		}
+
+		child, ok := memoryMap(next)
+		if !ok {
+			return http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, "cannot create field "+part+" in "+path)
+		}
+		current[part] = child
+		current = child
+	}
+
+	current[parts[len(parts)-1]] = value
+	return nil
+}
+
+func unsetMemoryPath(doc bson.M, path string) {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := memoryMap(current[part])
+		if !ok {
+			return
+		}
+		current[part] = child
+		current = child
+	}
+	delete(current, parts[len(parts)-1])
+}
+
+// applyMemoryUpdate applies an update document, as returned by
+// prepareUpdateDocument, to doc. $setOnInsert is only applied when inserting.
+func applyMemoryUpdate(doc bson.M, update bson.M, inserting bool) error {
+	for operator, value := range update {
+		fields, err := toBsonMap(value)
+		if err != nil {
+			return err
+		}
+
+		for path, operand := range fields {
+			if err := applyMemoryUpdateOperator(doc, operator, path, operand, inserting); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func applyMemoryUpdateOperator(doc bson.M, operator string, path string, operand any, inserting bool) error {
+	switch operator {
+	case SET:
+		return setMemoryPath(doc, path, operand)
+	case SET_ON_INSERT:
+		if inserting {
+			return setMemoryPath(doc, path, operand)
+		}
+		return nil
+	case "$unset":
+		unsetMemoryPath(doc, path)
+		return nil
+	case CURRENT_DATE:
+		return setMemoryPath(doc, path, time.Now())
+	case "$inc":
+		current, found := lookupMemoryPath(doc, path)
+		delta, ok := normalizeMemoryValue(operand).(float64)
+		if !ok {
+			return http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, "$inc requires a number")
+		}
+		if !found || current == nil {
+			return setMemoryPath(doc, path, operand)
+		}
+		total, ok := normalizeMemoryValue(current).(float64)
+		if !ok {
+			return http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, "cannot apply $inc to non-numeric field "+path)
+		}
+		return setMemoryPath(doc, path, total+delta)
+	case "$push", "$addToSet":
+		current, found := lookupMemoryPath(doc, path)
+		var elements []any
+		if found && current != nil {
+			var ok bool
+			elements, ok = memorySlice(current)
+			if !ok {
+				return http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, "cannot apply "+operator+" to non-array field "+path)
+			}
+		}
+		values := []any{operand}
+		if each, ok := memoryMap(operand); ok {
+			if list, ok := memorySlice(each["$each"]); ok {
+				values = list
+			}
+		}
+		for _, value := range values {
+			if operator == "$addToSet" && slices.ContainsFunc(elements, func(element any) bool { return equalMemoryValues(element, value) }) {
+				continue
+			}
+			elements = append(elements, value)
+		}
+		return setMemoryPath(doc, path, bson.A(elements))
+	case "$pull":
+		current, found := lookupMemoryPath(doc, path)
+		if !found {
+			return nil
+		}
+		elements, ok := memorySlice(current)
+		if !ok {
+			return http_errors.BadRequestErrorWithCode(MEMORY_INVALID_OPERATOR, "cannot apply $pull to non-array field "+path)
+		}
+		elements = slices.DeleteFunc(elements, func(element any) bool {
+			matched, _ := matchMemoryCondition(element, true, operand)
+			return matched
+		})
+		return setMemoryPath(doc, path, bson.A(elements))
+	default:
+		return unsupportedMemoryOperator(operator)
+	}
+}
+
+// memoryUpsertDocument returns the document seeded by an upsert: the fields
+// compared by equality in query.
+func memoryUpsertDocument(query bson.M) bson.M {
+	doc := bson.M{}
+	for key, condition := range query {
+		if key == "$and" {
+			clauses, _ := memorySlice(condition)
+			for _, clause := range clauses {
+				if m, ok := memoryMap(clause); ok {
+					for field, value := range memoryUpsertDocument(m) {
+						doc[field] = value
+					}
+				}
+			}
+			continue
+		}
+
+		if strings.HasPrefix(key, COMMAND_PREFIX) {
+			continue
+		}
+
+		if operators, ok := memoryMap(condition); ok && isMemoryOperatorMap(operators) {
+			if value, ok := operators["$eq"]; ok {
+				_ = setMemoryPath(doc, key, value)
+			}
+			continue
+		}
+
+		_ = setMemoryPath(doc, key, condition)
+	}
+	return doc
+}
+
+// compareMemoryDocuments orders two documents by sort, a list of field and
+// direction pairs. Missing and null values sort first.
+func compareMemoryDocuments(a bson.M, b bson.M, sort bson.D) int {
+	for _, elem := range sort {
+		av, _ := lookupMemoryPath(a, elem.Key)
+		bv, _ := lookupMemoryPath(b, elem.Key)
+
+		cmp, ok := compareMemoryValues(av, bv)
+		if !ok {
+			switch {
+			case av == nil && bv == nil:
+				cmp = 0
+			case av == nil:
+				cmp = -1
+			case bv == nil:
+				cmp = 1
+			default:
+				cmp = strings.Compare(fmt.Sprint(normalizeMemoryValue(av)), fmt.Sprint(normalizeMemoryValue(bv)))
+			}
+		}
+
+		if direction, _ := normalizeMemoryValue(elem.Value).(float64); direction < 0 {
+			cmp = -cmp
+		}
+
+		if cmp != 0 {
+			return cmp
+		}
+	}
+
+	return 0
+}
+
+// projectMemoryDocument applies a projection of bson field names to doc
+func projectMemoryDocument(doc bson.M, projection map[string]bool) bson.M {
+	if len(projection) == 0 {
+		return doc
+	}
+
+	inclusion := false
+	for _, include := range projection {
+		if include {
+			inclusion = true
+			break
+		}
+	}
+
+	if !inclusion {
+		result := bson.M{}
+		for key, value := range doc {
+			result[key] = value
+		}
+		for key, include := range projection {
+			if !include {
+				unsetMemoryPath(result, key)
+			}
+		}
+		return result
+	}
+
+	result := bson.M{}
+	if include, ok := projection["_id"]; !ok || include {
+		if id, ok := doc["_id"]; ok {
+			result["_id"] = id
+		}
+	}
+	for key, include := range projection {
+		if !include || key == "_id" {
+			continue
+		}
+		if value, ok := lookupMemoryPath(doc, key); ok {
+			_ = setMemoryPath(result, key, value)
+		}
+	}
+	return result
+}
+
+func unsupportedMemoryOperator(operator string) error {
+	return http_errors.BadRequestErrorWithCode(MEMORY_UNSUPPORTED_OPERATOR, "operator "+operator+" is not supported by the in-memory repository")
+}
@@ -0,0 +1,660 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"slices"
+
+	"github.com/xompass/vsaas-rest/http_errors"
+	"github.com/xompass/vsaas-rest/lbq"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Error codes for memory_repository. Errors shared with MongoRepository
+// (nil ids, missing documents, duplicate keys) keep the MONGO_ codes, so
+// application code behaves the same with both repositories.
+const (
+	MEMORY_CONNECTOR_TYPE_MISMATCH = "MEMORY_CONNECTOR_TYPE_MISMATCH"
+	MEMORY_CONNECTOR_NIL           = "MEMORY_CONNECTOR_NIL"
+	MEMORY_ID_REQUIRED             = "MEMORY_ID_REQUIRED"
+)
+
+// InMemoryRepository is a Repository that keeps its documents in a
+// MemoryConnector. Queries are evaluated with MongoDB semantics, so it can
+// replace a MongoRepository in tests and prototypes.
+type InMemoryRepository[T IModel] struct {
+	Options    RepositoryOptions
+	tableName  string
+	schema     *Schema
+	connector  *MemoryConnector
+	datasource *Datasource
+}
+
+func NewInMemoryRepository[T IModel](ds *Datasource, options RepositoryOptions) (Repository[T], error) {
+	var instance T
+
+	schema := NewSchema(instance)
+
+	err := ds.RegisterModel(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ds.validateSchemaRelations(schema, false); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ds.GetModelConnector(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, ok := tmp.(*MemoryConnector)
+	if !ok {
+		return nil, http_errors.InternalServerErrorWithCode(MEMORY_CONNECTOR_TYPE_MISMATCH, "the connector for model "+instance.GetModelName()+" is not a MemoryConnector")
+	}
+
+	if connector == nil {
+		return nil, http_errors.InternalServerErrorWithCode(MEMORY_CONNECTOR_NIL, "connector is nil")
+	}
+
+	repository := &InMemoryRepository[T]{
+		Options:    options,
+		tableName:  instance.GetTableName(),
+		schema:     schema,
+		connector:  connector,
+		datasource: ds,
+	}
+
+	RegisterDatasourceRepository(ds, instance, repository)
+
+	return repository, nil
+}
+
+func (repository *InMemoryRepository[T]) GetSchema() *Schema {
+	return repository.schema
+}
+
+func (repository *InMemoryRepository[T]) GetConnector() Connector {
+	return repository.connector
+}
+
+func (repository *InMemoryRepository[T]) collection() *memoryCollection {
+	return repository.connector.collection(repository.tableName)
+}
+
+func (repository *InMemoryRepository[T]) Find(ctx context.Context, filterBuilder *FilterBuilder) ([]T, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, parsedFilter, lbFilter, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := repository.collection()
+	collection.mu.RLock()
+	matches, err := repository.match(collection, query, parsedFilter.Options.Sort)
+	if err == nil {
+		matches = paginateMemoryDocuments(matches, parsedFilter.Options.Skip, parsedFilter.Options.Limit)
+	}
+	var receiver []T
+	if err == nil {
+		receiver, err = repository.decodeAll(matches, parsedFilter.Options.Fields)
+	}
+	collection.mu.RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repository.resolveIncludes(ctx, receiver, lbFilter.Include); err != nil {
+		return nil, err
+	}
+
+	return receiver, nil
+}
+
+func (repository *InMemoryRepository[T]) FindOne(ctx context.Context, filterBuilder *FilterBuilder) (*T, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, parsedFilter, lbFilter, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	one := uint(1)
+	collection := repository.collection()
+	collection.mu.RLock()
+	matches, err := repository.match(collection, query, parsedFilter.Options.Sort)
+	if err == nil {
+		matches = paginateMemoryDocuments(matches, parsedFilter.Options.Skip, &one)
+	}
+	var receiver []T
+	if err == nil {
+		receiver, err = repository.decodeAll(matches, parsedFilter.Options.Fields)
+	}
+	collection.mu.RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(receiver) == 0 {
+		return nil, nil
+	}
+
+	if err := repository.resolveIncludes(ctx, receiver, lbFilter.Include); err != nil {
+		return nil, err
+	}
+
+	return &receiver[0], nil
+}
+
+func (repository *InMemoryRepository[T]) FindById(ctx context.Context, id any, filterBuilder *FilterBuilder) (*T, error) {
+	if id == nil {
+		return nil, http_errors.BadRequestErrorWithCode(MONGO_ID_CANNOT_BE_NIL, "id cannot be nil")
+	}
+
+	var filterClone *FilterBuilder
+	if filterBuilder == nil {
+		filterClone = NewFilter()
+	} else {
+		filterClone = filterBuilder.Clone()
+	}
+
+	filterClone.WithWhere(NewWhere().Eq(ID, id))
+
+	return repository.FindOne(ctx, filterClone)
+}
+
+func (repository *InMemoryRepository[T]) Insert(ctx context.Context, doc T) (any, error) {
+	if hook, ok := any(&doc).(BeforeCreateHook); ok {
+		if err := hook.BeforeCreate(); err != nil {
+			return nil, err
+		}
+	}
+
+	document, err := repository.Options.prepareInsertDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := repository.collection()
+	collection.mu.Lock()
+	defer collection.mu.Unlock()
+
+	return repository.insert(collection, document)
+}
+
+func (repository *InMemoryRepository[T]) Create(ctx context.Context, doc T) (*T, error) {
+	insertedID, err := repository.Insert(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.FindById(ctx, insertedID, NewFilter())
+}
+
+func (repository *InMemoryRepository[T]) FindOneOrCreate(ctx context.Context, filterBuilder *FilterBuilder, doc T) (*T, error) {
+	document, err := toBsonMap(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.findOneAndUpdate(filterBuilder, bson.M{SET_ON_INSERT: document}, true)
+}
+
+func (repository *InMemoryRepository[T]) Upsert(ctx context.Context, filterBuilder *FilterBuilder, update any) error {
+	if update == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	return recordChange(ctx, repository, filterBuilder, ChangeUpdate, func() error {
+		_, err := repository.update(filterBuilder, update, false, true)
+		return err
+	})
+}
+
+func (repository *InMemoryRepository[T]) UpdateOne(ctx context.Context, filterBuilder *FilterBuilder, update any) error {
+	if update == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	return recordChange(ctx, repository, filterBuilder, ChangeUpdate, func() error {
+		_, err := repository.update(filterBuilder, update, false, false)
+		return err
+	})
+}
+
+func (repository *InMemoryRepository[T]) UpdateById(ctx context.Context, id any, update any) error {
+	if id == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_ID_CANNOT_BE_NIL, "id cannot be nil")
+	}
+
+	if update == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	filter := NewFilter().
+		WithWhere(NewWhere().Eq(ID, id))
+	return repository.UpdateOne(ctx, filter, update)
+}
+
+func (repository *InMemoryRepository[T]) FindOneAndUpdate(ctx context.Context, filterBuilder *FilterBuilder, update any) (*T, error) {
+	if update == nil {
+		return nil, http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	var result *T
+	err := recordChange(ctx, repository, filterBuilder, ChangeUpdate, func() error {
+		var err error
+		result, err = repository.findOneAndUpdate(filterBuilder, update, false)
+		return err
+	})
+	return result, err
+}
+
+func (repository *InMemoryRepository[T]) UpdateMany(ctx context.Context, filterBuilder *FilterBuilder, update any) (int64, error) {
+	if update == nil {
+		return 0, http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	return recordChanges(ctx, repository, filterBuilder, ChangeUpdate, func() (int64, error) {
+		return repository.update(filterBuilder, update, true, false)
+	})
+}
+
+func (repository *InMemoryRepository[T]) Count(ctx context.Context, filterBuilder *FilterBuilder) (int64, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, _, _, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return 0, err
+	}
+
+	collection := repository.collection()
+	collection.mu.RLock()
+	defer collection.mu.RUnlock()
+
+	matches, err := repository.match(collection, query, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(matches)), nil
+}
+
+func (repository *InMemoryRepository[T]) Exists(ctx context.Context, id any) (bool, error) {
+	if id == nil {
+		return false, http_errors.BadRequestErrorWithCode(MONGO_ID_CANNOT_BE_NIL, "id cannot be nil")
+	}
+
+	count, err := repository.Count(ctx, NewFilter().WithWhere(NewWhere().Eq(ID, id)))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (repository *InMemoryRepository[T]) DeleteOne(ctx context.Context, filterBuilder *FilterBuilder) error {
+	return recordChange(ctx, repository, filterBuilder, ChangeDelete, func() error {
+		deleted, err := repository.delete(filterBuilder, false)
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return http_errors.NotFoundErrorWithCode(MONGO_NO_DOCUMENTS_FOUND, NO_DOCUMENTS)
+		}
+
+		return nil
+	})
+}
+
+func (repository *InMemoryRepository[T]) DeleteById(ctx context.Context, id any) error {
+	if id == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_ID_CANNOT_BE_NIL, "id cannot be nil")
+	}
+
+	filterBuilder := NewFilter().
+		WithWhere(NewWhere().Eq(ID, id))
+
+	return repository.DeleteOne(ctx, filterBuilder)
+}
+
+func (repository *InMemoryRepository[T]) DeleteMany(ctx context.Context, filterBuilder *FilterBuilder) (int64, error) {
+	return recordChanges(ctx, repository, filterBuilder, ChangeDelete, func() (int64, error) {
+		return repository.delete(filterBuilder, true)
+	})
+}
+
+// match returns the documents of collection matching query, ordered by sort.
+// The caller must hold the collection lock.
+func (repository *InMemoryRepository[T]) match(collection *memoryCollection, query bson.M, sort any) ([]bson.M, error) {
+	var matches []bson.M
+	for _, doc := range collection.docs {
+		matched, err := matchMemoryQuery(doc, query)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			matches = append(matches, doc)
+		}
+	}
+
+	if sort, ok := sort.(bson.D); ok && len(sort) > 0 {
+		sort = repository.toBsonSort(sort)
+		slices.SortStableFunc(matches, func(a bson.M, b bson.M) int {
+			return compareMemoryDocuments(a, b, sort)
+		})
+	}
+
+	return matches, nil
+}
+
+// update applies update to the first document matching filterBuilder, or to
+// all of them when many is set, and returns the number of documents modified.
+func (repository *InMemoryRepository[T]) update(filterBuilder *FilterBuilder, update any, many bool, upsert bool) (int64, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, _, _, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return 0, err
+	}
+
+	fixedUpdate, err := repository.Options.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{Insert: upsert})
+	if err != nil {
+		return 0, err
+	}
+
+	collection := repository.collection()
+	collection.mu.Lock()
+	defer collection.mu.Unlock()
+
+	matches, err := repository.match(collection, query, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(matches) == 0 && upsert {
+		_, err := repository.upsert(collection, query, fixedUpdate)
+		return 0, err
+	}
+
+	if !many && len(matches) > 1 {
+		matches = matches[:1]
+	}
+
+	var modified int64
+	for _, doc := range matches {
+		changed, err := repository.apply(collection, doc, fixedUpdate)
+		if err != nil {
+			return modified, err
+		}
+		if changed {
+			modified++
+		}
+	}
+
+	return modified, nil
+}
+
+func (repository *InMemoryRepository[T]) findOneAndUpdate(filterBuilder *FilterBuilder, update any, upsert bool) (*T, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, parsedFilter, _, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	fixedUpdate, err := repository.Options.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{Insert: upsert})
+	if err != nil {
+		return nil, err
+	}
+
+	collection := repository.collection()
+	collection.mu.Lock()
+	defer collection.mu.Unlock()
+
+	matches, err := repository.match(collection, query, parsedFilter.Options.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.M
+	switch {
+	case len(matches) > 0:
+		doc = matches[0]
+		if _, err := repository.apply(collection, doc, fixedUpdate); err != nil {
+			return nil, err
+		}
+		doc = collection.docs[repository.indexOf(collection, doc["_id"])]
+	case upsert:
+		doc, err = repository.upsert(collection, query, fixedUpdate)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	receiver, err := repository.decodeAll([]bson.M{doc}, parsedFilter.Options.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &receiver[0], nil
+}
+
+// apply replaces doc in collection with the result of applying update to it.
+// It reports whether the document changed.
+func (repository *InMemoryRepository[T]) apply(collection *memoryCollection, doc bson.M, update bson.M) (bool, error) {
+	updated, err := cloneMemoryDocument(doc)
+	if err != nil {
+		return false, err
+	}
+
+	if err := applyMemoryUpdate(updated, update, false); err != nil {
+		return false, err
+	}
+
+	updated, err = cloneMemoryDocument(updated)
+	if err != nil {
+		return false, err
+	}
+
+	if !equalMemoryValues(updated["_id"], doc["_id"]) {
+		return false, http_errors.BadRequestErrorWithCode(MONGO_OPERATION_FAILED, "the _id field cannot be modified")
+	}
+
+	index := repository.indexOf(collection, doc["_id"])
+	collection.docs[index] = updated
+
+	return !equalMemoryValues(updated, doc), nil
+}
+
+func (repository *InMemoryRepository[T]) upsert(collection *memoryCollection, query bson.M, update bson.M) (bson.M, error) {
+	doc := memoryUpsertDocument(query)
+	if err := applyMemoryUpdate(doc, update, true); err != nil {
+		return nil, err
+	}
+
+	if _, err := repository.insert(collection, doc); err != nil {
+		return nil, err
+	}
+
+	return collection.docs[len(collection.docs)-1], nil
+}
+
+// insert adds document to collection, generating its _id when missing.
+// The caller must hold the collection lock.
+func (repository *InMemoryRepository[T]) insert(collection *memoryCollection, document bson.M) (any, error) {
+	if id, ok := document["_id"]; !ok || id == nil || reflect.ValueOf(id).IsZero() {
+		id, err := repository.newID()
+		if err != nil {
+			return nil, err
+		}
+		document["_id"] = id
+	}
+
+	document, err := cloneMemoryDocument(document)
+	if err != nil {
+		return nil, err
+	}
+
+	id := document["_id"]
+	if repository.indexOf(collection, id) >= 0 {
+		return nil, http_errors.ConflictErrorWithCode(MONGO_DUPLICATE_KEY, "duplicate key error: _id already exists")
+	}
+
+	collection.docs = append(collection.docs, document)
+
+	return id, nil
+}
+
+// newID generates an _id matching the type of the model id field
+func (repository *InMemoryRepository[T]) newID() (any, error) {
+	for _, field := range repository.schema.Fields {
+		if field.BsonName != "_id" {
+			continue
+		}
+
+		switch field.IndirectFieldType {
+		case reflect.TypeOf(bson.ObjectID{}):
+			return bson.NewObjectID(), nil
+		case reflect.TypeOf(""):
+			return bson.NewObjectID().Hex(), nil
+		}
+		break
+	}
+
+	return nil, http_errors.BadRequestErrorWithCode(MEMORY_ID_REQUIRED, "the document has no _id and none can be generated for model "+repository.schema.Name)
+}
+
+func (repository *InMemoryRepository[T]) indexOf(collection *memoryCollection, id any) int {
+	return slices.IndexFunc(collection.docs, func(doc bson.M) bool {
+		return equalMemoryValues(doc["_id"], id)
+	})
+}
+
+func (repository *InMemoryRepository[T]) delete(filterBuilder *FilterBuilder, many bool) (int64, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, _, _, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return 0, err
+	}
+
+	collection := repository.collection()
+	collection.mu.Lock()
+	defer collection.mu.Unlock()
+
+	matches, err := repository.match(collection, query, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if !many && len(matches) > 1 {
+		matches = matches[:1]
+	}
+
+	for _, doc := range matches {
+		if repository.Options.Deleted {
+			if _, err := repository.apply(collection, doc, bson.M{CURRENT_DATE: bson.M{DELETED: true}}); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		index := repository.indexOf(collection, doc["_id"])
+		collection.docs = slices.Delete(collection.docs, index, index+1)
+	}
+
+	return int64(len(matches)), nil
+}
+
+// decodeAll projects docs and decodes them into T. The caller must hold the
+// collection lock.
+func (repository *InMemoryRepository[T]) decodeAll(docs []bson.M, fields map[string]bool) ([]T, error) {
+	projection := map[string]bool{}
+	for key, include := range fields {
+		if field, ok := getFieldIfExists(key, repository.schema.JSONFields); ok && field.JsonName == key {
+			key = field.BsonName
+		}
+		projection[key] = include
+	}
+
+	receiver := make([]T, 0, len(docs))
+	for _, doc := range docs {
+		data, err := bson.Marshal(projectMemoryDocument(doc, projection))
+		if err != nil {
+			return nil, err
+		}
+
+		var item T
+		if err := bson.Unmarshal(data, &item); err != nil {
+			return nil, err
+		}
+		receiver = append(receiver, item)
+	}
+
+	return receiver, nil
+}
+
+// toBsonSort maps the JSON field names of sort to their BSON names
+func (repository *InMemoryRepository[T]) toBsonSort(sort bson.D) bson.D {
+	result := make(bson.D, 0, len(sort))
+	for _, elem := range sort {
+		key := elem.Key
+		if field, ok := repository.schema.JSONFields[key]; ok {
+			key = field.BsonName
+		}
+		result = append(result, bson.E{Key: key, Value: elem.Value})
+	}
+	return result
+}
+
+func (repository *InMemoryRepository[T]) resolveIncludes(ctx context.Context, docs []T, includes []lbq.Include) error {
+	return resolveIncludes(ctx, repository.datasource, repository.schema, reflect.ValueOf(docs), includes)
+}
+
+func (repository *InMemoryRepository[T]) findRelated(ctx context.Context, foreignKey string, keys []any, scope *lbq.Filter) (reflect.Value, error) {
+	return findRelated(ctx, repository, foreignKey, keys, scope)
+}
+
+// paginateMemoryDocuments applies skip and limit to docs
+func paginateMemoryDocuments(docs []bson.M, skip *uint, limit *uint) []bson.M {
+	if skip != nil {
+		docs = docs[min(int(*skip), len(docs)):]
+	}
+	if limit != nil && int(*limit) < len(docs) {
+		docs = docs[:*limit]
+	}
+	return docs
+}
+
+// cloneMemoryDocument deep copies doc, converting its values to the types
+// produced by the BSON codec.
+func cloneMemoryDocument(doc bson.M) (bson.M, error) {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var clone bson.M
+	err = bson.Unmarshal(data, &clone)
+	return clone, err
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type MemoryTestModel struct {
+	ID       string     `bson:"_id,omitempty" json:"id"`
+	Name     string     `bson:"name" json:"name"`
+	Email    string     `bson:"email,omitempty" json:"email,omitempty"`
+	Age      int        `bson:"age" json:"age"`
+	Tags     []string   `bson:"tags,omitempty" json:"tags,omitempty"`
+	Created  time.Time  `bson:"created" json:"created"`
+	Modified time.Time  `bson:"modified" json:"modified"`
+	Deleted  *time.Time `bson:"deleted,omitempty" json:"deleted,omitempty"`
+}
+
+func (m MemoryTestModel) GetTableName() string     { return "memory_test_models" }
+func (m MemoryTestModel) GetModelName() string     { return "MemoryTestModel" }
+func (m MemoryTestModel) GetConnectorName() string { return "memory" }
+func (m MemoryTestModel) GetId() any               { return m.ID }
+
+func (m *MemoryTestModel) BeforeCreate() error {
+	m.Created = time.Now()
+	m.Modified = time.Now()
+	return nil
+}
+
+func newMemoryTestRepository(t testing.TB, options RepositoryOptions, docs ...MemoryTestModel) Repository[MemoryTestModel] {
+	t.Helper()
+
+	ds := &Datasource{}
+	require.NoError(t, ds.AddConnector(NewMemoryConnector("memory")))
+
+	repo, err := NewInMemoryRepository[MemoryTestModel](ds, options)
+	require.NoError(t, err)
+
+	for _, doc := range docs {
+		_, err := repo.Insert(context.Background(), doc)
+		require.NoError(t, err)
+	}
+
+	return repo
+}
+
+func TestInMemoryRepositorySuite(t *testing.T) {
+	runRepositorySuite(t, func(t testing.TB, options RepositoryOptions, docs ...RepositoryTestModel) Repository[RepositoryTestModel] {
+		t.Helper()
+
+		ds := &Datasource{}
+		require.NoError(t, ds.AddConnector(NewMemoryConnector("test")))
+
+		repo, err := NewInMemoryRepository[RepositoryTestModel](ds, options)
+		require.NoError(t, err)
+
+		for _, doc := range docs {
+			_, err := repo.Insert(context.Background(), doc)
+			require.NoError(t, err)
+		}
+
+		return repo
+	})
+}
+
+func TestInMemoryRepositoryInsert_StringID(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryTestRepository(t, RepositoryOptions{})
+
+	id, err := repo.Insert(ctx, MemoryTestModel{Name: "Test User"})
+	require.NoError(t, err)
+	require.IsType(t, "", id)
+	assert.Len(t, id, 24, "string ids are generated as ObjectID hex strings")
+
+	_, err = repo.Insert(ctx, MemoryTestModel{ID: "custom", Name: "Custom"})
+	require.NoError(t, err)
+
+	doc, err := repo.FindById(ctx, "custom", nil)
+	require.NoError(t, err)
+	require.NotNil(t, doc)
+	assert.Equal(t, "Custom", doc.Name)
+}
+
+func TestInMemoryRepositorySoftDelete_KeepsDocuments(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryTestRepository(t, RepositoryOptions{Deleted: true},
+		MemoryTestModel{ID: "1", Name: "Alice"},
+		MemoryTestModel{ID: "2", Name: "Bob"},
+	)
+
+	require.NoError(t, repo.DeleteById(ctx, "1"))
+
+	// The documents are kept with their deleted date
+	raw := repo.GetConnector().(*MemoryConnector).collection("memory_test_models")
+	require.Len(t, raw.docs, 2)
+	assert.IsType(t, bson.DateTime(0), raw.docs[0]["deleted"])
+	assert.Nil(t, raw.docs[1]["deleted"])
+}
+
+func TestInMemoryRepositoryUnsupportedOperator(t *testing.T) {
+	repo := newMemoryTestRepository(t, RepositoryOptions{}, MemoryTestModel{ID: "1", Name: "Alice"})
+
+	err := repo.UpdateOne(context.Background(), nil, bson.M{"$rename": bson.M{"name": "fullName"}})
+	var httpErr http_errors.ErrorResponse
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, MEMORY_UNSUPPORTED_OPERATOR, httpErr.ErrorCode)
+}
+
+func TestNewInMemoryRepository_ConnectorMismatch(t *testing.T) {
+	ds := &Datasource{}
+	require.NoError(t, ds.AddConnector(&MongoConnector{options: &MongoConnectorOpts{Name: "memory"}}))
+
+	_, err := NewInMemoryRepository[MemoryTestModel](ds, RepositoryOptions{})
+	var httpErr http_errors.ErrorResponse
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, MEMORY_CONNECTOR_TYPE_MISMATCH, httpErr.ErrorCode)
+}
+
+func TestInMemoryRepositoryInclude(t *testing.T) {
+	ctx := context.Background()
+	ds := &Datasource{}
+	require.NoError(t, ds.AddConnector(NewMemoryConnector("memory")))
+
+	owners, err := NewInMemoryRepository[RelOwner](ds, RepositoryOptions{})
+	require.NoError(t, err)
+	devices, err := NewInMemoryRepository[RelDevice](ds, RepositoryOptions{})
+	require.NoError(t, err)
+
+	owner, err := owners.Create(ctx, RelOwner{ID: bson.NewObjectID(), Name: "alice"})
+	require.NoError(t, err)
+	_, err = devices.Insert(ctx, RelDevice{ID: bson.NewObjectID(), Name: "camera", OwnerId: owner.ID})
+	require.NoError(t, err)
+	_, err = devices.Insert(ctx, RelDevice{ID: bson.NewObjectID(), Name: "sensor", OwnerId: bson.NewObjectID()})
+	require.NoError(t, err)
+
+	found, err := owners.FindById(ctx, owner.ID.Hex(), NewFilter().Include("devices", nil))
+	require.NoError(t, err)
+	require.Len(t, found.Devices, 1)
+	assert.Equal(t, "camera", found.Devices[0].Name)
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/go-errors/errors"
 	"github.com/xompass/vsaas-rest/helpers"
@@ -21,6 +22,7 @@ type MongoConnector struct {
 	client       *mongo.Client
 	options      *MongoConnectorOpts
 	indexManager *MongoIndexManager
+	logger       *slog.Logger
 }
 
 /**
@@ -135,3 +137,8 @@ func (receiver *MongoConnector) GetOptions() MongoConnectorOpts {
 func (receiver *MongoConnector) GetIndexManager() *MongoIndexManager {
 	return receiver.indexManager
 }
+
+// SetLogger sets the logger of the index manager. Defaults to slog.Default().
+func (receiver *MongoConnector) SetLogger(logger *slog.Logger) {
+	receiver.logger = logger
+}
@@ -3,7 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"sort"
 	"strings"
 
@@ -46,7 +46,7 @@ func (m *MongoIndexManager) EnsureIndexes(model IModel) error {
 	// First, compare indexes and log warnings
 	warnings, err := m.CompareIndexes(model)
 	if err != nil {
-		log.Printf("Warning: Could not compare indexes for %s: %v", model.GetModelName(), err)
+		m.logger().Warn("Could not compare indexes", "model", model.GetModelName(), "error", err)
 	}
 
 	// Only log if there are new indexes or differences
@@ -57,10 +57,10 @@ func (m *MongoIndexManager) EnsureIndexes(model IModel) error {
 			switch warning.Type {
 			case IndexWarningMissingInDB:
 				hasNewIndexes = true
-				log.Printf("[%s] New index for %s: %s", warning.Type, model.GetModelName(), warning.Message)
+				m.logger().Info("New index", "model", model.GetModelName(), "type", warning.Type, "message", warning.Message)
 			case IndexWarningDifferent:
 				hasDifferences = true
-				log.Printf("[%s] Index difference for %s: %s", warning.Type, model.GetModelName(), warning.Message)
+				m.logger().Warn("Index difference", "model", model.GetModelName(), "type", warning.Type, "message", warning.Message)
 			}
 			// Silently ignore IndexWarningMissingInCode unless there are other changes
 		}
@@ -85,7 +85,7 @@ func (m *MongoIndexManager) EnsureIndexes(model IModel) error {
 
 	// Only log success if there were new indexes or differences
 	if hasNewIndexes || hasDifferences {
-		log.Printf("Successfully ensured %d indexes for %s: %v", len(names), model.GetModelName(), names)
+		m.logger().Info("Ensured indexes", "model", model.GetModelName(), "count", len(names), "indexes", names)
 	}
 
 	return nil
@@ -390,3 +390,7 @@ func (m *MongoIndexManager) compareIndexDetails(defined MongoIndexDefinition, ex
 	sort.Strings(differences)
 	return strings.Join(differences, ", ")
 }
+
+func (m *MongoIndexManager) logger() *slog.Logger {
+	return loggerOrDefault(m.connector.logger)
+}
@@ -114,6 +114,10 @@ func NewMongoRepository[T IModel](ds *Datasource, options RepositoryOptions) (Re
 		return nil, err
 	}
 
+	if err := ds.validateSchemaRelations(schema, false); err != nil {
+		return nil, err
+	}
+
 	tmp, err := ds.GetModelConnector(instance)
 	if err != nil {
 		return nil, err
@@ -152,6 +156,11 @@ func NewMongoRepository[T IModel](ds *Datasource, options RepositoryOptions) (Re
 	return repository, nil
 }
 
+// startOperation starts the span of an operation, see the package function
+func (repository *MongoRepository[T]) startOperation(ctx context.Context, operation string, filterBuilder *FilterBuilder) (context.Context, func(err *error)) {
+	return startOperation(ctx, repository.datasource, repository.schema.Name, repository.collection.Name(), operation, filterBuilder)
+}
+
 func (repository *MongoRepository[T]) GetCollection() *mongo.Collection {
 	return repository.collection
 }
@@ -164,11 +173,14 @@ func (repository *MongoRepository[T]) GetConnector() Connector {
 	return repository.connector
 }
 
-func (repository *MongoRepository[T]) Find(ctx context.Context, filterBuilder *FilterBuilder) ([]T, error) {
+func (repository *MongoRepository[T]) Find(ctx context.Context, filterBuilder *FilterBuilder) (_ []T, err error) {
+	ctx, end := repository.startOperation(ctx, "find", filterBuilder)
+	defer end(&err)
+
 	if filterBuilder == nil {
 		filterBuilder = NewFilter()
 	}
-	query, parsedFilter, _, err := repository.buildQuery(*filterBuilder)
+	query, parsedFilter, lbFilter, err := repository.buildQuery(*filterBuilder)
 	if err != nil {
 		return nil, err
 	}
@@ -203,10 +215,18 @@ func (repository *MongoRepository[T]) Find(ctx context.Context, filterBuilder *F
 	if receiver == nil {
 		return []T{}, nil
 	}
+
+	if err := repository.resolveIncludes(ctx, receiver, lbFilter.Include); err != nil {
+		return nil, err
+	}
+
 	return receiver, nil
 }
 
-func (repository *MongoRepository[T]) FindOne(ctx context.Context, filterBuilder *FilterBuilder) (*T, error) {
+func (repository *MongoRepository[T]) FindOne(ctx context.Context, filterBuilder *FilterBuilder) (_ *T, err error) {
+	ctx, end := repository.startOperation(ctx, "findOne", filterBuilder)
+	defer end(&err)
+
 	if filterBuilder == nil {
 		filterBuilder = NewFilter()
 	}
@@ -248,9 +268,13 @@ func (repository *MongoRepository[T]) FindOne(ctx context.Context, filterBuilder
 	}
 
 	// Resolve includes if any
-	repository.resolveIncludes(ctx, receiver, lbFilter.Include)
+	docs := []T{*receiver}
+	if err := repository.resolveIncludes(ctx, docs, lbFilter.Include); err != nil {
+		return nil, err
+	}
+	*receiver = docs[0]
 
-	return receiver, err
+	return receiver, nil
 }
 
 func (repository *MongoRepository[T]) FindById(ctx context.Context, id any, filterBuilder *FilterBuilder) (*T, error) {
@@ -271,14 +295,17 @@ func (repository *MongoRepository[T]) FindById(ctx context.Context, id any, filt
 	return repository.FindOne(ctx, filterClone)
 }
 
-func (repository *MongoRepository[T]) Insert(ctx context.Context, doc T) (any, error) {
+func (repository *MongoRepository[T]) Insert(ctx context.Context, doc T) (_ any, err error) {
+	ctx, end := repository.startOperation(ctx, "insert", nil)
+	defer end(&err)
+
 	if hook, ok := any(&doc).(BeforeCreateHook); ok {
 		if err := hook.BeforeCreate(); err != nil {
 			return nil, err
 		}
 	}
 
-	document, err := repository.prepareInsertDocument(doc)
+	document, err := repository.Options.prepareInsertDocument(doc)
 	if err != nil {
 		return nil, err
 	}
@@ -301,7 +328,10 @@ func (repository *MongoRepository[T]) Create(ctx context.Context, doc T) (*T, er
 	return repository.FindById(ctx, insertedID, NewFilter())
 }
 
-func (repository *MongoRepository[T]) FindOneOrCreate(ctx context.Context, filterBuilder *FilterBuilder, doc T) (*T, error) {
+func (repository *MongoRepository[T]) FindOneOrCreate(ctx context.Context, filterBuilder *FilterBuilder, doc T) (_ *T, err error) {
+	ctx, end := repository.startOperation(ctx, "findOneOrCreate", filterBuilder)
+	defer end(&err)
+
 	if filterBuilder == nil {
 		filterBuilder = NewFilter()
 	}
@@ -314,7 +344,10 @@ func (repository *MongoRepository[T]) FindOneOrCreate(ctx context.Context, filte
 	}, &options.FindOneAndUpdateOptions{Upsert: &upsert, ReturnDocument: &after})
 }
 
-func (repository *MongoRepository[T]) Upsert(ctx context.Context, filterBuilder *FilterBuilder, update any) error {
+func (repository *MongoRepository[T]) Upsert(ctx context.Context, filterBuilder *FilterBuilder, update any) (err error) {
+	ctx, end := repository.startOperation(ctx, "upsert", filterBuilder)
+	defer end(&err)
+
 	if update == nil {
 		return http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
 	}
@@ -328,7 +361,7 @@ func (repository *MongoRepository[T]) Upsert(ctx context.Context, filterBuilder
 	}
 
 	upsert := true
-	fixedUpdate, err := repository.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{})
+	fixedUpdate, err := repository.Options.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{})
 	if err != nil {
 		return err
 	}
@@ -336,15 +369,20 @@ func (repository *MongoRepository[T]) Upsert(ctx context.Context, filterBuilder
 	updateOptions := options.UpdateOne()
 	updateOptions.SetUpsert(upsert)
 
-	_, err = repository.collection.UpdateOne(ctx, query, fixedUpdate, updateOptions)
-	if err != nil {
-		return mapMongoError(err)
-	}
+	return recordChange(ctx, repository, filterBuilder, ChangeUpdate, func() error {
+		_, err := repository.collection.UpdateOne(ctx, query, fixedUpdate, updateOptions)
+		if err != nil {
+			return mapMongoError(err)
+		}
 
-	return nil
+		return nil
+	})
 }
 
-func (repository *MongoRepository[T]) UpdateOne(ctx context.Context, filterBuilder *FilterBuilder, update any) error {
+func (repository *MongoRepository[T]) UpdateOne(ctx context.Context, filterBuilder *FilterBuilder, update any) (err error) {
+	ctx, end := repository.startOperation(ctx, "updateOne", filterBuilder)
+	defer end(&err)
+
 	if update == nil {
 		return http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
 	}
@@ -353,22 +391,24 @@ func (repository *MongoRepository[T]) UpdateOne(ctx context.Context, filterBuild
 		filterBuilder = NewFilter()
 	}
 
-	query, _, _, err := repository.buildQuery(*filterBuilder)
-	if err != nil {
-		return err
-	}
+	return recordChange(ctx, repository, filterBuilder, ChangeUpdate, func() error {
+		query, _, _, err := repository.buildQuery(*filterBuilder)
+		if err != nil {
+			return err
+		}
 
-	fixedUpdate, err := repository.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{})
-	if err != nil {
-		return mapMongoError(err)
-	}
+		fixedUpdate, err := repository.Options.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{})
+		if err != nil {
+			return mapMongoError(err)
+		}
 
-	_, err = repository.collection.UpdateOne(ctx, query, fixedUpdate)
-	if err != nil {
-		return mapMongoError(err)
-	}
+		_, err = repository.collection.UpdateOne(ctx, query, fixedUpdate)
+		if err != nil {
+			return mapMongoError(err)
+		}
 
-	return nil
+		return nil
+	})
 }
 
 func (repository *MongoRepository[T]) UpdateById(ctx context.Context, id any, update any) error {
@@ -385,8 +425,17 @@ func (repository *MongoRepository[T]) UpdateById(ctx context.Context, id any, up
 	return repository.UpdateOne(ctx, filter, update)
 }
 
-func (repository *MongoRepository[T]) FindOneAndUpdate(ctx context.Context, filterBuilder *FilterBuilder, update any) (*T, error) {
-	return repository.applyFindOneAndUpdate(ctx, filterBuilder, update)
+func (repository *MongoRepository[T]) FindOneAndUpdate(ctx context.Context, filterBuilder *FilterBuilder, update any) (_ *T, err error) {
+	ctx, end := repository.startOperation(ctx, "findOneAndUpdate", filterBuilder)
+	defer end(&err)
+
+	var result *T
+	err = recordChange(ctx, repository, filterBuilder, ChangeUpdate, func() error {
+		var err error
+		result, err = repository.applyFindOneAndUpdate(ctx, filterBuilder, update)
+		return err
+	})
+	return result, err
 }
 
 func (repository *MongoRepository[T]) applyFindOneAndUpdate(ctx context.Context, filterBuilder *FilterBuilder, update any, opts ...*options.FindOneAndUpdateOptions) (*T, error) {
@@ -418,7 +467,7 @@ func (repository *MongoRepository[T]) applyFindOneAndUpdate(ctx context.Context,
 		updateOptions.ReturnDocument = &afterUpdate
 	}
 
-	fixedUpdate, err := repository.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{Insert: setCreated})
+	fixedUpdate, err := repository.Options.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{Insert: setCreated})
 
 	if err != nil {
 		return nil, err
@@ -474,7 +523,10 @@ func (repository *MongoRepository[T]) applyFindOneAndUpdate(ctx context.Context,
 	return receiver, nil
 }
 
-func (repository *MongoRepository[T]) UpdateMany(ctx context.Context, filterBuilder *FilterBuilder, update any) (int64, error) {
+func (repository *MongoRepository[T]) UpdateMany(ctx context.Context, filterBuilder *FilterBuilder, update any) (_ int64, err error) {
+	ctx, end := repository.startOperation(ctx, "updateMany", filterBuilder)
+	defer end(&err)
+
 	if update == nil {
 		return 0, http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
 	}
@@ -488,20 +540,25 @@ func (repository *MongoRepository[T]) UpdateMany(ctx context.Context, filterBuil
 		return 0, err
 	}
 
-	fixedUpdate, err := repository.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{})
+	fixedUpdate, err := repository.Options.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{})
 	if err != nil {
 		return 0, mapMongoError(err)
 	}
 
-	result, err := repository.collection.UpdateMany(ctx, query, fixedUpdate)
-	if err != nil {
-		return 0, mapMongoError(err)
-	}
+	return recordChanges(ctx, repository, filterBuilder, ChangeUpdate, func() (int64, error) {
+		result, err := repository.collection.UpdateMany(ctx, query, fixedUpdate)
+		if err != nil {
+			return 0, mapMongoError(err)
+		}
 
-	return result.ModifiedCount, nil
+		return result.ModifiedCount, nil
+	})
 }
 
-func (repository *MongoRepository[T]) Count(ctx context.Context, filterBuilder *FilterBuilder) (int64, error) {
+func (repository *MongoRepository[T]) Count(ctx context.Context, filterBuilder *FilterBuilder) (_ int64, err error) {
+	ctx, end := repository.startOperation(ctx, "count", filterBuilder)
+	defer end(&err)
+
 	if filterBuilder == nil {
 		filterBuilder = NewFilter()
 	}
@@ -540,11 +597,20 @@ func (repository *MongoRepository[T]) Exists(ctx context.Context, id any) (bool,
 	return false, nil
 }
 
-func (repository *MongoRepository[T]) DeleteOne(ctx context.Context, filterBuilder *FilterBuilder) error {
+func (repository *MongoRepository[T]) DeleteOne(ctx context.Context, filterBuilder *FilterBuilder) (err error) {
+	ctx, end := repository.startOperation(ctx, "deleteOne", filterBuilder)
+	defer end(&err)
+
 	if filterBuilder == nil {
 		filterBuilder = NewFilter()
 	}
 
+	return recordChange(ctx, repository, filterBuilder, ChangeDelete, func() error {
+		return repository.deleteOne(ctx, filterBuilder)
+	})
+}
+
+func (repository *MongoRepository[T]) deleteOne(ctx context.Context, filterBuilder *FilterBuilder) error {
 	query, _, _, err := repository.buildQuery(*filterBuilder)
 	if err != nil {
 		return err
@@ -583,7 +649,10 @@ func (repository *MongoRepository[T]) DeleteById(ctx context.Context, id any) er
 	return repository.DeleteOne(ctx, filterBuilder)
 }
 
-func (repository *MongoRepository[T]) DeleteMany(ctx context.Context, filterBuilder *FilterBuilder) (int64, error) {
+func (repository *MongoRepository[T]) DeleteMany(ctx context.Context, filterBuilder *FilterBuilder) (_ int64, err error) {
+	ctx, end := repository.startOperation(ctx, "deleteMany", filterBuilder)
+	defer end(&err)
+
 	if filterBuilder == nil {
 		filterBuilder = NewFilter()
 	}
@@ -593,18 +662,20 @@ func (repository *MongoRepository[T]) DeleteMany(ctx context.Context, filterBuil
 		return 0, err
 	}
 
-	if repository.Options.Deleted {
-		result, err := repository.collection.UpdateMany(ctx, query, bson.M{CURRENT_DATE: bson.M{DELETED: true}})
+	return recordChanges(ctx, repository, filterBuilder, ChangeDelete, func() (int64, error) {
+		if repository.Options.Deleted {
+			result, err := repository.collection.UpdateMany(ctx, query, bson.M{CURRENT_DATE: bson.M{DELETED: true}})
+			if err != nil {
+				return 0, mapMongoError(err)
+			}
+			return result.ModifiedCount, nil
+		}
+
+		result, err := repository.collection.DeleteMany(ctx, query)
 		if err != nil {
 			return 0, mapMongoError(err)
 		}
-		return result.ModifiedCount, nil
-	}
-
-	result, err := repository.collection.DeleteMany(ctx, query)
-	if err != nil {
-		return 0, mapMongoError(err)
-	}
 
-	return result.DeletedCount, nil
+		return result.DeletedCount, nil
+	})
 }
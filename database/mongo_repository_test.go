@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"os"
 	"testing"
 	"time"
 
@@ -244,6 +245,49 @@ func (m *MockMongoRepository) Exists(ctx context.Context, id any) (bool, error)
 }
 
 // Test Suite
+// TestMongoRepositorySuite runs the shared repository suite against a real
+// MongoDB server. It is skipped unless MONGO_TEST_URI is set.
+func TestMongoRepositorySuite(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	opts := MongoConnectorOpts{
+		ClientOptions: *options.Client().ApplyURI(uri),
+		Name:          "test",
+		Database:      fmt.Sprintf("vsaas_rest_test_%d", time.Now().UnixNano()),
+	}
+	connector, err := NewMongoConnector(&opts)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	db := connector.client.Database(opts.Database)
+	t.Cleanup(func() {
+		_ = db.Drop(ctx)
+		_ = connector.Disconnect()
+	})
+
+	runRepositorySuite(t, func(t testing.TB, options RepositoryOptions, docs ...RepositoryTestModel) Repository[RepositoryTestModel] {
+		t.Helper()
+
+		require.NoError(t, db.Collection(RepositoryTestModel{}.GetTableName()).Drop(ctx))
+
+		ds := &Datasource{}
+		require.NoError(t, ds.AddConnector(connector))
+
+		repo, err := NewMongoRepository[RepositoryTestModel](ds, options)
+		require.NoError(t, err)
+
+		for _, doc := range docs {
+			_, err := repo.Insert(ctx, doc)
+			require.NoError(t, err)
+		}
+
+		return repo
+	})
+}
+
 func TestMongoRepositoryFind(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// OperationObserver is notified of every database operation of the
+// repositories of a datasource, e.g. to export latency and error metrics.
+// operation is the repository method, like "find", "updateOne" or "deleteMany";
+// err is the error returned by the method, if any.
+type OperationObserver func(ctx context.Context, model string, operation string, duration time.Duration, err error)
+
+// SetOperationObserver sets the observer of the operations of the
+// repositories of the datasource. MongoRepository reports its operations.
+func (receiver *Datasource) SetOperationObserver(observer OperationObserver) {
+	if receiver == nil {
+		return
+	}
+	receiver.operationObserver = observer
+}
+
+// startOperation starts the span of an operation of model and returns its
+// context, along with the function that ends the span and reports the
+// operation to the observer of ds. The repository methods defer that function
+// with a pointer to their returned error.
+func startOperation(ctx context.Context, ds *Datasource, model string, collection string, operation string, filter *FilterBuilder) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, ds, model, collection, operation, filter)
+
+	return ctx, func(err *error) {
+		endSpan(span, *err)
+		if ds != nil && ds.operationObserver != nil {
+			ds.operationObserver(ctx, model, operation, time.Since(start), *err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package database
+
+// PostgresIndexDefinition represents a PostgreSQL index. Field names are the
+// column names, i.e. the BSON names of the model fields.
+type PostgresIndexDefinition struct {
+	IndexDefinition
+
+	// PostgreSQL-specific options
+	Method PostgresIndexMethod // Access method, defaults to btree
+	Where  string              // Predicate of a partial index, in SQL
+}
+
+// PostgresIndexMethod represents a PostgreSQL index access method
+type PostgresIndexMethod string
+
+const (
+	PostgresIndexMethodBTree PostgresIndexMethod = "btree" // Default, supports ordering
+	PostgresIndexMethodHash  PostgresIndexMethod = "hash"  // Equality only
+	PostgresIndexMethodGIN   PostgresIndexMethod = "gin"   // jsonb containment, arrays
+	PostgresIndexMethodGiST  PostgresIndexMethod = "gist"  // Geometric and range types
+	PostgresIndexMethodBRIN  PostgresIndexMethod = "brin"  // Large, naturally ordered tables
+)
+
+// Helper constructors for common PostgreSQL index types
+
+// NewPostgresSimpleIndex creates a simple ascending index on a single column
+func NewPostgresSimpleIndex(fieldName string, unique bool) PostgresIndexDefinition {
+	return PostgresIndexDefinition{
+		IndexDefinition: IndexDefinition{
+			Name:   fieldName + "_1",
+			Fields: []IndexField{{Name: fieldName, Order: 1}},
+			Unique: unique,
+		},
+	}
+}
+
+// NewPostgresCompoundIndex creates an index on multiple columns
+func NewPostgresCompoundIndex(name string, fields []IndexField, unique bool) PostgresIndexDefinition {
+	return PostgresIndexDefinition{
+		IndexDefinition: IndexDefinition{
+			Name:   name,
+			Fields: fields,
+			Unique: unique,
+		},
+	}
+}
+
+// NewPostgresGINIndex creates a GIN index on a jsonb column, used by equality
+// filters on slices and maps
+func NewPostgresGINIndex(fieldName string) PostgresIndexDefinition {
+	return PostgresIndexDefinition{
+		IndexDefinition: IndexDefinition{
+			Name:   fieldName + "_gin",
+			Fields: []IndexField{{Name: fieldName, Order: 1}},
+		},
+		Method: PostgresIndexMethodGIN,
+	}
+}
+
+// WithMethod sets the index access method
+func (idx PostgresIndexDefinition) WithMethod(method PostgresIndexMethod) PostgresIndexDefinition {
+	idx.Method = method
+	return idx
+}
+
+// WithWhere makes the index partial. The predicate is written in SQL, e.g.
+// `"deleted" IS NULL`, and must only come from code
+func (idx PostgresIndexDefinition) WithWhere(predicate string) PostgresIndexDefinition {
+	idx.Where = predicate
+	return idx
+}
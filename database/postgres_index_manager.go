@@ -0,0 +1,299 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// PostgresIndexManager manages indexes for PostgreSQL tables. Index names are
+// unique per schema in PostgreSQL, so the name of each index is prefixed with
+// its table name, e.g. the index "email_1" of table "users" is "users_email_1".
+type PostgresIndexManager struct {
+	connector *PostgresConnector
+	ctx       context.Context
+}
+
+// postgresIndex is an index read from the PostgreSQL catalog
+type postgresIndex struct {
+	Name    string
+	Unique  bool
+	Method  string
+	Columns []IndexField
+}
+
+// NewPostgresIndexManager creates a new PostgreSQL index manager
+func NewPostgresIndexManager(connector *PostgresConnector) *PostgresIndexManager {
+	return &PostgresIndexManager{
+		connector: connector,
+		ctx:       context.Background(),
+	}
+}
+
+// EnsureIndexes creates the indexes defined in the model
+func (m *PostgresIndexManager) EnsureIndexes(model IModel) error {
+	// Check if model implements PostgresIndexableModel
+	indexableModel, ok := model.(PostgresIndexableModel)
+	if !ok {
+		// Model doesn't define indexes, skip
+		return nil
+	}
+
+	indexes := indexableModel.DefinePostgresIndexes()
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	// First, compare indexes and log warnings
+	warnings, err := m.CompareIndexes(model)
+	if err != nil {
+		m.logger().Warn("Could not compare indexes", "model", model.GetModelName(), "error", err)
+	}
+
+	for _, warning := range warnings {
+		switch warning.Type {
+		case IndexWarningMissingInDB:
+			m.logger().Info("New index", "model", model.GetModelName(), "type", warning.Type, "message", warning.Message)
+		case IndexWarningDifferent:
+			m.logger().Warn("Index difference", "model", model.GetModelName(), "type", warning.Type, "message", warning.Message)
+		}
+		// Silently ignore IndexWarningMissingInCode
+	}
+
+	// Existing indexes are kept as they are, CREATE INDEX IF NOT EXISTS does not
+	// replace an index with a different definition
+	for _, idx := range indexes {
+		statement, err := m.createIndexStatement(model, idx)
+		if err != nil {
+			return errors.Errorf("failed to convert index %s: %v", idx.Name, err)
+		}
+
+		if _, err := m.connector.db.ExecContext(m.ctx, statement); err != nil {
+			return errors.Errorf("failed to create index %s for %s: %v", idx.Name, model.GetModelName(), err)
+		}
+	}
+
+	return nil
+}
+
+// ListIndexes returns all index names for a model's table, without its
+// primary key
+func (m *PostgresIndexManager) ListIndexes(model IModel) ([]string, error) {
+	existing, err := m.existingIndexes(model)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]string, 0, len(existing))
+	for name := range existing {
+		indexes = append(indexes, name)
+	}
+	sort.Strings(indexes)
+
+	return indexes, nil
+}
+
+// CompareIndexes compares defined indexes with existing ones
+func (m *PostgresIndexManager) CompareIndexes(model IModel) ([]IndexWarning, error) {
+	indexableModel, ok := model.(PostgresIndexableModel)
+	if !ok {
+		return nil, nil
+	}
+
+	definedIndexes := indexableModel.DefinePostgresIndexes()
+	existingIndexes, err := m.existingIndexes(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []IndexWarning
+	definedIndexMap := make(map[string]PostgresIndexDefinition)
+	for _, idx := range definedIndexes {
+		definedIndexMap[m.indexName(model, idx)] = idx
+	}
+
+	// Check for indexes in DB but not in code
+	for name, dbIndex := range existingIndexes {
+		if _, exists := definedIndexMap[name]; !exists {
+			warnings = append(warnings, IndexWarning{
+				Type:    IndexWarningMissingInCode,
+				Message: fmt.Sprintf("Index '%s' exists in database but is not defined in code", name),
+				Details: map[string]any{
+					"indexName": name,
+					"dbIndex":   dbIndex,
+				},
+			})
+		}
+	}
+
+	// Check for indexes in code but not in DB
+	for _, idx := range definedIndexes {
+		name := m.indexName(model, idx)
+		dbIndex, exists := existingIndexes[name]
+		if !exists {
+			warnings = append(warnings, IndexWarning{
+				Type:    IndexWarningMissingInDB,
+				Message: fmt.Sprintf("Index '%s' is defined in code but does not exist in database", name),
+				Details: map[string]any{
+					"indexName":  name,
+					"definition": idx,
+				},
+			})
+			continue
+		}
+
+		if diff := m.compareIndexDetails(idx, dbIndex); diff != "" {
+			warnings = append(warnings, IndexWarning{
+				Type:    IndexWarningDifferent,
+				Message: fmt.Sprintf("Index '%s' differs: %s", name, diff),
+				Details: map[string]any{
+					"indexName":  name,
+					"difference": diff,
+					"defined":    idx,
+					"existing":   dbIndex,
+				},
+			})
+		}
+	}
+
+	return warnings, nil
+}
+
+// indexName returns the name of idx in the database
+func (m *PostgresIndexManager) indexName(model IModel, idx PostgresIndexDefinition) string {
+	return model.GetTableName() + "_" + idx.Name
+}
+
+// createIndexStatement converts idx to a CREATE INDEX statement
+func (m *PostgresIndexManager) createIndexStatement(model IModel, idx PostgresIndexDefinition) (string, error) {
+	if len(idx.Fields) == 0 {
+		return "", errors.New("the index has no fields")
+	}
+
+	method := idx.Method
+	if method == "" {
+		method = PostgresIndexMethodBTree
+	}
+
+	columns := make([]string, 0, len(idx.Fields))
+	for _, field := range idx.Fields {
+		column := quoteSQLIdentifier(field.Name)
+		if field.Order < 0 {
+			column += " DESC"
+		}
+		columns = append(columns, column)
+	}
+
+	statement := "CREATE "
+	if idx.Unique {
+		statement += "UNIQUE "
+	}
+	statement += "INDEX IF NOT EXISTS " + quoteSQLIdentifier(m.indexName(model, idx)) +
+		" ON " + m.connector.tableName(model) +
+		" USING " + string(method) + " (" + strings.Join(columns, ", ") + ")"
+	if idx.Where != "" {
+		statement += " WHERE " + idx.Where
+	}
+
+	return statement, nil
+}
+
+// existingIndexes reads the indexes of the model table from the catalog
+func (m *PostgresIndexManager) existingIndexes(model IModel) (map[string]postgresIndex, error) {
+	const statement = `SELECT i.relname, ix.indisunique, am.amname,
+	(SELECT string_agg(CASE WHEN (ix.indoption[k.ord - 1] & 1) = 1 THEN '-' ELSE '' END || a.attname, ',' ORDER BY k.ord)
+		FROM unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum)
+FROM pg_index ix
+JOIN pg_class t ON t.oid = ix.indrelid
+JOIN pg_class i ON i.oid = ix.indexrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_am am ON am.oid = i.relam
+WHERE n.nspname = $1 AND t.relname = $2 AND NOT ix.indisprimary`
+
+	rows, err := m.connector.db.QueryContext(m.ctx, statement, m.connector.options.Schema, model.GetTableName())
+	if err != nil {
+		return nil, errors.Errorf("failed to list indexes: %v", err)
+	}
+	defer rows.Close()
+
+	indexes := make(map[string]postgresIndex)
+	for rows.Next() {
+		var index postgresIndex
+		var columns *string
+		if err := rows.Scan(&index.Name, &index.Unique, &index.Method, &columns); err != nil {
+			return nil, errors.Errorf("failed to decode index: %v", err)
+		}
+
+		if columns != nil {
+			index.Columns = parsePostgresIndexColumns(*columns)
+		}
+		indexes[index.Name] = index
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("rows error: %v", err)
+	}
+
+	return indexes, nil
+}
+
+// parsePostgresIndexColumns parses the columns listed by existingIndexes,
+// where descending columns are prefixed with "-"
+func parsePostgresIndexColumns(columns string) []IndexField {
+	var fields []IndexField
+	for _, column := range strings.Split(columns, ",") {
+		if name, descending := strings.CutPrefix(column, "-"); descending {
+			fields = append(fields, IndexField{Name: name, Order: -1})
+			continue
+		}
+		fields = append(fields, IndexField{Name: column, Order: 1})
+	}
+	return fields
+}
+
+// compareIndexDetails compares the details of a defined index vs existing one
+func (m *PostgresIndexManager) compareIndexDetails(defined PostgresIndexDefinition, existing postgresIndex) string {
+	var differences []string
+
+	if len(existing.Columns) != len(defined.Fields) {
+		differences = append(differences, "different number of fields")
+	} else {
+		for i, field := range defined.Fields {
+			order := 1
+			if field.Order < 0 {
+				order = -1
+			}
+			if existing.Columns[i].Name != field.Name || existing.Columns[i].Order != order {
+				differences = append(differences, fmt.Sprintf("field '%s' order mismatch", field.Name))
+			}
+		}
+	}
+
+	if existing.Unique != defined.Unique {
+		differences = append(differences, "unique constraint differs")
+	}
+
+	method := defined.Method
+	if method == "" {
+		method = PostgresIndexMethodBTree
+	}
+	if existing.Method != string(method) {
+		differences = append(differences, "method differs")
+	}
+
+	if len(differences) == 0 {
+		return ""
+	}
+
+	sort.Strings(differences)
+	return strings.Join(differences, ", ")
+}
+
+func (m *PostgresIndexManager) logger() *slog.Logger {
+	return loggerOrDefault(m.connector.logger)
+}
@@ -2,19 +2,799 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-errors/errors"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"github.com/xompass/vsaas-rest/lbq"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Error codes for relations
+const (
+	RELATION_NOT_FOUND        = "RELATION_NOT_FOUND"
+	RELATION_TARGET_NOT_FOUND = "RELATION_TARGET_NOT_FOUND"
+	RELATION_INVALID_KEY      = "RELATION_INVALID_KEY"
 )
 
+// IRelation is a relation between a model and a target model that can be
+// resolved through filter includes.
 type IRelation interface {
-	ResolveForMany(ctx context.Context, ds *Datasource, docs []IModel) (any, error) // Resolve the relation for multiple documents
-	ResolveForOne(ctx context.Context, ds *Datasource, doc IModel) (any, error)     // Resolve the relation for a single document
-	Set(value any) error                                                            // Set the value of the relation
-	validate() error                                                                // Validate the relation configuration
+	GetName() string       // Relation name used in filter includes
+	GetType() RelationType // Relation type, e.g. hasMany
+	GetFieldName() string  // Go struct field that holds the related data
+	GetTargetModel() IModel
+
+	// ResolveForMany populates the relation field of every document in docs,
+	// which must be a slice of models.
+	ResolveForMany(ctx context.Context, ds *Datasource, docs any, scope *lbq.Filter) error
+
+	// ResolveForOne populates the relation field of doc, which must be a pointer to a model.
+	ResolveForOne(ctx context.Context, ds *Datasource, doc any, scope *lbq.Filter) error
+
+	init(schema *Schema) error // Bind the relation to the schema of the model that declares it
+	validate() error           // Validate the relation configuration
+	keyFields() []string       // JSON fields of the model needed to resolve the relation
+	relatedModels() []IModel   // Models that must be registered in the datasource
+}
+
+// RelatableModel defines models that declare their relations explicitly.
+// Relation fields not declared here are inferred from the struct.
+type RelatableModel interface {
+	DefineRelations() []IRelation
+}
+
+// relatedFinder is implemented by repositories so includes can be resolved
+// without knowing the Go type of the related model.
+type relatedFinder interface {
+	GetSchema() *Schema
+
+	// findRelated returns a slice with the documents whose foreignKey matches
+	// any of the keys, filtered and ordered by the include scope.
+	findRelated(ctx context.Context, foreignKey string, keys []any, scope *lbq.Filter) (reflect.Value, error)
+}
+
+// resolveIncludes populates the relation fields of docs, a slice of models
+// described by schema. Each include runs a single query against the related
+// repository; nested includes are resolved by that repository.
+func resolveIncludes(ctx context.Context, ds *Datasource, schema *Schema, docs reflect.Value, includes []lbq.Include) error {
+	if len(includes) == 0 || docs.Len() == 0 {
+		return nil
+	}
+
+	for _, include := range includes {
+		relation, ok := schema.GetRelation(include.Relation)
+		if !ok {
+			return http_errors.BadRequestErrorWithCode(RELATION_NOT_FOUND,
+				fmt.Sprintf("relation %s is not defined for model %s", include.Relation, schema.Name))
+		}
+
+		if err := relation.ResolveForMany(ctx, ds, docs.Interface(), include.Scope); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/************************
+ * Key based relations
+ ************************/
+
+func (r *Relation) GetName() string         { return r.JsonName }
+func (r *Relation) GetType() RelationType   { return r.RelationType }
+func (r *Relation) GetFieldName() string    { return r.FieldName }
+func (r *Relation) GetTargetModel() IModel  { return r.TargetModel }
+func (r *Relation) keyFields() []string     { return []string{r.Key} }
+func (r *Relation) relatedModels() []IModel { return []IModel{r.TargetModel} }
+
+func (r *Relation) init(schema *Schema) error {
+	r.schema = schema
+	return nil
+}
+
+func (r *Relation) validate() error {
+	if r.TargetModel == nil {
+		return errors.Errorf("relation %s of model %s has no target model", r.JsonName, r.schema.Name)
+	}
+
+	if err := validateRelationField(r.schema, r.JsonName, r.FieldName, r.IsList); err != nil {
+		return err
+	}
+
+	if _, ok := r.schema.JSONFields[r.Key]; !ok {
+		return errors.Errorf("relation %s of model %s uses unknown key %s", r.JsonName, r.schema.Name, r.Key)
+	}
+
+	target := NewSchema(r.TargetModel)
+	if _, ok := target.JSONFields[r.ForeignKey]; !ok {
+		return errors.Errorf("relation %s of model %s uses unknown foreign key %s in model %s", r.JsonName, r.schema.Name, r.ForeignKey, target.Name)
+	}
+
+	return nil
 }
 
+func (r *Relation) ResolveForMany(ctx context.Context, ds *Datasource, docs any, scope *lbq.Filter) error {
+	docsValue := reflect.ValueOf(docs)
+	if docsValue.Len() == 0 {
+		return nil
+	}
+
+	finder, err := ds.getRelatedFinder(r.TargetModel.GetModelName())
+	if err != nil {
+		return err
+	}
+
+	keyField, ok := r.schema.JSONFields[r.Key]
+	if !ok {
+		return http_errors.InternalServerErrorWithCode(RELATION_INVALID_KEY,
+			fmt.Sprintf("relation %s of model %s uses unknown key %s", r.JsonName, r.schema.Name, r.Key))
+	}
+
+	foreignKeyField, ok := finder.GetSchema().JSONFields[r.ForeignKey]
+	if !ok {
+		return http_errors.InternalServerErrorWithCode(RELATION_INVALID_KEY,
+			fmt.Sprintf("relation %s of model %s uses unknown foreign key %s", r.JsonName, r.schema.Name, r.ForeignKey))
+	}
+
+	keys := collectRelationKeys(docsValue, keyField.FieldName)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	related, err := finder.findRelated(ctx, r.ForeignKey, keys, relationQueryScope(scope, r.ForeignKey, finder.GetSchema()))
+	if err != nil {
+		return err
+	}
+
+	grouped := groupRelated(related, foreignKeyField.FieldName)
+	for i := range docsValue.Len() {
+		doc := reflect.Indirect(docsValue.Index(i))
+		value, ok := relationFieldValue(doc, keyField.FieldName)
+		if !ok {
+			continue
+		}
+
+		items := grouped[normalizeRelationKey(value)]
+		if r.IsList {
+			items = paginateRelated(items, scope)
+		}
+
+		setRelationField(doc.FieldByName(r.FieldName), items, r.IsList)
+	}
+
+	return nil
+}
+
+func (r *Relation) ResolveForOne(ctx context.Context, ds *Datasource, doc any, scope *lbq.Filter) error {
+	return resolveForOne(ctx, ds, r, doc, scope)
+}
+
+// keyedRelation lets the declarative relations embed Relation without
+// exposing it as a public field.
+type keyedRelation = Relation
+
+// RelationHasOne links a model to a single target document whose ForeignKey matches Key.
 type RelationHasOne struct {
-	Model       IModel   // Model for the relation
-	Key         []string // Keys for the relation, e.g. ["userId", "userType"]
-	TargetModel IModel   // Target model for the relation
-	ForeignKey  []string // Keys in the target model that point to the source model, e.g. ["id", "type"]
-	Set         func(any) error
+	Name        string // Relation name used in filter includes
+	Field       string // Go struct field that receives the related document. Defaults to the field whose json name is Name
+	TargetModel IModel // Related model
+	Key         string // JSON field in this model. Defaults to "id"
+	ForeignKey  string // JSON field in the target model pointing to this model. Defaults to <modelName>Id
+	keyedRelation
+}
+
+func (r *RelationHasOne) init(schema *Schema) error {
+	return r.keyedRelation.bind(schema, RelationTypeHasOne, r.Name, r.Field, r.TargetModel, r.Key, r.ForeignKey)
+}
+
+// RelationHasMany links a model to the target documents whose ForeignKey matches Key.
+type RelationHasMany struct {
+	Name        string // Relation name used in filter includes
+	Field       string // Go struct field that receives the related documents. Defaults to the field whose json name is Name
+	TargetModel IModel // Related model
+	Key         string // JSON field in this model. Defaults to "id"
+	ForeignKey  string // JSON field in the target model pointing to this model. Defaults to <modelName>Id
+	keyedRelation
+}
+
+func (r *RelationHasMany) init(schema *Schema) error {
+	return r.keyedRelation.bind(schema, RelationTypeHasMany, r.Name, r.Field, r.TargetModel, r.Key, r.ForeignKey)
+}
+
+// RelationBelongsTo links a model to the target document referenced by Key.
+type RelationBelongsTo struct {
+	Name        string // Relation name used in filter includes
+	Field       string // Go struct field that receives the related document. Defaults to the field whose json name is Name
+	TargetModel IModel // Related model
+	Key         string // JSON field in this model referencing the target. Defaults to <name>Id
+	ForeignKey  string // JSON field in the target model. Defaults to "id"
+	keyedRelation
+}
+
+func (r *RelationBelongsTo) init(schema *Schema) error {
+	return r.keyedRelation.bind(schema, RelationTypeBelongsTo, r.Name, r.Field, r.TargetModel, r.Key, r.ForeignKey)
+}
+
+// bind fills the relation from a declarative definition, applying the LoopBack defaults
+func (r *Relation) bind(schema *Schema, relationType RelationType, name string, fieldName string, target IModel, key string, foreignKey string) error {
+	field, err := findRelationField(schema, name, fieldName)
+	if err != nil {
+		return err
+	}
+
+	*r = Relation{
+		FieldName:    field.Name,
+		JsonName:     name,
+		RelationType: relationType,
+		TargetModel:  target,
+		IsList:       relationType == RelationTypeHasMany,
+		Key:          key,
+		ForeignKey:   foreignKey,
+		schema:       schema,
+	}
+
+	if relationType == RelationTypeBelongsTo {
+		if r.Key == "" {
+			r.Key = name + "Id"
+		}
+		if r.ForeignKey == "" {
+			r.ForeignKey = ID
+		}
+	} else {
+		if r.Key == "" {
+			r.Key = ID
+		}
+		if r.ForeignKey == "" {
+			r.ForeignKey = lowerFirst(schema.Name) + "Id"
+		}
+	}
+
+	return nil
+}
+
+/************************
+ * Has many through
+ ************************/
+
+// RelationHasManyThrough links a model to target documents through a join
+// model, e.g. a Group has many Users through Membership.
+type RelationHasManyThrough struct {
+	Name        string // Relation name used in filter includes
+	Field       string // Go struct field that receives the related documents. Defaults to the field whose json name is Name
+	TargetModel IModel // Related model
+	Through     IModel // Join model
+	Key         string // JSON field in this model. Defaults to "id"
+	ForeignKey  string // JSON field in the join model pointing to this model. Defaults to <modelName>Id
+	KeyThrough  string // JSON field in the join model pointing to the target. Defaults to <targetModelName>Id
+	TargetKey   string // JSON field in the target model matched by KeyThrough. Defaults to "id"
+	fieldName   string
+	schema      *Schema
+}
+
+func (r *RelationHasManyThrough) GetName() string        { return r.Name }
+func (r *RelationHasManyThrough) GetType() RelationType  { return RelationTypeHasManyThrough }
+func (r *RelationHasManyThrough) GetFieldName() string   { return r.fieldName }
+func (r *RelationHasManyThrough) GetTargetModel() IModel { return r.TargetModel }
+func (r *RelationHasManyThrough) keyFields() []string    { return []string{r.Key} }
+func (r *RelationHasManyThrough) relatedModels() []IModel {
+	return []IModel{r.TargetModel, r.Through}
+}
+
+func (r *RelationHasManyThrough) init(schema *Schema) error {
+	field, err := findRelationField(schema, r.Name, r.Field)
+	if err != nil {
+		return err
+	}
+
+	r.fieldName = field.Name
+	r.schema = schema
+
+	if r.Key == "" {
+		r.Key = ID
+	}
+	if r.ForeignKey == "" {
+		r.ForeignKey = lowerFirst(schema.Name) + "Id"
+	}
+	if r.KeyThrough == "" && r.TargetModel != nil {
+		r.KeyThrough = lowerFirst(r.TargetModel.GetModelName()) + "Id"
+	}
+	if r.TargetKey == "" {
+		r.TargetKey = ID
+	}
+
+	return nil
+}
+
+func (r *RelationHasManyThrough) validate() error {
+	if r.TargetModel == nil || r.Through == nil {
+		return errors.Errorf("relation %s of model %s requires a target and a through model", r.Name, r.schema.Name)
+	}
+
+	if err := validateRelationField(r.schema, r.Name, r.fieldName, true); err != nil {
+		return err
+	}
+
+	if _, ok := r.schema.JSONFields[r.Key]; !ok {
+		return errors.Errorf("relation %s of model %s uses unknown key %s", r.Name, r.schema.Name, r.Key)
+	}
+
+	through := NewSchema(r.Through)
+	for _, key := range []string{r.ForeignKey, r.KeyThrough} {
+		if _, ok := through.JSONFields[key]; !ok {
+			return errors.Errorf("relation %s of model %s uses unknown key %s in model %s", r.Name, r.schema.Name, key, through.Name)
+		}
+	}
+
+	target := NewSchema(r.TargetModel)
+	if _, ok := target.JSONFields[r.TargetKey]; !ok {
+		return errors.Errorf("relation %s of model %s uses unknown key %s in model %s", r.Name, r.schema.Name, r.TargetKey, target.Name)
+	}
+
+	return nil
+}
+
+func (r *RelationHasManyThrough) ResolveForMany(ctx context.Context, ds *Datasource, docs any, scope *lbq.Filter) error {
+	docsValue := reflect.ValueOf(docs)
+	if docsValue.Len() == 0 {
+		return nil
+	}
+
+	throughFinder, err := ds.getRelatedFinder(r.Through.GetModelName())
+	if err != nil {
+		return err
+	}
+
+	targetFinder, err := ds.getRelatedFinder(r.TargetModel.GetModelName())
+	if err != nil {
+		return err
+	}
+
+	keyField := r.schema.JSONFields[r.Key]
+	throughSchema := throughFinder.GetSchema()
+	foreignKeyField, ok := throughSchema.JSONFields[r.ForeignKey]
+	keyThroughField, ok2 := throughSchema.JSONFields[r.KeyThrough]
+	targetKeyField, ok3 := targetFinder.GetSchema().JSONFields[r.TargetKey]
+	if keyField == nil || !ok || !ok2 || !ok3 {
+		return http_errors.InternalServerErrorWithCode(RELATION_INVALID_KEY,
+			fmt.Sprintf("relation %s of model %s has invalid keys", r.Name, r.schema.Name))
+	}
+
+	keys := collectRelationKeys(docsValue, keyField.FieldName)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	links, err := throughFinder.findRelated(ctx, r.ForeignKey, keys, nil)
+	if err != nil {
+		return err
+	}
+
+	targetKeys := collectRelationKeys(links, keyThroughField.FieldName)
+	var targets []reflect.Value
+	if len(targetKeys) > 0 {
+		result, err := targetFinder.findRelated(ctx, r.TargetKey, targetKeys, relationQueryScope(scope, r.TargetKey, targetFinder.GetSchema()))
+		if err != nil {
+			return err
+		}
+		targets = groupRelatedList(result)
+	}
+
+	// Target keys linked to each parent document
+	linked := map[any]map[any]bool{}
+	for _, link := range groupRelatedList(links) {
+		parentKey, ok := relationFieldValue(link, foreignKeyField.FieldName)
+		if !ok {
+			continue
+		}
+		targetKey, ok := relationFieldValue(link, keyThroughField.FieldName)
+		if !ok {
+			continue
+		}
+		normalized := normalizeRelationKey(parentKey)
+		if linked[normalized] == nil {
+			linked[normalized] = map[any]bool{}
+		}
+		linked[normalized][normalizeRelationKey(targetKey)] = true
+	}
+
+	for i := range docsValue.Len() {
+		doc := reflect.Indirect(docsValue.Index(i))
+		value, ok := relationFieldValue(doc, keyField.FieldName)
+		if !ok {
+			continue
+		}
+
+		targetKeysForDoc := linked[normalizeRelationKey(value)]
+		var items []reflect.Value
+		for _, target := range targets {
+			targetKey, ok := relationFieldValue(target, targetKeyField.FieldName)
+			if ok && targetKeysForDoc[normalizeRelationKey(targetKey)] {
+				items = append(items, target)
+			}
+		}
+
+		setRelationField(doc.FieldByName(r.fieldName), paginateRelated(items, scope), true)
+	}
+
+	return nil
+}
+
+func (r *RelationHasManyThrough) ResolveForOne(ctx context.Context, ds *Datasource, doc any, scope *lbq.Filter) error {
+	return resolveForOne(ctx, ds, r, doc, scope)
+}
+
+/************************
+ * Embeds many
+ ************************/
+
+// RelationEmbedsMany describes a list of target models stored inside the
+// document itself. Including it requires no query; the include scope skip and
+// limit are applied to the embedded list.
+type RelationEmbedsMany struct {
+	Name        string // Relation name used in filter includes
+	Field       string // Go struct field that holds the embedded documents. Defaults to the field whose json name is Name
+	TargetModel IModel // Embedded model
+	fieldName   string
+	jsonName    string
+	schema      *Schema
+}
+
+func (r *RelationEmbedsMany) GetName() string        { return r.Name }
+func (r *RelationEmbedsMany) GetType() RelationType  { return RelationTypeEmbedsMany }
+func (r *RelationEmbedsMany) GetFieldName() string   { return r.fieldName }
+func (r *RelationEmbedsMany) GetTargetModel() IModel { return r.TargetModel }
+func (r *RelationEmbedsMany) keyFields() []string    { return []string{r.jsonName} }
+
+// Embedded models are stored with the document and need no repository
+func (r *RelationEmbedsMany) relatedModels() []IModel { return nil }
+
+func (r *RelationEmbedsMany) init(schema *Schema) error {
+	field, err := findRelationField(schema, r.Name, r.Field)
+	if err != nil {
+		return err
+	}
+
+	jsonTags, _ := parseFieldTags(field, "json")
+	r.fieldName = field.Name
+	r.jsonName = jsonTags.Name
+	r.schema = schema
+
+	// Embedded documents are stored with the model, so the field is part of
+	// the schema even though its elements are models.
+	if _, ok := schema.Fields[field.Name]; !ok && field.Tag.Get("bson") != "-" {
+		bsonTags, _ := parseFieldTags(field, "bson")
+		filterTags, _ := parseFilterTags(field)
+		elemType := field.Type
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		if elemType.Kind() == reflect.Slice || elemType.Kind() == reflect.Array {
+			elemType = elemType.Elem()
+		}
+
+		schema.AddField(&Field{
+			FieldName:         field.Name,
+			BsonName:          bsonTags.Name,
+			JsonName:          jsonTags.Name,
+			DataType:          elemType.Name(),
+			FieldType:         field.Type,
+			IndirectFieldType: field.Type,
+			FilterTags:        filterTags,
+		}, true)
+	}
+
+	return nil
+}
+
+func (r *RelationEmbedsMany) validate() error {
+	if r.TargetModel == nil {
+		return errors.Errorf("relation %s of model %s has no target model", r.Name, r.schema.Name)
+	}
+
+	field, ok := r.schema.ReflectValue.Type().FieldByName(r.fieldName)
+	if !ok {
+		return errors.Errorf("relation %s of model %s has no field %s", r.Name, r.schema.Name, r.fieldName)
+	}
+
+	if field.Tag.Get("bson") == "-" {
+		return errors.Errorf("embedded relation %s of model %s must be stored, the field cannot use bson:\"-\"", r.Name, r.schema.Name)
+	}
+
+	return validateRelationField(r.schema, r.Name, r.fieldName, true)
+}
+
+func (r *RelationEmbedsMany) ResolveForMany(ctx context.Context, ds *Datasource, docs any, scope *lbq.Filter) error {
+	if scope == nil || (scope.Skip == 0 && scope.Limit == 0) {
+		return nil
+	}
+
+	docsValue := reflect.ValueOf(docs)
+	for i := range docsValue.Len() {
+		field := reflect.Indirect(docsValue.Index(i)).FieldByName(r.fieldName)
+		if !field.IsValid() || !field.CanSet() {
+			continue
+		}
+
+		list := reflect.Indirect(field)
+		if list.Kind() != reflect.Slice {
+			continue
+		}
+
+		var items []reflect.Value
+		for j := range list.Len() {
+			items = append(items, list.Index(j))
+		}
+
+		setRelationField(field, paginateRelated(items, scope), true)
+	}
+
+	return nil
+}
+
+func (r *RelationEmbedsMany) ResolveForOne(ctx context.Context, ds *Datasource, doc any, scope *lbq.Filter) error {
+	return resolveForOne(ctx, ds, r, doc, scope)
+}
+
+/************************
+ * Helpers
+ ************************/
+
+// resolveForOne resolves a relation for a single document by wrapping it in a slice
+func resolveForOne(ctx context.Context, ds *Datasource, relation IRelation, doc any, scope *lbq.Filter) error {
+	docValue := reflect.ValueOf(doc)
+	if docValue.Kind() != reflect.Ptr || docValue.IsNil() {
+		return errors.Errorf("relation %s can only be resolved for a pointer to a model", relation.GetName())
+	}
+
+	docs := reflect.MakeSlice(reflect.SliceOf(docValue.Elem().Type()), 1, 1)
+	docs.Index(0).Set(docValue.Elem())
+
+	if err := relation.ResolveForMany(ctx, ds, docs.Interface(), scope); err != nil {
+		return err
+	}
+
+	docValue.Elem().Set(docs.Index(0))
+	return nil
+}
+
+// findRelationField returns the struct field holding a declared relation
+func findRelationField(schema *Schema, name string, fieldName string) (reflect.StructField, error) {
+	modelType := schema.ReflectValue.Type()
+	if fieldName != "" {
+		field, ok := modelType.FieldByName(fieldName)
+		if !ok {
+			return reflect.StructField{}, errors.Errorf("relation %s of model %s has no field %s", name, schema.Name, fieldName)
+		}
+		return field, nil
+	}
+
+	for i := range modelType.NumField() {
+		field := modelType.Field(i)
+		jsonTags, _ := parseFieldTags(field, "json")
+		if jsonTags.Name == name {
+			return field, nil
+		}
+	}
+
+	return reflect.StructField{}, errors.Errorf("relation %s of model %s has no field with json name %s", name, schema.Name, name)
+}
+
+// validateRelationField checks that the relation field exists and matches the relation cardinality
+func validateRelationField(schema *Schema, name string, fieldName string, isList bool) error {
+	field, ok := schema.ReflectValue.Type().FieldByName(fieldName)
+	if !ok {
+		return errors.Errorf("relation %s of model %s has no field %s", name, schema.Name, fieldName)
+	}
+
+	fieldType := field.Type
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	fieldIsList := fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array
+	if fieldIsList != isList {
+		if isList {
+			return errors.Errorf("relation %s of model %s must use a slice field", name, schema.Name)
+		}
+		return errors.Errorf("relation %s of model %s cannot use a slice field", name, schema.Name)
+	}
+
+	return nil
+}
+
+// relationQueryScope adapts an include scope for the batched query of the
+// target model. The foreign key and the keys of the nested includes are always
+// projected, so results can be matched with their parents and children.
+//
+// Skip and limit are applied per parent document after the query: the batched
+// query reads every related document matching the where of the scope, so a
+// limit does not bound the documents read from the database.
+func relationQueryScope(scope *lbq.Filter, foreignKey string, target *Schema) *lbq.Filter {
+	if scope == nil {
+		return nil
+	}
+
+	result := *scope
+	result.Skip = 0
+	result.Limit = 0
+
+	if len(scope.Fields) > 0 {
+		result.Fields = lbq.Fields{}
+		hasInclusion := false
+		for field, include := range scope.Fields {
+			result.Fields[field] = include
+			hasInclusion = hasInclusion || include
+		}
+
+		keys := []string{foreignKey}
+		for _, include := range scope.Include {
+			if relation, ok := target.GetRelation(include.Relation); ok {
+				keys = append(keys, relation.keyFields()...)
+			}
+		}
+
+		for _, key := range keys {
+			if hasInclusion {
+				result.Fields[key] = true
+			} else {
+				delete(result.Fields, key)
+			}
+		}
+	}
+
+	return &result
+}
+
+// collectRelationKeys returns the distinct non-zero values of fieldName in docs.
+func collectRelationKeys(docs reflect.Value, fieldName string) []any {
+	var keys []any
+	seen := map[any]bool{}
+
+	for i := range docs.Len() {
+		value, ok := relationFieldValue(docs.Index(i), fieldName)
+		if !ok {
+			continue
+		}
+
+		normalized := normalizeRelationKey(value)
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		keys = append(keys, value)
+	}
+
+	return keys
+}
+
+// groupRelated groups the related documents by the value of fieldName
+func groupRelated(related reflect.Value, fieldName string) map[any][]reflect.Value {
+	grouped := map[any][]reflect.Value{}
+	for _, item := range groupRelatedList(related) {
+		value, ok := relationFieldValue(item, fieldName)
+		if !ok {
+			continue
+		}
+
+		normalized := normalizeRelationKey(value)
+		grouped[normalized] = append(grouped[normalized], item)
+	}
+
+	return grouped
+}
+
+func groupRelatedList(related reflect.Value) []reflect.Value {
+	items := make([]reflect.Value, 0, related.Len())
+	for i := range related.Len() {
+		items = append(items, related.Index(i))
+	}
+	return items
+}
+
+func paginateRelated(items []reflect.Value, scope *lbq.Filter) []reflect.Value {
+	if scope == nil {
+		return items
+	}
+
+	if scope.Skip >= uint(len(items)) {
+		return nil
+	}
+	items = items[scope.Skip:]
+	if scope.Limit > 0 && scope.Limit < uint(len(items)) {
+		items = items[:scope.Limit]
+	}
+	return items
+}
+
+func setRelationField(field reflect.Value, items []reflect.Value, isList bool) {
+	if !field.IsValid() || !field.CanSet() {
+		return
+	}
+
+	target := field
+	if field.Kind() == reflect.Ptr && isList {
+		target = reflect.New(field.Type().Elem()).Elem()
+	}
+
+	if isList {
+		list := reflect.MakeSlice(target.Type(), 0, len(items))
+		for _, item := range items {
+			list = reflect.Append(list, convertRelated(item, target.Type().Elem()))
+		}
+		target.Set(list)
+		if target != field {
+			ptr := reflect.New(target.Type())
+			ptr.Elem().Set(target)
+			field.Set(ptr)
+		}
+		return
+	}
+
+	if len(items) == 0 {
+		field.Set(reflect.Zero(field.Type()))
+		return
+	}
+
+	field.Set(convertRelated(items[0], field.Type()))
+}
+
+// convertRelated adapts a related document to the type expected by the field,
+// taking or removing its address as needed.
+func convertRelated(item reflect.Value, targetType reflect.Type) reflect.Value {
+	switch {
+	case item.Type() == targetType:
+		return item
+	case targetType.Kind() == reflect.Ptr && item.Type() == targetType.Elem():
+		ptr := reflect.New(item.Type())
+		ptr.Elem().Set(item)
+		return ptr
+	case item.Kind() == reflect.Ptr && item.Type().Elem() == targetType:
+		return item.Elem()
+	default:
+		return item
+	}
+}
+
+func relationFieldValue(doc reflect.Value, fieldName string) (any, bool) {
+	doc = reflect.Indirect(doc)
+	if doc.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	field := doc.FieldByName(fieldName)
+	if !field.IsValid() {
+		return nil, false
+	}
+
+	if field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface {
+		if field.IsNil() {
+			return nil, false
+		}
+		field = field.Elem()
+	}
+
+	if field.IsZero() {
+		return nil, false
+	}
+
+	return field.Interface(), true
+}
+
+// normalizeRelationKey makes keys comparable regardless of whether ids are
+// stored as ObjectIDs or as their hex representation.
+func normalizeRelationKey(value any) any {
+	switch v := value.(type) {
+	case bson.ObjectID:
+		return v.Hex()
+	case string:
+		return v
+	}
+
+	if reflect.TypeOf(value).Comparable() {
+		return value
+	}
+
+	return fmt.Sprint(value)
 }
@@ -0,0 +1,455 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"github.com/xompass/vsaas-rest/lbq"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type RelOwner struct {
+	ID      bson.ObjectID `bson:"_id" json:"id"`
+	Name    string        `bson:"name" json:"name"`
+	Devices []RelDevice   `bson:"-" json:"devices"`
+}
+
+func (RelOwner) GetTableName() string     { return "owners" }
+func (RelOwner) GetModelName() string     { return "Owner" }
+func (RelOwner) GetConnectorName() string { return "memory" }
+func (o RelOwner) GetId() any             { return o.ID }
+
+type RelDevice struct {
+	ID        bson.ObjectID `bson:"_id" json:"id"`
+	Name      string        `bson:"name" json:"name"`
+	OwnerId   bson.ObjectID `bson:"ownerId" json:"ownerId"`
+	InstallBy string        `bson:"installBy" json:"installBy"`
+	Owner     *RelOwner     `bson:"-" json:"owner"`
+	Installer *RelOwner     `bson:"-" json:"installer" lb_rel:"belongsTo,key=installBy,foreignKey=name"`
+}
+
+func (RelDevice) GetTableName() string     { return "devices" }
+func (RelDevice) GetModelName() string     { return "Device" }
+func (RelDevice) GetConnectorName() string { return "memory" }
+func (d RelDevice) GetId() any             { return d.ID }
+
+// fakeFinder serves related documents from memory and counts the queries
+type fakeFinder[T IModel] struct {
+	schema  *Schema
+	docs    []T
+	queries int
+	scopes  []*lbq.Filter
+}
+
+func (f *fakeFinder[T]) GetSchema() *Schema {
+	return f.schema
+}
+
+func (f *fakeFinder[T]) findRelated(ctx context.Context, foreignKey string, keys []any, scope *lbq.Filter) (reflect.Value, error) {
+	f.queries++
+	f.scopes = append(f.scopes, scope)
+
+	var normalized []any
+	for _, key := range keys {
+		normalized = append(normalized, normalizeRelationKey(key))
+	}
+
+	fieldName := f.schema.JSONFields[foreignKey].FieldName
+	result := []T{}
+	for _, doc := range f.docs {
+		value, ok := relationFieldValue(reflect.ValueOf(doc), fieldName)
+		if ok && slices.Contains(normalized, normalizeRelationKey(value)) {
+			result = append(result, doc)
+		}
+	}
+
+	return reflect.ValueOf(result), nil
+}
+
+func TestSchema_InferredRelations(t *testing.T) {
+	ownerSchema := NewSchema(RelOwner{})
+	relation, ok := ownerSchema.GetRelation("devices")
+	require.True(t, ok)
+	devices := relation.(*Relation)
+	assert.Equal(t, RelationTypeHasMany, devices.GetType())
+	assert.True(t, devices.IsList)
+	assert.Equal(t, ID, devices.Key)
+	assert.Equal(t, "ownerId", devices.ForeignKey)
+
+	deviceSchema := NewSchema(RelDevice{})
+	relation, ok = deviceSchema.GetRelation("owner")
+	require.True(t, ok)
+	owner := relation.(*Relation)
+	assert.Equal(t, RelationTypeBelongsTo, owner.GetType())
+	assert.Equal(t, "ownerId", owner.Key)
+	assert.Equal(t, ID, owner.ForeignKey)
+
+	relation, ok = deviceSchema.GetRelation("installer")
+	require.True(t, ok)
+	installer := relation.(*Relation)
+	assert.Equal(t, RelationTypeBelongsTo, installer.GetType())
+	assert.Equal(t, "installBy", installer.Key)
+	assert.Equal(t, "name", installer.ForeignKey)
+
+	_, ok = deviceSchema.Fields["Owner"]
+	assert.False(t, ok, "relation fields must not be part of the schema fields")
+}
+
+func newRelationFixtures() (*Datasource, []RelOwner, []RelDevice, *fakeFinder[RelOwner], *fakeFinder[RelDevice]) {
+	owners := []RelOwner{
+		{ID: bson.NewObjectID(), Name: "alice"},
+		{ID: bson.NewObjectID(), Name: "bob"},
+	}
+	devices := []RelDevice{
+		{ID: bson.NewObjectID(), Name: "d1", OwnerId: owners[0].ID, InstallBy: "bob"},
+		{ID: bson.NewObjectID(), Name: "d2", OwnerId: owners[0].ID},
+		{ID: bson.NewObjectID(), Name: "d3", OwnerId: owners[1].ID},
+	}
+
+	ownerFinder := &fakeFinder[RelOwner]{schema: NewSchema(RelOwner{}), docs: owners}
+	deviceFinder := &fakeFinder[RelDevice]{schema: NewSchema(RelDevice{}), docs: devices}
+
+	ds := &Datasource{repositories: map[string]any{
+		"Owner":  ownerFinder,
+		"Device": deviceFinder,
+	}}
+
+	return ds, owners, devices, ownerFinder, deviceFinder
+}
+
+func TestResolveIncludes_BelongsTo(t *testing.T) {
+	ds, owners, devices, ownerFinder, _ := newRelationFixtures()
+	schema := NewSchema(RelDevice{})
+
+	err := resolveIncludes(context.Background(), ds, schema, reflect.ValueOf(devices), []lbq.Include{
+		{Relation: "owner"},
+		{Relation: "installer"},
+	})
+	require.NoError(t, err)
+
+	require.NotNil(t, devices[0].Owner)
+	assert.Equal(t, owners[0].ID, devices[0].Owner.ID)
+	assert.Equal(t, owners[0].ID, devices[1].Owner.ID)
+	assert.Equal(t, owners[1].ID, devices[2].Owner.ID)
+
+	require.NotNil(t, devices[0].Installer)
+	assert.Equal(t, "bob", devices[0].Installer.Name)
+	assert.Nil(t, devices[1].Installer)
+
+	assert.Equal(t, 2, ownerFinder.queries, "one query per relation")
+}
+
+func TestResolveIncludes_HasManyWithScope(t *testing.T) {
+	ds, owners, _, ownerFinder, deviceFinder := newRelationFixtures()
+
+	err := resolveIncludes(context.Background(), ds, ownerFinder.schema, reflect.ValueOf(owners), []lbq.Include{
+		{Relation: "devices", Scope: &lbq.Filter{Limit: 1, Fields: lbq.Fields{"name": true}}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, deviceFinder.queries)
+	require.Len(t, owners[0].Devices, 1, "limit is applied per parent")
+	assert.Equal(t, "d1", owners[0].Devices[0].Name)
+	require.Len(t, owners[1].Devices, 1)
+	assert.Equal(t, "d3", owners[1].Devices[0].Name)
+
+	scope := deviceFinder.scopes[0]
+	assert.Equal(t, uint(0), scope.Limit, "limit is not sent to the batched query")
+	assert.Equal(t, lbq.Fields{"name": true, "ownerId": true}, scope.Fields)
+}
+
+func TestRelationQueryScope_NestedIncludeKeys(t *testing.T) {
+	scope := &lbq.Filter{
+		Fields:  lbq.Fields{"name": true},
+		Limit:   2,
+		Include: []lbq.Include{{Relation: "installer"}, {Relation: "unknown"}},
+	}
+
+	result := relationQueryScope(scope, "ownerId", NewSchema(RelDevice{}))
+	assert.Equal(t, lbq.Fields{"name": true, "ownerId": true, "installBy": true}, result.Fields, "nested includes keep their keys")
+	assert.Equal(t, uint(0), result.Limit)
+	assert.Equal(t, lbq.Fields{"name": true}, scope.Fields, "the scope of the caller is not modified")
+
+	exclusion := relationQueryScope(&lbq.Filter{Fields: lbq.Fields{"name": false, "installBy": false}, Include: scope.Include}, "ownerId", NewSchema(RelDevice{}))
+	assert.Equal(t, lbq.Fields{"name": false}, exclusion.Fields, "nested include keys are not excluded")
+}
+
+func TestResolveIncludes_UnknownRelation(t *testing.T) {
+	ds, owners, _, _, _ := newRelationFixtures()
+
+	err := resolveIncludes(context.Background(), ds, NewSchema(RelOwner{}), reflect.ValueOf(owners), []lbq.Include{{Relation: "cameras"}})
+	require.Error(t, err)
+
+	errResponse, ok := err.(http_errors.ErrorResponse)
+	require.True(t, ok)
+	assert.Equal(t, RELATION_NOT_FOUND, errResponse.ErrorCode)
+}
+
+func TestAddIncludeKeysToProjection(t *testing.T) {
+	schema := NewSchema(RelDevice{})
+
+	fields := map[string]bool{"name": true}
+	addIncludeKeysToProjection(fields, schema, []lbq.Include{{Relation: "owner"}})
+	assert.Equal(t, map[string]bool{"name": true, "ownerId": true}, fields)
+
+	exclusion := map[string]bool{"ownerId": false}
+	addIncludeKeysToProjection(exclusion, schema, []lbq.Include{{Relation: "owner"}})
+	assert.Equal(t, map[string]bool{"ownerId": false}, exclusion)
+}
+
+type RelTag struct {
+	ID    bson.ObjectID `bson:"_id" json:"id"`
+	Label string        `bson:"label" json:"label"`
+}
+
+func (RelTag) GetTableName() string     { return "tags" }
+func (RelTag) GetModelName() string     { return "Tag" }
+func (RelTag) GetConnectorName() string { return "memory" }
+func (t RelTag) GetId() any             { return t.ID }
+
+type RelMembership struct {
+	ID      bson.ObjectID `bson:"_id" json:"id"`
+	TeamId  bson.ObjectID `bson:"teamId" json:"teamId"`
+	OwnerId bson.ObjectID `bson:"ownerId" json:"ownerId"`
+}
+
+func (RelMembership) GetTableName() string     { return "memberships" }
+func (RelMembership) GetModelName() string     { return "Membership" }
+func (RelMembership) GetConnectorName() string { return "memory" }
+func (m RelMembership) GetId() any             { return m.ID }
+
+type RelTeam struct {
+	ID        bson.ObjectID `bson:"_id" json:"id"`
+	Name      string        `bson:"name" json:"name"`
+	LeadName  string        `bson:"leadName" json:"leadName"`
+	Tags      []RelTag      `bson:"tags" json:"tags"`
+	Lead      *RelOwner     `bson:"-" json:"lead"`
+	Members   []RelOwner    `bson:"-" json:"members"`
+	Installed []RelDevice   `bson:"-" json:"installed"`
+}
+
+func (RelTeam) GetTableName() string     { return "teams" }
+func (RelTeam) GetModelName() string     { return "Team" }
+func (RelTeam) GetConnectorName() string { return "memory" }
+func (t RelTeam) GetId() any             { return t.ID }
+
+func (RelTeam) DefineRelations() []IRelation {
+	return []IRelation{
+		&RelationBelongsTo{Name: "lead", TargetModel: RelOwner{}, Key: "leadName", ForeignKey: "name"},
+		&RelationHasMany{Name: "installed", TargetModel: RelDevice{}, Key: "leadName", ForeignKey: "installBy"},
+		&RelationHasManyThrough{Name: "members", TargetModel: RelOwner{}, Through: RelMembership{}},
+		&RelationEmbedsMany{Name: "tags", TargetModel: RelTag{}},
+	}
+}
+
+func TestSchema_DeclaredRelations(t *testing.T) {
+	schema := NewSchema(RelTeam{})
+	require.Len(t, schema.Relations, 4)
+	require.NoError(t, schema.ValidateRelations())
+
+	lead, ok := schema.GetRelation("lead")
+	require.True(t, ok)
+	assert.Equal(t, RelationTypeBelongsTo, lead.GetType())
+	assert.Equal(t, "Lead", lead.GetFieldName())
+
+	members, ok := schema.GetRelation("members")
+	require.True(t, ok)
+	through := members.(*RelationHasManyThrough)
+	assert.Equal(t, ID, through.Key)
+	assert.Equal(t, "teamId", through.ForeignKey)
+	assert.Equal(t, "ownerId", through.KeyThrough)
+	assert.Equal(t, ID, through.TargetKey)
+
+	tags, ok := schema.GetRelation("tags")
+	require.True(t, ok)
+	assert.Equal(t, RelationTypeEmbedsMany, tags.GetType())
+	assert.Contains(t, schema.JSONFields, "tags", "embedded documents are stored with the model")
+}
+
+func TestSchema_ValidateRelations(t *testing.T) {
+	tests := []struct {
+		name     string
+		relation IRelation
+	}{
+		{"unknown key", &RelationHasMany{Name: "installed", TargetModel: RelDevice{}, Key: "missing", ForeignKey: "installBy"}},
+		{"unknown foreign key", &RelationHasMany{Name: "installed", TargetModel: RelDevice{}, ForeignKey: "missing"}},
+		{"list field for belongsTo", &RelationBelongsTo{Name: "installed", TargetModel: RelDevice{}, Key: "leadName", ForeignKey: "installBy"}},
+		{"unknown through key", &RelationHasManyThrough{Name: "members", TargetModel: RelOwner{}, Through: RelMembership{}, KeyThrough: "missing"}},
+		{"missing target", &RelationHasMany{Name: "installed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := NewSchema(RelTeam{})
+			require.NoError(t, tt.relation.init(schema))
+			assert.Error(t, tt.relation.validate())
+		})
+	}
+}
+
+type RelMisspelledTeam struct {
+	ID      bson.ObjectID `bson:"_id" json:"id"`
+	Name    string        `bson:"name" json:"name"`
+	Lead    *RelOwner     `bson:"-" json:"lead" lb_rel:"belongsTo,key=name,foreignKey=name"`
+	Members []RelOwner    `bson:"-" json:"members"`
+}
+
+func (RelMisspelledTeam) GetTableName() string     { return "misspelled_teams" }
+func (RelMisspelledTeam) GetModelName() string     { return "MisspelledTeam" }
+func (RelMisspelledTeam) GetConnectorName() string { return "memory" }
+func (t RelMisspelledTeam) GetId() any             { return t.ID }
+
+func (RelMisspelledTeam) DefineRelations() []IRelation {
+	return []IRelation{
+		&RelationHasManyThrough{Name: "membres", TargetModel: RelOwner{}, Through: RelMembership{}},
+	}
+}
+
+type RelKeylessOwner struct {
+	Name    string      `bson:"name" json:"name"`
+	Devices []RelDevice `bson:"-" json:"devices"`
+	Lead    *RelOwner   `bson:"-" json:"lead" lb_rel:"belongsTo,key=name,foreignKey=name"`
+}
+
+func (RelKeylessOwner) GetTableName() string     { return "keyless_owners" }
+func (RelKeylessOwner) GetModelName() string     { return "KeylessOwner" }
+func (RelKeylessOwner) GetConnectorName() string { return "memory" }
+func (o RelKeylessOwner) GetId() any             { return o.Name }
+
+func TestSchema_RelationInitErrors(t *testing.T) {
+	t.Run("misspelled declared relation", func(t *testing.T) {
+		schema := NewSchema(RelMisspelledTeam{})
+		err := schema.ValidateRelations()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "membres")
+
+		_, ok := schema.GetRelation("lead")
+		assert.True(t, ok, "valid relations are kept")
+
+		ds := &Datasource{}
+		require.NoError(t, ds.AddConnector(NewMemoryConnector("memory")))
+		_, err = NewInMemoryRepository[RelMisspelledTeam](ds, RepositoryOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("unresolvable inferred relation", func(t *testing.T) {
+		schema := NewSchema(RelKeylessOwner{})
+		err := schema.ValidateRelations()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "devices")
+
+		_, ok := schema.GetRelation("lead")
+		assert.True(t, ok, "only the bad field is skipped")
+		_, ok = schema.GetRelation("devices")
+		assert.False(t, ok)
+	})
+}
+
+type RelSite struct {
+	ID   bson.ObjectID `bson:"_id" json:"id"`
+	Name string        `bson:"name" json:"name"`
+}
+
+func (RelSite) GetTableName() string     { return "sites" }
+func (RelSite) GetModelName() string     { return "Site" }
+func (RelSite) GetConnectorName() string { return "memory" }
+func (s RelSite) GetId() any             { return s.ID }
+
+// RelCamera has a transient Site field, inferred as a hasOne relation whose
+// cameraId foreign key does not exist in Site
+type RelCamera struct {
+	ID   bson.ObjectID `bson:"_id" json:"id"`
+	Site *RelSite      `bson:"-" json:"site"`
+}
+
+func (RelCamera) GetTableName() string     { return "cameras" }
+func (RelCamera) GetModelName() string     { return "Camera" }
+func (RelCamera) GetConnectorName() string { return "memory" }
+func (c RelCamera) GetId() any             { return c.ID }
+
+func TestNewRepository_TransientModelField(t *testing.T) {
+	ds := &Datasource{}
+	require.NoError(t, ds.AddConnector(NewMemoryConnector("memory")))
+	_, err := NewInMemoryRepository[RelSite](ds, RepositoryOptions{})
+	require.NoError(t, err)
+
+	_, err = NewInMemoryRepository[RelCamera](ds, RepositoryOptions{})
+	require.NoError(t, err, "inferred relations are not checked when the repository is built")
+
+	err = ds.ValidateRelations()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown foreign key cameraId")
+}
+
+func TestDatasource_ValidateRelations(t *testing.T) {
+	ds, _, _, _, _ := newRelationFixtures()
+	ds.models = map[string]IModel{"Owner": RelOwner{}, "Device": RelDevice{}}
+	teamSchema := NewSchema(RelTeam{})
+
+	err := ds.validateSchemaRelations(teamSchema, false)
+	require.Error(t, err, "the Membership join model is not registered")
+	assert.Contains(t, err.Error(), "Membership")
+
+	ds.models["Membership"] = RelMembership{}
+	require.NoError(t, ds.validateSchemaRelations(teamSchema, false))
+
+	delete(ds.models, "Owner")
+	assert.NoError(t, ds.validateSchemaRelations(NewSchema(RelDevice{}), false), "inferred relations are not checked eagerly")
+	assert.Error(t, ds.ValidateRelations())
+}
+
+func TestResolveIncludes_DeclaredRelations(t *testing.T) {
+	ds, owners, devices, _, _ := newRelationFixtures()
+	teams := []RelTeam{
+		{ID: bson.NewObjectID(), Name: "red", LeadName: "bob", Tags: []RelTag{{Label: "a"}, {Label: "b"}, {Label: "c"}}},
+		{ID: bson.NewObjectID(), Name: "blue", LeadName: "alice"},
+	}
+	memberships := []RelMembership{
+		{ID: bson.NewObjectID(), TeamId: teams[0].ID, OwnerId: owners[0].ID},
+		{ID: bson.NewObjectID(), TeamId: teams[0].ID, OwnerId: owners[1].ID},
+		{ID: bson.NewObjectID(), TeamId: teams[1].ID, OwnerId: owners[1].ID},
+	}
+	membershipFinder := &fakeFinder[RelMembership]{schema: NewSchema(RelMembership{}), docs: memberships}
+	ds.repositories["Membership"] = membershipFinder
+
+	err := resolveIncludes(context.Background(), ds, NewSchema(RelTeam{}), reflect.ValueOf(teams), []lbq.Include{
+		{Relation: "lead"},
+		{Relation: "installed"},
+		{Relation: "members"},
+		{Relation: "tags", Scope: &lbq.Filter{Skip: 1, Limit: 1}},
+	})
+	require.NoError(t, err)
+
+	require.NotNil(t, teams[0].Lead)
+	assert.Equal(t, "bob", teams[0].Lead.Name)
+	assert.Equal(t, "alice", teams[1].Lead.Name)
+
+	require.Len(t, teams[0].Installed, 1)
+	assert.Equal(t, devices[0].ID, teams[0].Installed[0].ID)
+	assert.Empty(t, teams[1].Installed)
+
+	assert.Equal(t, 1, membershipFinder.queries)
+	require.Len(t, teams[0].Members, 2)
+	assert.Equal(t, owners[0].ID, teams[0].Members[0].ID)
+	assert.Equal(t, owners[1].ID, teams[0].Members[1].ID)
+	require.Len(t, teams[1].Members, 1)
+	assert.Equal(t, owners[1].ID, teams[1].Members[0].ID)
+
+	require.Len(t, teams[0].Tags, 1, "embedded lists are paginated in memory")
+	assert.Equal(t, "b", teams[0].Tags[0].Label)
+}
+
+func TestRelation_ResolveForOne(t *testing.T) {
+	ds, owners, _, _, _ := newRelationFixtures()
+	relation, _ := NewSchema(RelOwner{}).GetRelation("devices")
+
+	owner := owners[1]
+	require.NoError(t, relation.ResolveForOne(context.Background(), ds, &owner, nil))
+	require.Len(t, owner.Devices, 1)
+	assert.Equal(t, "d3", owner.Devices[0].Name)
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -12,15 +13,15 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
-func (repository *MongoRepository[T]) fixQuery(query bson.M) bson.M {
-	if repository.Options.Deleted {
+func (opts RepositoryOptions) fixQuery(query bson.M) bson.M {
+	if opts.Deleted {
 		query = getSoftDeleteQuery(query)
 	}
 
 	return query
 }
 
-func (repository *MongoRepository[T]) prepareUpdateDocument(update any, updateDeleted UpdateOptions, setCreated UpdateOptions) (bson.M, error) {
+func (opts RepositoryOptions) prepareUpdateDocument(update any, updateDeleted UpdateOptions, setCreated UpdateOptions) (bson.M, error) {
 	document, err := toBsonMap(update)
 	if err != nil {
 		return nil, err
@@ -78,15 +79,15 @@ func (repository *MongoRepository[T]) prepareUpdateDocument(update any, updateDe
 	}
 
 	// Remove created, deleted and modified fields from update. This is managed by the repository
-	if repository.Options.Created {
+	if opts.Created {
 		delete(bsonSet, CREATED)
 	}
 
-	if repository.Options.Modified {
+	if opts.Modified {
 		delete(bsonSet, MODIFIED)
 	}
 
-	if repository.Options.Deleted {
+	if opts.Deleted {
 		delete(bsonSet, DELETED)
 	}
 
@@ -94,7 +95,7 @@ func (repository *MongoRepository[T]) prepareUpdateDocument(update any, updateDe
 		newUpdate[SET] = bsonSet
 	}
 
-	if repository.Options.Modified || repository.Options.Created || repository.Options.Deleted {
+	if opts.Modified || opts.Created || opts.Deleted {
 		currentDate, ok := document[CURRENT_DATE]
 		var bsonCurrentDate bson.M
 		if ok {
@@ -107,11 +108,11 @@ func (repository *MongoRepository[T]) prepareUpdateDocument(update any, updateDe
 		}
 
 		// The MODIFIED date is set
-		if repository.Options.Modified {
+		if opts.Modified {
 			bsonCurrentDate[MODIFIED] = true
 		}
 
-		if repository.Options.Deleted {
+		if opts.Deleted {
 			// The DELETED date is set if required
 			if updateDeleted.Update {
 				bsonCurrentDate[DELETED] = true
@@ -120,7 +121,7 @@ func (repository *MongoRepository[T]) prepareUpdateDocument(update any, updateDe
 			}
 		}
 
-		if repository.Options.Created {
+		if opts.Created {
 			// The CREATED date is set if required
 			if setCreated.Update && !setCreated.Insert {
 				bsonCurrentDate[CREATED] = true
@@ -136,7 +137,7 @@ func (repository *MongoRepository[T]) prepareUpdateDocument(update any, updateDe
 		}
 	}
 
-	if repository.Options.Created && setCreated.Insert || repository.Options.Deleted && setCreated.Insert {
+	if opts.Created && setCreated.Insert || opts.Deleted && setCreated.Insert {
 		temp, ok := newUpdate[SET_ON_INSERT]
 		var setOnInsert bson.M
 		if ok {
@@ -149,12 +150,12 @@ func (repository *MongoRepository[T]) prepareUpdateDocument(update any, updateDe
 		}
 
 		// The created date is set if required
-		if repository.Options.Created && setCreated.Insert {
+		if opts.Created && setCreated.Insert {
 			setOnInsert[CREATED] = time.Now()
 		}
 
 		// Deleted date is set to nil if required
-		if repository.Options.Deleted && setCreated.Insert {
+		if opts.Deleted && setCreated.Insert {
 			setOnInsert[DELETED] = nil
 		}
 
@@ -172,21 +173,21 @@ func (repository *MongoRepository[T]) prepareUpdateDocument(update any, updateDe
 	return newUpdate, nil
 }
 
-func (repository *MongoRepository[T]) prepareInsertDocument(doc any) (bson.M, error) {
+func (opts RepositoryOptions) prepareInsertDocument(doc any) (bson.M, error) {
 	document, err := toBsonMap(doc)
 	if err != nil {
 		return nil, err
 	}
 
-	if repository.Options.Created {
+	if opts.Created {
 		document[CREATED] = time.Now()
 	}
 
-	if repository.Options.Modified {
+	if opts.Modified {
 		document[MODIFIED] = time.Now()
 	}
 
-	if repository.Options.Deleted {
+	if opts.Deleted {
 		document[DELETED] = nil
 	}
 
@@ -220,23 +221,79 @@ func toBsonMap(v any) (doc bson.M, err error) {
 	return doc, err
 }
 
-func (repository *MongoRepository[T]) buildQuery(filterBuilder FilterBuilder) (bson.M, MongoFilter, *lbq.Filter, error) {
+// buildQuery converts filterBuilder to a MongoDB query for schema, excluding
+// soft deleted documents when required by opts.
+func buildQuery(filterBuilder FilterBuilder, schema *Schema, opts RepositoryOptions) (bson.M, MongoFilter, *lbq.Filter, error) {
 	filter, err := filterBuilder.Build()
 	if err != nil {
 		return nil, MongoFilter{}, nil, err
 	}
 
-	parsedFilter, err := adaptLoopbackFilter(*filter, repository.schema)
+	parsedFilter, err := adaptLoopbackFilter(*filter, schema)
 	if err != nil {
 		return nil, MongoFilter{}, nil, err
 	}
 
-	query := repository.fixQuery(parsedFilter.Where)
+	query := opts.fixQuery(parsedFilter.Where)
+	addIncludeKeysToProjection(parsedFilter.Options.Fields, schema, filter.Include)
 
 	return query, parsedFilter, filter, nil
 }
 
-func (repository *MongoRepository[T]) resolveIncludes(ctx context.Context, doc *T, includes []lbq.Include) error {
-	// TODO: Implement a way to resolve includes
-	return nil
+func (repository *MongoRepository[T]) buildQuery(filterBuilder FilterBuilder) (bson.M, MongoFilter, *lbq.Filter, error) {
+	return buildQuery(filterBuilder, repository.schema, repository.Options)
+}
+
+func (repository *MongoRepository[T]) resolveIncludes(ctx context.Context, docs []T, includes []lbq.Include) error {
+	return resolveIncludes(ctx, repository.datasource, repository.schema, reflect.ValueOf(docs), includes)
+}
+
+func (repository *MongoRepository[T]) findRelated(ctx context.Context, foreignKey string, keys []any, scope *lbq.Filter) (reflect.Value, error) {
+	return findRelated(ctx, repository, foreignKey, keys, scope)
+}
+
+// findRelated finds the documents of repository whose foreignKey is one of keys
+func findRelated[T IModel](ctx context.Context, repository Repository[T], foreignKey string, keys []any, scope *lbq.Filter) (reflect.Value, error) {
+	filter := NewFilter().WithWhere(NewWhere().In(foreignKey, keys))
+	if scope != nil {
+		if len(scope.Where) > 0 {
+			filter.WithWhere(NewWhere().Raw(scope.Where))
+		}
+		filter.Fields(scope.Fields)
+		filter.order = scope.Order
+		filter.include = scope.Include
+	}
+
+	docs, err := repository.Find(ctx, filter)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	return reflect.ValueOf(docs), nil
+}
+
+// addIncludeKeysToProjection makes sure an inclusion projection keeps the
+// fields needed to match the requested relations.
+func addIncludeKeysToProjection(fields map[string]bool, schema *Schema, includes []lbq.Include) {
+	if len(fields) == 0 || len(includes) == 0 {
+		return
+	}
+
+	for _, include := range fields {
+		if !include {
+			return
+		}
+	}
+
+	for _, include := range includes {
+		relation, ok := schema.GetRelation(include.Relation)
+		if !ok {
+			continue
+		}
+		for _, key := range relation.keyFields() {
+			if field, ok := schema.JSONFields[key]; ok {
+				fields[field.BsonName] = true
+			}
+		}
+	}
 }
@@ -0,0 +1,552 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"github.com/xompass/vsaas-rest/lbq"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RepositoryTestModel is the model used by the shared repository suite
+type RepositoryTestModel struct {
+	ID       bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name     string        `bson:"name" json:"name"`
+	Email    string        `bson:"email,omitempty" json:"email,omitempty"`
+	Age      int           `bson:"age" json:"age"`
+	Tags     []string      `bson:"tags,omitempty" json:"tags,omitempty"`
+	Created  time.Time     `bson:"created" json:"created"`
+	Modified time.Time     `bson:"modified" json:"modified"`
+	Deleted  *time.Time    `bson:"deleted,omitempty" json:"deleted,omitempty"`
+}
+
+func (m RepositoryTestModel) GetTableName() string     { return "repository_test_models" }
+func (m RepositoryTestModel) GetModelName() string     { return "RepositoryTestModel" }
+func (m RepositoryTestModel) GetConnectorName() string { return "test" }
+func (m RepositoryTestModel) GetId() any               { return m.ID }
+
+func (m *RepositoryTestModel) BeforeCreate() error {
+	m.Created = time.Now()
+	m.Modified = time.Now()
+	return nil
+}
+
+// repositoryFactory returns an empty repository for RepositoryTestModel
+// seeded with docs
+type repositoryFactory func(t testing.TB, options RepositoryOptions, docs ...RepositoryTestModel) Repository[RepositoryTestModel]
+
+func repositoryTestNames(docs []RepositoryTestModel) []string {
+	names := make([]string, len(docs))
+	for i, doc := range docs {
+		names[i] = doc.Name
+	}
+	return names
+}
+
+// runRepositorySuite checks the behavior every Repository implementation must
+// share, so the implementations cannot drift apart. Cases named in skip are
+// not supported by the implementation.
+func runRepositorySuite(t *testing.T, newRepo repositoryFactory, skip ...string) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, newRepo repositoryFactory)
+	}{
+		{"Find", testRepositoryFind},
+		{"FindOne", testRepositoryFindOne},
+		{"FindById", testRepositoryFindById},
+		{"Insert", testRepositoryInsert},
+		{"Create", testRepositoryCreate},
+		{"UpdateById", testRepositoryUpdateById},
+		{"DeleteById", testRepositoryDeleteById},
+		{"Count", testRepositoryCount},
+		{"Exists", testRepositoryExists},
+		{"Where", testRepositoryWhere},
+		{"OrderSkipLimitFields", testRepositoryOrderSkipLimitFields},
+		{"Timestamps", testRepositoryTimestamps},
+		{"SoftDelete", testRepositorySoftDelete},
+		{"Upsert", testRepositoryUpsert},
+		{"ArrayUpdates", testRepositoryArrayUpdates},
+		{"ChangeRecorder", testRepositoryChangeRecorder},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if slices.Contains(skip, tc.name) {
+				t.Skip("not supported by this repository")
+			}
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+func testRepositoryFind(t *testing.T, newRepo repositoryFactory) {
+	tests := []struct {
+		name     string
+		docs     []RepositoryTestModel
+		filter   *FilterBuilder
+		expected int
+	}{
+		{
+			name: "find all documents",
+			docs: []RepositoryTestModel{
+				{Name: "Test1", Email: "test1@example.com"},
+				{Name: "Test2", Email: "test2@example.com"},
+			},
+			filter:   nil,
+			expected: 2,
+		},
+		{
+			name:     "find with empty repository",
+			filter:   nil,
+			expected: 0,
+		},
+		{
+			name: "find with limit",
+			docs: []RepositoryTestModel{
+				{Name: "Test1"},
+				{Name: "Test2"},
+				{Name: "Test3"},
+			},
+			filter:   NewFilter().Limit(2),
+			expected: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newRepo(t, RepositoryOptions{}, tt.docs...)
+
+			results, err := repo.Find(context.Background(), tt.filter)
+
+			require.NoError(t, err)
+			assert.NotNil(t, results)
+			assert.Len(t, results, tt.expected)
+		})
+	}
+}
+
+func testRepositoryFindOne(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+
+	repo := newRepo(t, RepositoryOptions{}, RepositoryTestModel{Name: "Test1"})
+	result, err := repo.FindOne(ctx, NewFilter())
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, "Test1", result.Name)
+
+	repo = newRepo(t, RepositoryOptions{})
+	result, err = repo.FindOne(ctx, NewFilter())
+	require.NoError(t, err)
+	assert.Nil(t, result, "no match is not an error")
+}
+
+func testRepositoryFindById(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+	id := bson.NewObjectID()
+	repo := newRepo(t, RepositoryOptions{}, RepositoryTestModel{ID: id, Name: "Test User"})
+
+	result, err := repo.FindById(ctx, id, nil)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, id, result.ID)
+	assert.Equal(t, "Test User", result.Name)
+
+	result, err = repo.FindById(ctx, id.Hex(), nil)
+	require.NoError(t, err)
+	require.NotNil(t, result, "hex ids are converted using the schema")
+
+	result, err = repo.FindById(ctx, bson.NewObjectID(), nil)
+	require.NoError(t, err)
+	assert.Nil(t, result)
+
+	_, err = repo.FindById(ctx, nil, nil)
+	assert.ErrorContains(t, err, "id cannot be nil")
+}
+
+func testRepositoryInsert(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+	repo := newRepo(t, RepositoryOptions{})
+
+	id, err := repo.Insert(ctx, RepositoryTestModel{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+	require.IsType(t, bson.ObjectID{}, id)
+
+	doc, err := repo.FindById(ctx, id, nil)
+	require.NoError(t, err)
+	require.NotNil(t, doc)
+	assert.False(t, doc.Created.IsZero(), "BeforeCreate hook sets Created")
+	assert.False(t, doc.Modified.IsZero(), "BeforeCreate hook sets Modified")
+
+	_, err = repo.Insert(ctx, RepositoryTestModel{ID: id.(bson.ObjectID), Name: "Duplicated"})
+	var httpErr http_errors.ErrorResponse
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, MONGO_DUPLICATE_KEY, httpErr.ErrorCode)
+}
+
+func testRepositoryCreate(t *testing.T, newRepo repositoryFactory) {
+	repo := newRepo(t, RepositoryOptions{})
+
+	result, err := repo.Create(context.Background(), RepositoryTestModel{Name: "Test User", Email: "test@example.com", Age: 30})
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.False(t, result.ID.IsZero())
+	assert.Equal(t, "Test User", result.Name)
+	assert.Equal(t, "test@example.com", result.Email)
+	assert.Equal(t, 30, result.Age)
+}
+
+func testRepositoryUpdateById(t *testing.T, newRepo repositoryFactory) {
+	id := bson.NewObjectID()
+
+	tests := []struct {
+		name    string
+		id      any
+		update  any
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name:   "successful update",
+			id:     id,
+			update: map[string]any{"name": "Updated", "email": "updated@example.com"},
+		},
+		{
+			name:    "nil id",
+			id:      nil,
+			update:  map[string]any{"name": "Updated"},
+			wantErr: true,
+			errMsg:  "id cannot be nil",
+		},
+		{
+			name:    "nil update",
+			id:      id,
+			update:  nil,
+			wantErr: true,
+			errMsg:  "update cannot be nil",
+		},
+		{
+			name:    "mixed update",
+			id:      id,
+			update:  bson.M{"name": "Updated", "$inc": bson.M{"age": 1}},
+			wantErr: true,
+			errMsg:  MIXED_UPDATE,
+		},
+		{
+			// Updating a missing document is not an error
+			name:   "document not found",
+			id:     bson.NewObjectID(),
+			update: map[string]any{"name": "Updated"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo(t, RepositoryOptions{}, RepositoryTestModel{ID: id, Name: "Original", Email: "original@example.com"})
+
+			err := repo.UpdateById(ctx, tt.id, tt.update)
+
+			if tt.wantErr {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+
+			require.NoError(t, err)
+
+			doc, err := repo.FindById(ctx, tt.id, nil)
+			require.NoError(t, err)
+			if doc != nil {
+				assert.Equal(t, tt.update.(map[string]any)["name"], doc.Name)
+			}
+		})
+	}
+}
+
+func testRepositoryDeleteById(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+	id := bson.NewObjectID()
+	repo := newRepo(t, RepositoryOptions{}, RepositoryTestModel{ID: id, Name: "Test"})
+
+	require.NoError(t, repo.DeleteById(ctx, id))
+	exists, err := repo.Exists(ctx, id)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.ErrorContains(t, repo.DeleteById(ctx, nil), "id cannot be nil")
+	assert.ErrorContains(t, repo.DeleteById(ctx, id), NO_DOCUMENTS)
+}
+
+// changeRecorderFunc adapts a function to ChangeRecorder
+type changeRecorderFunc func(change Change)
+
+func (f changeRecorderFunc) RecordChange(change Change) { f(change) }
+
+func testRepositoryChangeRecorder(t *testing.T, newRepo repositoryFactory) {
+	var changes []Change
+	ctx := WithChangeRecorder(context.Background(), changeRecorderFunc(func(change Change) {
+		changes = append(changes, change)
+	}))
+
+	id := bson.NewObjectID()
+	other := bson.NewObjectID()
+	repo := newRepo(t, RepositoryOptions{}, RepositoryTestModel{ID: id, Name: "Before", Age: 30}, RepositoryTestModel{ID: other, Name: "Other"})
+
+	require.NoError(t, repo.UpdateById(ctx, id, bson.M{SET: bson.M{"name": "After"}}))
+	_, err := repo.FindOneAndUpdate(ctx, NewFilter().WithWhere(NewWhere().Eq("name", "Other")), bson.M{"$inc": bson.M{"age": 1}})
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteById(ctx, id))
+	assert.Error(t, repo.DeleteById(ctx, id), "failed operations are not reported")
+	require.NoError(t, repo.UpdateById(context.Background(), other, bson.M{SET: bson.M{"name": "Unrecorded"}}))
+
+	require.Len(t, changes, 3)
+
+	assert.Equal(t, ChangeUpdate, changes[0].Operation)
+	assert.Equal(t, "RepositoryTestModel", changes[0].Model)
+	assert.Equal(t, id, changes[0].ID)
+	assert.Equal(t, "Before", changes[0].Before.(RepositoryTestModel).Name)
+	assert.Equal(t, "After", changes[0].After.(RepositoryTestModel).Name)
+
+	assert.Equal(t, other, changes[1].ID)
+	assert.Equal(t, 0, changes[1].Before.(RepositoryTestModel).Age)
+	assert.Equal(t, 1, changes[1].After.(RepositoryTestModel).Age)
+
+	assert.Equal(t, ChangeDelete, changes[2].Operation)
+	assert.Equal(t, "After", changes[2].Before.(RepositoryTestModel).Name)
+	assert.Nil(t, changes[2].After)
+
+	changes = nil
+	filter := NewFilter().WithWhere(NewWhere().Eq(ID, other)).Fields(map[string]bool{"age": true})
+	require.NoError(t, repo.UpdateOne(ctx, filter, bson.M{SET: bson.M{"age": 2}}))
+	require.Len(t, changes, 1)
+	assert.Equal(t, "Unrecorded", changes[0].Before.(RepositoryTestModel).Name, "the projection of the caller is not applied to the recorded documents")
+	assert.Equal(t, 1, changes[0].Before.(RepositoryTestModel).Age)
+
+	changes = nil
+	third := bson.NewObjectID()
+	_, err = repo.Insert(ctx, RepositoryTestModel{ID: third, Name: "Third", Age: 2})
+	require.NoError(t, err)
+	require.NoError(t, repo.Upsert(ctx, NewFilter().WithWhere(NewWhere().Eq("name", "Fourth")), bson.M{SET: bson.M{"age": 2}}))
+	assert.Empty(t, changes, "inserts are not reported")
+
+	require.NoError(t, repo.Upsert(ctx, NewFilter().WithWhere(NewWhere().Eq(ID, third)), bson.M{SET: bson.M{"age": 3}}))
+	require.Len(t, changes, 1)
+	assert.Equal(t, third, changes[0].ID)
+	assert.Equal(t, 3, changes[0].After.(RepositoryTestModel).Age)
+
+	changes = nil
+	updated, err := repo.UpdateMany(ctx, NewFilter().WithWhere(NewWhere().In(ID, []any{other, third})), bson.M{SET: bson.M{"age": 5}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated)
+	require.Len(t, changes, 2)
+	for _, change := range changes {
+		assert.Equal(t, ChangeUpdate, change.Operation)
+		assert.Contains(t, []any{other, third}, change.ID)
+		assert.NotEqual(t, 5, change.Before.(RepositoryTestModel).Age)
+		assert.Equal(t, 5, change.After.(RepositoryTestModel).Age)
+	}
+
+	changes = nil
+	deleted, err := repo.DeleteMany(ctx, NewFilter().WithWhere(NewWhere().Eq("age", 5)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	require.Len(t, changes, 2)
+	for _, change := range changes {
+		assert.Equal(t, ChangeDelete, change.Operation)
+		assert.Equal(t, 5, change.Before.(RepositoryTestModel).Age)
+		assert.Nil(t, change.After)
+	}
+}
+
+func testRepositoryCount(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+
+	repo := newRepo(t, RepositoryOptions{},
+		RepositoryTestModel{Name: "Test1"},
+		RepositoryTestModel{Name: "Test2"},
+		RepositoryTestModel{Name: "Test3"},
+	)
+	count, err := repo.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	repo = newRepo(t, RepositoryOptions{})
+	count, err = repo.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func testRepositoryExists(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+	id := bson.NewObjectID()
+	repo := newRepo(t, RepositoryOptions{}, RepositoryTestModel{ID: id, Name: "Test"})
+
+	exists, err := repo.Exists(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = repo.Exists(ctx, bson.NewObjectID())
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = repo.Exists(ctx, nil)
+	assert.ErrorContains(t, err, "id cannot be nil")
+}
+
+func testRepositoryWhere(t *testing.T, newRepo repositoryFactory) {
+	repo := newRepo(t, RepositoryOptions{},
+		RepositoryTestModel{Name: "Alice", Email: "alice@example.com", Age: 30, Tags: []string{"admin", "ops"}},
+		RepositoryTestModel{Name: "Bob", Age: 25, Tags: []string{"ops"}},
+		RepositoryTestModel{Name: "Carol", Email: "carol@test.org", Age: 41},
+	)
+
+	tests := []struct {
+		name     string
+		where    *WhereBuilder
+		expected []string
+	}{
+		{"eq", NewWhere().Eq("name", "Bob"), []string{"Bob"}},
+		{"strict eq", NewWhere().Eq("age", 30, true), []string{"Alice"}},
+		{"neq", NewWhere().Neq("name", "Bob"), []string{"Alice", "Carol"}},
+		{"gt", NewWhere().Gt("age", 25), []string{"Alice", "Carol"}},
+		{"between", NewWhere().Between("age", 25, 30, false), []string{"Alice", "Bob"}},
+		{"inq", NewWhere().In("name", []string{"Alice", "Carol"}), []string{"Alice", "Carol"}},
+		{"nin", NewWhere().Nin("name", []string{"Alice", "Carol"}), []string{"Bob"}},
+		{"array element", NewWhere().Eq("tags", "ops"), []string{"Alice", "Bob"}},
+		{"like", NewWhere().Like("email", `example\.com$`), []string{"Alice"}},
+		{"like with options", NewWhere().Like("name", "^c", "i"), []string{"Carol"}},
+		{"nlike", NewWhere().Raw(lbq.Where{"name": lbq.Where{"nlike": "^A"}}), []string{"Bob", "Carol"}},
+		{"exists", NewWhere().Raw(lbq.Where{"email": lbq.Where{"exists": false}}), []string{"Bob"}},
+		{"is null", NewWhere().IsNull("email"), []string{"Bob"}},
+		{"or", NewWhere().Or(NewWhere().Eq("name", "Bob"), NewWhere().Gt("age", 40)), []string{"Bob", "Carol"}},
+		{"and", NewWhere().And(NewWhere().Eq("tags", "ops"), NewWhere().Lt("age", 30)), []string{"Bob"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := repo.Find(context.Background(), NewFilter().WithWhere(tt.where))
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.expected, repositoryTestNames(docs))
+		})
+	}
+}
+
+func testRepositoryOrderSkipLimitFields(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+	aliceId := bson.NewObjectID()
+	repo := newRepo(t, RepositoryOptions{},
+		RepositoryTestModel{ID: aliceId, Name: "Alice", Email: "alice@example.com", Age: 30},
+		RepositoryTestModel{Name: "Bob", Age: 25},
+		RepositoryTestModel{Name: "Carol", Age: 41},
+		RepositoryTestModel{Name: "Dave", Age: 30},
+	)
+
+	docs, err := repo.Find(ctx, NewFilter().OrderByDesc("age").OrderByAsc("name"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Carol", "Alice", "Dave", "Bob"}, repositoryTestNames(docs))
+
+	docs, err = repo.Find(ctx, NewFilter().OrderByAsc("age").OrderByAsc("name").Skip(1).Limit(2))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alice", "Dave"}, repositoryTestNames(docs))
+
+	doc, err := repo.FindOne(ctx, NewFilter().OrderByAsc("name").Skip(3))
+	require.NoError(t, err)
+	assert.Equal(t, "Dave", doc.Name)
+
+	doc, err = repo.FindById(ctx, aliceId, NewFilter().Fields(map[string]bool{"name": true}))
+	require.NoError(t, err)
+	assert.Equal(t, RepositoryTestModel{ID: aliceId, Name: "Alice"}, *doc)
+
+	doc, err = repo.FindById(ctx, aliceId, NewFilter().Fields(map[string]bool{"email": false}))
+	require.NoError(t, err)
+	assert.Empty(t, doc.Email)
+	assert.Equal(t, 30, doc.Age)
+}
+
+func testRepositoryTimestamps(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+	repo := newRepo(t, RepositoryOptions{Created: true, Modified: true})
+
+	created, err := repo.Create(ctx, RepositoryTestModel{Name: "Test"})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), created.Created, time.Second)
+	assert.True(t, created.Created.Equal(created.Modified))
+
+	time.Sleep(5 * time.Millisecond)
+	updated, err := repo.FindOneAndUpdate(ctx, NewFilter().WithWhere(NewWhere().Eq("id", created.ID)), bson.M{
+		"$set": bson.M{"name": "Updated", "created": time.Time{}},
+		"$inc": bson.M{"age": 2},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Updated", updated.Name)
+	assert.Equal(t, 2, updated.Age)
+	assert.True(t, created.Created.Equal(updated.Created), "created is managed by the repository")
+	assert.True(t, updated.Modified.After(created.Modified))
+}
+
+func testRepositorySoftDelete(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+	aliceId := bson.NewObjectID()
+	repo := newRepo(t, RepositoryOptions{Deleted: true},
+		RepositoryTestModel{ID: aliceId, Name: "Alice"},
+		RepositoryTestModel{Name: "Bob"},
+		RepositoryTestModel{Name: "Carol"},
+	)
+
+	require.NoError(t, repo.DeleteById(ctx, aliceId))
+	assert.ErrorContains(t, repo.DeleteById(ctx, aliceId), NO_DOCUMENTS)
+
+	deleted, err := repo.DeleteMany(ctx, NewFilter().WithWhere(NewWhere().Eq("name", "Bob")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	docs, err := repo.Find(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Carol"}, repositoryTestNames(docs))
+
+	count, err := repo.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func testRepositoryUpsert(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+	repo := newRepo(t, RepositoryOptions{Created: true, Deleted: true})
+
+	byName := NewFilter().WithWhere(NewWhere().Eq("name", "Alice"))
+	require.NoError(t, repo.Upsert(ctx, byName, bson.M{"$set": bson.M{"age": 30}}))
+	require.NoError(t, repo.Upsert(ctx, byName, bson.M{"$inc": bson.M{"age": 1}}))
+
+	docs, err := repo.Find(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "Alice", docs[0].Name, "equality conditions seed the inserted document")
+	assert.Equal(t, 31, docs[0].Age)
+
+	found, err := repo.FindOneOrCreate(ctx, byName, RepositoryTestModel{Name: "Ignored"})
+	require.NoError(t, err)
+	assert.Equal(t, docs[0].ID, found.ID)
+
+	created, err := repo.FindOneOrCreate(ctx, NewFilter().WithWhere(NewWhere().Eq("name", "Bob")), RepositoryTestModel{Name: "Bob", Age: 25})
+	require.NoError(t, err)
+	assert.False(t, created.ID.IsZero())
+	assert.Equal(t, 25, created.Age)
+	assert.False(t, created.Created.IsZero())
+}
+
+func testRepositoryArrayUpdates(t *testing.T, newRepo repositoryFactory) {
+	ctx := context.Background()
+	repo := newRepo(t, RepositoryOptions{}, RepositoryTestModel{Name: "Alice"}, RepositoryTestModel{Name: "Bob", Tags: []string{"team"}})
+
+	modified, err := repo.UpdateMany(ctx, nil, bson.M{"$addToSet": bson.M{"tags": "team"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), modified)
+
+	modified, err = repo.UpdateMany(ctx, nil, bson.M{"$addToSet": bson.M{"tags": "team"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), modified, "unchanged documents are not counted")
+}
@@ -1,10 +1,13 @@
 package database
 
 import (
-	"log"
+	"log/slog"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/go-errors/errors"
 )
 
 type FieldTags struct {
@@ -49,8 +52,10 @@ type Schema struct {
 	Fields               map[string]*Field
 	RequiredFilterFields map[string]*Field
 	BannedFields         map[string]*Field
-	// Relations            []Relation
-	ReflectValue reflect.Value
+	Relations            []IRelation
+	ReflectValue         reflect.Value
+	relationErrors       []error // Declared relations that could not be initialized, reported by ValidateRelations
+	inferredErrors       []error // Inferred relations that could not be initialized, reported by ValidateRelations
 }
 
 type RelationType string
@@ -59,6 +64,9 @@ const (
 	RelationTypeHasOne    RelationType = "hasOne"
 	RelationTypeHasMany   RelationType = "hasMany"
 	RelationTypeBelongsTo RelationType = "belongsTo"
+
+	RelationTypeHasManyThrough RelationType = "hasManyThrough"
+	RelationTypeEmbedsMany     RelationType = "embedsMany"
 )
 
 type TargetModel struct {
@@ -67,10 +75,14 @@ type TargetModel struct {
 }
 
 type Relation struct {
-	FieldName    string
-	JsonName     string
+	FieldName    string // Go struct field that holds the related data
+	JsonName     string // Relation name used in filter includes
 	RelationType RelationType
 	TargetModel  IModel
+	IsList       bool   // Whether the field holds a slice of related documents
+	Key          string // JSON name of the field in this model used to match related documents
+	ForeignKey   string // JSON name of the field in the target model that matches Key
+	schema       *Schema
 }
 
 func NewSchema(model IModel) *Schema {
@@ -87,10 +99,8 @@ func NewSchema(model IModel) *Schema {
 	}
 
 	schema.InitFields(&val, "", "")
-	/* err := schema.InitRelations(&val)
-	if err != nil {
-		return nil
-	} */
+	// Relation errors are kept on the schema and reported by ValidateRelations
+	_ = schema.InitRelations(&val)
 	return &schema
 }
 
@@ -98,7 +108,7 @@ func (s *Schema) InitFields(val *reflect.Value, jsonParentField string, bsonPare
 	for i := range val.Type().NumField() {
 		field := val.Type().Field(i)
 		if err := s.InitField(val, field, jsonParentField, bsonParentField); err != nil {
-			log.Println(err)
+			slog.Warn("Invalid schema field", "field", field.Name, "error", err)
 		}
 	}
 }
@@ -121,47 +131,113 @@ func (s *Schema) AddField(field *Field, topLevelField bool) {
 	s.JSONFields[field.JsonName] = field
 }
 
+/**
+ * InitRelations initializes the declared and inferred relations of the model.
+ * A relation that cannot be initialized is skipped, the remaining relations are
+ * still registered. The errors are returned joined and kept on the schema, so
+ * ValidateRelations reports them too.
+ */
 func (s *Schema) InitRelations(val *reflect.Value) error {
+	declared := map[string]bool{}
+	for _, relation := range definedRelations(val) {
+		if err := relation.init(s); err != nil {
+			s.relationErrors = append(s.relationErrors, err)
+			continue
+		}
+		s.Relations = append(s.Relations, relation)
+		declared[relation.GetFieldName()] = true
+	}
+
+	modelInterface := reflect.TypeOf((*IModel)(nil)).Elem()
 	for i := range val.Type().NumField() {
 		fieldStruct := val.Type().Field(i)
+		if declared[fieldStruct.Name] {
+			continue
+		}
 
-		fieldType := fieldStruct.Type
-		indirectFieldType := fieldType
+		elemType := fieldStruct.Type
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
 
-		if fieldType.Kind() == reflect.Ptr {
-			indirectFieldType = fieldType.Elem()
+		if elemType.Kind() == reflect.Slice || elemType.Kind() == reflect.Array {
+			elemType = elemType.Elem()
 		}
 
-		fieldValue := reflect.Zero(indirectFieldType)
-		val := fieldValue.Interface()
-		fieldType = fieldValue.Type()
-		fieldKind := fieldValue.Kind()
-		modelInterface := reflect.TypeOf((*IModel)(nil)).Elem()
-		switch fieldKind { //nolint:exhaustive
-		case reflect.Struct:
-			if isModel := fieldType.Implements(modelInterface); !isModel {
-				continue
-			}
-			model := val.(IModel)
-			_, err := s.parseRelation(model, fieldStruct)
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
 
-			if err != nil {
-				return err
-			}
-		case reflect.Slice, reflect.Array:
-			fieldValue = reflect.New(fieldType.Elem()).Elem()
-			val = fieldValue.Interface()
-			fieldType = fieldValue.Type()
-			// fieldKind = fieldValue.Kind()
-			if isModel := fieldType.Implements(modelInterface); !isModel {
-				continue
-			}
-			model := val.(IModel)
-			_, err := s.parseRelation(model, fieldStruct)
+		var model IModel
+		switch {
+		case elemType.Implements(modelInterface):
+			model = reflect.New(elemType).Elem().Interface().(IModel)
+		case reflect.PointerTo(elemType).Implements(modelInterface):
+			model = reflect.New(elemType).Interface().(IModel)
+		default:
+			continue
+		}
 
-			if err != nil {
-				return err
-			}
+		if _, err := s.parseRelation(model, fieldStruct); err != nil {
+			s.inferredErrors = append(s.inferredErrors, err)
+		}
+	}
+	return errors.Join(append(slices.Clone(s.relationErrors), s.inferredErrors...)...)
+}
+
+// definedRelations returns the relations declared by a RelatableModel
+func definedRelations(val *reflect.Value) []IRelation {
+	if definer, ok := val.Interface().(RelatableModel); ok {
+		return definer.DefineRelations()
+	}
+
+	ptr := reflect.New(val.Type())
+	ptr.Elem().Set(*val)
+	if definer, ok := ptr.Interface().(RelatableModel); ok {
+		return definer.DefineRelations()
+	}
+
+	return nil
+}
+
+// GetRelation returns the relation with the given name, as used in filter includes.
+func (s *Schema) GetRelation(name string) (IRelation, bool) {
+	for _, relation := range s.Relations {
+		if relation.GetName() == name {
+			return relation, true
+		}
+	}
+	return nil, false
+}
+
+// ValidateRelations checks that the keys of every relation exist in the models
+// involved. Target models are only required to be registered in ds once
+// Datasource.ValidateRelations is called. Errors found while initializing the
+// relations are reported first.
+func (s *Schema) ValidateRelations() error {
+	return s.validateRelations(true)
+}
+
+// validateRelations checks the declared relations, and the inferred ones when
+// checkInferred is set. Repositories skip the inferred relations when they are
+// built: a transient field typed as a model is not required to be a valid
+// relation until Datasource.ValidateRelations is called.
+func (s *Schema) validateRelations(checkInferred bool) error {
+	if len(s.relationErrors) > 0 {
+		return errors.Join(s.relationErrors...)
+	}
+
+	if checkInferred && len(s.inferredErrors) > 0 {
+		return errors.Join(s.inferredErrors...)
+	}
+
+	for _, relation := range s.Relations {
+		if _, inferred := relation.(*Relation); inferred && !checkInferred {
+			continue
+		}
+
+		if err := relation.validate(); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -284,37 +360,120 @@ func isRelation(model *reflect.Value, fieldStruct reflect.StructField) bool {
 	return isRelation
 }
 
+// parseRelation registers a relation for a `bson:"-"` field whose type is a model.
+// The relation type and keys follow the LoopBack conventions and can be
+// overridden with the lb_rel tag, e.g. `lb_rel:"belongsTo,key=ownerId,foreignKey=id"`.
 func (s *Schema) parseRelation(model IModel, fieldStruct reflect.StructField) (bool, error) {
 	if !fieldStruct.IsExported() || fieldStruct.Tag.Get("bson") != "-" {
 		return false, nil
 	}
 
-	lbTag := strings.TrimSpace(fieldStruct.Tag.Get("lb_rel"))
-	if lbTag == "embedded" {
+	relTags := parseRelationTags(fieldStruct)
+	if relTags.Embedded {
 		return false, nil
 	}
 
 	jsonTags, _ := parseFieldTags(fieldStruct, "json")
 
-	relation := Relation{
+	fieldType := fieldStruct.Type
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	relation := &Relation{
+		schema:       s,
 		FieldName:    fieldStruct.Name,
 		JsonName:     jsonTags.Name,
 		RelationType: RelationTypeHasOne,
 		TargetModel:  model,
+		IsList:       fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array,
 	}
 
-	if _, ok := s.Fields[model.GetModelName()+"Id"]; ok {
+	if field, ok := s.JSONFields[relation.JsonName+"Id"]; ok {
+		relation.RelationType = RelationTypeBelongsTo
+		relation.Key = field.JsonName
+	} else if field, ok := s.Fields[model.GetModelName()+"Id"]; ok {
 		relation.RelationType = RelationTypeBelongsTo
+		relation.Key = field.JsonName
 	}
 
-	if fieldStruct.Type.Kind() == reflect.Slice || fieldStruct.Type.Kind() == reflect.Array {
+	if relation.IsList {
 		relation.RelationType = RelationTypeHasMany
 	}
 
-	// s.Relations = append(s.Relations, relation)
+	if relTags.Type == RelationTypeHasManyThrough || relTags.Type == RelationTypeEmbedsMany {
+		return false, errors.Errorf("relation %s of model %s must be declared with DefineRelations to use type %s", relation.JsonName, s.Name, relTags.Type)
+	}
+
+	if relTags.Type != "" {
+		relation.RelationType = relTags.Type
+	}
+
+	if relation.RelationType == RelationTypeBelongsTo {
+		if relation.Key == "" {
+			relation.Key = relation.JsonName + "Id"
+		}
+		relation.ForeignKey = ID
+	} else {
+		relation.Key = ID
+		relation.ForeignKey = lowerFirst(s.Name) + "Id"
+	}
+
+	if relTags.Key != "" {
+		relation.Key = relTags.Key
+	}
+
+	if relTags.ForeignKey != "" {
+		relation.ForeignKey = relTags.ForeignKey
+	}
+
+	if _, ok := s.JSONFields[relation.Key]; !ok {
+		return false, errors.Errorf("relation %s of model %s uses unknown key %s", relation.JsonName, s.Name, relation.Key)
+	}
+
+	s.Relations = append(s.Relations, relation)
 	return true, nil
 }
 
+type RelationTags struct {
+	Type       RelationType
+	Embedded   bool
+	Key        string
+	ForeignKey string
+}
+
+func parseRelationTags(fieldStruct reflect.StructField) RelationTags {
+	var st RelationTags
+	tag := strings.TrimSpace(fieldStruct.Tag.Get("lb_rel"))
+	if tag == "" {
+		return st
+	}
+
+	for _, str := range strings.Split(tag, ",") {
+		str = strings.TrimSpace(str)
+		key, value, hasValue := strings.Cut(str, "=")
+		switch {
+		case !hasValue && key == "embedded":
+			st.Embedded = true
+		case !hasValue:
+			st.Type = RelationType(key)
+		case key == "key":
+			st.Key = value
+		case key == "foreignKey":
+			st.ForeignKey = value
+		}
+	}
+
+	return st
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
 func parseFieldTags(fieldStruct reflect.StructField, tagName string) (FieldTags, error) {
 	key := strings.ToLower(fieldStruct.Name)
 	tag, ok := fieldStruct.Tag.Lookup(tagName)
@@ -0,0 +1,675 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xompass/vsaas-rest/http_errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Error codes for the SQL query builder
+const (
+	SQL_UNSUPPORTED_OPERATOR = "SQL_UNSUPPORTED_OPERATOR"
+	SQL_UNSUPPORTED_FIELD    = "SQL_UNSUPPORTED_FIELD"
+	SQL_INVALID_OPERATOR     = "SQL_INVALID_OPERATOR"
+)
+
+type sqlColumnKind int
+
+const (
+	sqlColumnScalar   sqlColumnKind = iota // Stored as is
+	sqlColumnObjectID                      // bson.ObjectID stored as its hex string
+	sqlColumnDate                          // time.Time and MongoDate stored as timestamptz
+	sqlColumnJSON                          // Slices, maps and structs stored as jsonb
+)
+
+// sqlColumn is a table column. Columns are named after the BSON name of the
+// top-level fields of the model, so a model can be stored in MongoDB and
+// PostgreSQL without changes.
+type sqlColumn struct {
+	Name  string
+	Field *Field
+	Kind  sqlColumnKind
+}
+
+// sqlTable describes the columns of a model table
+type sqlTable struct {
+	schema  *Schema
+	columns map[string]*sqlColumn
+	names   []string // Column names in a stable order
+}
+
+func newSQLTable(schema *Schema) *sqlTable {
+	table := &sqlTable{schema: schema, columns: map[string]*sqlColumn{}}
+	for _, field := range schema.Fields {
+		if field.BsonName == "" || field.BsonName == "-" || strings.Contains(field.BsonName, ".") {
+			continue
+		}
+
+		table.columns[field.BsonName] = &sqlColumn{
+			Name:  field.BsonName,
+			Field: field,
+			Kind:  sqlColumnKindOf(field.IndirectFieldType),
+		}
+		table.names = append(table.names, field.BsonName)
+	}
+
+	slices.Sort(table.names)
+	return table
+}
+
+func sqlColumnKindOf(t reflect.Type) sqlColumnKind {
+	switch t {
+	case reflect.TypeOf(bson.ObjectID{}):
+		return sqlColumnObjectID
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(MongoDate{}), reflect.TypeOf(bson.DateTime(0)):
+		return sqlColumnDate
+	}
+
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return sqlColumnScalar
+		}
+		return sqlColumnJSON
+	case reflect.Array, reflect.Map, reflect.Struct, reflect.Interface:
+		return sqlColumnJSON
+	}
+
+	return sqlColumnScalar
+}
+
+// column returns the column of a JSON or BSON field name
+func (t *sqlTable) column(name string) (*sqlColumn, bool) {
+	if field, ok := t.schema.JSONFields[name]; ok {
+		if column, ok := t.columns[field.BsonName]; ok {
+			return column, true
+		}
+	}
+
+	column, ok := t.columns[name]
+	return column, ok
+}
+
+// sqlBuilder accumulates the arguments of a parameterized statement. Values
+// are always sent as arguments; identifiers only come from the schema.
+type sqlBuilder struct {
+	table *sqlTable
+	args  []any
+}
+
+func newSQLBuilder(table *sqlTable) *sqlBuilder {
+	return &sqlBuilder{table: table}
+}
+
+// arg adds value, converted for column, and returns its placeholder
+func (b *sqlBuilder) arg(column *sqlColumn, value any) (string, error) {
+	converted, err := sqlValue(column, value)
+	if err != nil {
+		return "", err
+	}
+
+	b.args = append(b.args, converted)
+	placeholder := "$" + strconv.Itoa(len(b.args))
+	if column != nil && column.Kind == sqlColumnJSON {
+		placeholder += "::jsonb"
+	}
+	return placeholder, nil
+}
+
+// where translates a MongoDB query, as built by adaptLoopbackFilter, into a
+// SQL condition. An empty query returns an empty condition.
+func (b *sqlBuilder) where(query bson.M) (string, error) {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var conditions []string
+	for _, key := range keys {
+		var condition string
+		var err error
+
+		switch key {
+		case AND, "$or":
+			condition, err = b.logical(key, query[key])
+		default:
+			if strings.HasPrefix(key, COMMAND_PREFIX) {
+				return "", unsupportedSQLOperator(key)
+			}
+			condition, err = b.field(key, query[key])
+		}
+
+		if err != nil {
+			return "", err
+		}
+		if condition != "" {
+			conditions = append(conditions, condition)
+		}
+	}
+
+	return strings.Join(conditions, " AND "), nil
+}
+
+func (b *sqlBuilder) logical(operator string, value any) (string, error) {
+	clauses, ok := memorySlice(value)
+	if !ok {
+		return "", http_errors.BadRequestErrorWithCode(SQL_INVALID_OPERATOR, operator+" requires an array")
+	}
+
+	var conditions []string
+	for _, clause := range clauses {
+		m, ok := memoryMap(clause)
+		if !ok {
+			return "", http_errors.BadRequestErrorWithCode(SQL_INVALID_OPERATOR, operator+" requires an array of documents")
+		}
+
+		condition, err := b.where(m)
+		if err != nil {
+			return "", err
+		}
+		if condition == "" {
+			condition = "TRUE"
+		}
+		conditions = append(conditions, "("+condition+")")
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	separator := " AND "
+	if operator == "$or" {
+		separator = " OR "
+	}
+	return "(" + strings.Join(conditions, separator) + ")", nil
+}
+
+func (b *sqlBuilder) field(key string, condition any) (string, error) {
+	column, ok := b.table.column(key)
+	if !ok {
+		return "", http_errors.BadRequestErrorWithCode(SQL_UNSUPPORTED_FIELD, "field `"+key+"` cannot be queried, only top-level fields are stored as columns")
+	}
+
+	operators, ok := memoryMap(condition)
+	if !ok || !isMemoryOperatorMap(operators) {
+		return b.equals(column, condition, false)
+	}
+
+	names := make([]string, 0, len(operators))
+	for name := range operators {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var conditions []string
+	for _, name := range names {
+		if name == "$options" {
+			continue
+		}
+
+		condition, err := b.operator(column, name, operators[name], operators)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return strings.Join(conditions, " AND "), nil
+}
+
+func (b *sqlBuilder) operator(column *sqlColumn, operator string, operand any, operators bson.M) (string, error) {
+	name := quoteSQLIdentifier(column.Name)
+
+	switch operator {
+	case "$eq":
+		return b.equals(column, operand, false)
+	case "$ne":
+		return b.equals(column, operand, true)
+	case "$gt", "$gte", "$lt", "$lte":
+		if column.Kind == sqlColumnJSON {
+			return "", unsupportedSQLOperator(operator + " on " + column.Name)
+		}
+		placeholder, err := b.arg(column, operand)
+		if err != nil {
+			return "", err
+		}
+		return name + " " + sqlComparisons[operator] + " " + placeholder, nil
+	case "$in":
+		return b.in(column, operand, false)
+	case "$nin":
+		return b.in(column, operand, true)
+	case "$exists":
+		exists, ok := operand.(bool)
+		if !ok {
+			return "", http_errors.BadRequestErrorWithCode(SQL_INVALID_OPERATOR, "$exists requires a boolean")
+		}
+		if exists {
+			return name + " IS NOT NULL", nil
+		}
+		return name + " IS NULL", nil
+	case "$type":
+		// Only the null type is used, to exclude soft deleted rows
+		if number, ok := operand.(int); !ok || number != 10 {
+			return "", unsupportedSQLOperator("$type")
+		}
+		return name + " IS NULL", nil
+	case "$regex":
+		return b.regex(column, operand, operators["$options"], false)
+	case "$not":
+		regex, ok := memoryMap(operand)
+		if !ok || regex["$regex"] == nil {
+			return "", unsupportedSQLOperator("$not")
+		}
+		return b.regex(column, regex["$regex"], regex["$options"], true)
+	}
+
+	return "", unsupportedSQLOperator(operator)
+}
+
+var sqlComparisons = map[string]string{
+	"$gt":  ">",
+	"$gte": ">=",
+	"$lt":  "<",
+	"$lte": "<=",
+}
+
+// equals matches column against value. As in MongoDB, a scalar matches the
+// elements of a jsonb array and a negated condition matches null values.
+func (b *sqlBuilder) equals(column *sqlColumn, value any, negate bool) (string, error) {
+	name := quoteSQLIdentifier(column.Name)
+
+	if value == nil {
+		if negate {
+			return name + " IS NOT NULL", nil
+		}
+		return name + " IS NULL", nil
+	}
+
+	if column.Kind == sqlColumnJSON {
+		if _, isList := memorySlice(value); !isList {
+			value = bson.A{value}
+		}
+
+		placeholder, err := b.arg(column, value)
+		if err != nil {
+			return "", err
+		}
+
+		if negate {
+			return "(" + name + " IS NULL OR NOT " + name + " @> " + placeholder + ")", nil
+		}
+		return name + " @> " + placeholder, nil
+	}
+
+	placeholder, err := b.arg(column, value)
+	if err != nil {
+		return "", err
+	}
+
+	if negate {
+		return name + " IS DISTINCT FROM " + placeholder, nil
+	}
+	return name + " = " + placeholder, nil
+}
+
+func (b *sqlBuilder) in(column *sqlColumn, operand any, negate bool) (string, error) {
+	values, ok := memorySlice(operand)
+	if !ok {
+		return "", http_errors.BadRequestErrorWithCode(SQL_INVALID_OPERATOR, "$in and $nin require an array")
+	}
+
+	var conditions []string
+	var placeholders []string
+	for _, value := range values {
+		if value == nil || column.Kind == sqlColumnJSON {
+			condition, err := b.equals(column, value, false)
+			if err != nil {
+				return "", err
+			}
+			conditions = append(conditions, condition)
+			continue
+		}
+
+		placeholder, err := b.arg(column, value)
+		if err != nil {
+			return "", err
+		}
+		placeholders = append(placeholders, placeholder)
+	}
+
+	if len(placeholders) > 0 {
+		conditions = append(conditions, quoteSQLIdentifier(column.Name)+" IN ("+strings.Join(placeholders, ", ")+")")
+	}
+
+	if len(conditions) == 0 {
+		if negate {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	}
+
+	condition := "(" + strings.Join(conditions, " OR ") + ")"
+	if negate {
+		return "COALESCE(NOT " + condition + ", TRUE)", nil
+	}
+	return condition, nil
+}
+
+// regex matches column with a POSIX regular expression. The "i" option makes
+// it case insensitive; a negated regex matches null values.
+func (b *sqlBuilder) regex(column *sqlColumn, pattern any, options any, negate bool) (string, error) {
+	if column.Kind == sqlColumnJSON {
+		return "", unsupportedSQLOperator("$regex on " + column.Name)
+	}
+
+	var expression string
+	switch v := pattern.(type) {
+	case string:
+		expression = v
+	case bson.Regex:
+		expression = v.Pattern
+		if options == nil {
+			options = v.Options
+		}
+	default:
+		return "", http_errors.BadRequestErrorWithCode(SQL_INVALID_OPERATOR, "invalid regular expression")
+	}
+
+	flags, _ := options.(string)
+	operator := "~"
+	if strings.Contains(flags, "i") {
+		operator = "~*"
+	}
+
+	b.args = append(b.args, expression)
+	placeholder := "$" + strconv.Itoa(len(b.args))
+	name := quoteSQLIdentifier(column.Name)
+
+	if negate {
+		return "(" + name + " IS NULL OR " + name + " !" + operator + " " + placeholder + ")", nil
+	}
+	return name + " " + operator + " " + placeholder, nil
+}
+
+// orderBy translates sort, a list of JSON field names and directions, into an
+// ORDER BY list. As in MongoDB, null values sort first.
+func (b *sqlBuilder) orderBy(sort any) (string, error) {
+	elements, ok := sort.(bson.D)
+	if !ok || len(elements) == 0 {
+		return "", nil
+	}
+
+	terms := make([]string, 0, len(elements))
+	for _, elem := range elements {
+		column, ok := b.table.column(elem.Key)
+		if !ok {
+			return "", http_errors.BadRequestErrorWithCode(INVALID_ORDER_PARAMETER, "Invalid order parameter", "field `"+elem.Key+"` cannot be sorted")
+		}
+
+		direction := " ASC NULLS FIRST"
+		if number, ok := elem.Value.(int); ok && number < 0 {
+			direction = " DESC NULLS LAST"
+		}
+		terms = append(terms, quoteSQLIdentifier(column.Name)+direction)
+	}
+
+	return strings.Join(terms, ", "), nil
+}
+
+// selectColumns returns the columns kept by a projection of JSON or BSON
+// field names. As in MongoDB, the id is kept unless excluded explicitly.
+func (b *sqlBuilder) selectColumns(fields map[string]bool) []*sqlColumn {
+	var columns []*sqlColumn
+	if len(fields) == 0 {
+		for _, name := range b.table.names {
+			columns = append(columns, b.table.columns[name])
+		}
+		return columns
+	}
+
+	inclusion := false
+	for key, include := range fields {
+		if include && key != "_id" {
+			inclusion = true
+		}
+	}
+
+	projection := map[string]bool{}
+	for key, include := range fields {
+		column, ok := b.table.column(key)
+		if !ok {
+			field, exists := getFieldIfExists(key, b.table.schema.JSONFields)
+			if !exists {
+				continue
+			}
+			// A nested field keeps or drops its whole top-level column
+			if column, ok = b.table.columns[strings.Split(field.BsonName, ".")[0]]; !ok || (!include && column.Name != field.BsonName) {
+				continue
+			}
+		}
+		projection[column.Name] = include
+	}
+
+	for _, name := range b.table.names {
+		include, ok := projection[name]
+		switch {
+		case ok:
+		case name == "_id":
+			include = true
+		default:
+			include = !inclusion
+		}
+
+		if include {
+			columns = append(columns, b.table.columns[name])
+		}
+	}
+
+	return columns
+}
+
+// set translates a MongoDB update, as built by prepareUpdateDocument, into the
+// assignments of an UPDATE statement. $setOnInsert only applies to inserts.
+func (b *sqlBuilder) set(update bson.M) ([]string, error) {
+	operators := make([]string, 0, len(update))
+	for operator := range update {
+		operators = append(operators, operator)
+	}
+	slices.Sort(operators)
+
+	var assignments []string
+	for _, operator := range operators {
+		if operator == SET_ON_INSERT {
+			continue
+		}
+
+		fields, ok := memoryMap(update[operator])
+		if !ok {
+			return nil, http_errors.BadRequestErrorWithCode(SQL_INVALID_OPERATOR, operator+" requires a document")
+		}
+
+		paths := make([]string, 0, len(fields))
+		for path := range fields {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+
+		for _, path := range paths {
+			column, ok := b.table.columns[path]
+			if !ok {
+				return nil, http_errors.BadRequestErrorWithCode(SQL_UNSUPPORTED_FIELD, "field `"+path+"` cannot be updated, only top-level fields are stored as columns")
+			}
+
+			assignment, err := b.assignment(column, operator, fields[path])
+			if err != nil {
+				return nil, err
+			}
+			assignments = append(assignments, assignment)
+		}
+	}
+
+	return assignments, nil
+}
+
+func (b *sqlBuilder) assignment(column *sqlColumn, operator string, operand any) (string, error) {
+	name := quoteSQLIdentifier(column.Name)
+
+	switch operator {
+	case SET:
+		placeholder, err := b.arg(column, operand)
+		if err != nil {
+			return "", err
+		}
+		return name + " = " + placeholder, nil
+	case "$unset":
+		return name + " = NULL", nil
+	case CURRENT_DATE:
+		placeholder, err := b.arg(column, time.Now())
+		if err != nil {
+			return "", err
+		}
+		return name + " = " + placeholder, nil
+	case "$inc", "$mul", "$min", "$max":
+		if column.Kind != sqlColumnScalar && (operator == "$inc" || operator == "$mul") {
+			return "", unsupportedSQLOperator(operator + " on " + column.Name)
+		}
+		placeholder, err := b.arg(column, operand)
+		if err != nil {
+			return "", err
+		}
+		return name + " = " + fmt.Sprintf(sqlUpdateOperators[operator], name, placeholder), nil
+	}
+
+	return "", unsupportedSQLOperator(operator)
+}
+
+var sqlUpdateOperators = map[string]string{
+	"$inc": "COALESCE(%s, 0) + %s",
+	"$mul": "COALESCE(%s, 0) * %s",
+	"$min": "LEAST(%s, %s)",
+	"$max": "GREATEST(%s, %s)",
+}
+
+// sqlValue converts a value of column to the type stored in the table
+func sqlValue(column *sqlColumn, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		value = rv.Elem().Interface()
+	}
+
+	kind := sqlColumnScalar
+	if column != nil {
+		kind = column.Kind
+	}
+
+	switch kind {
+	case sqlColumnJSON:
+		return sqlJSON(value)
+	case sqlColumnObjectID:
+		if id, ok := value.(bson.ObjectID); ok {
+			return id.Hex(), nil
+		}
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Truncate(time.Millisecond), nil
+	case MongoDate:
+		return v.UTC().Truncate(time.Millisecond), nil
+	case bson.DateTime:
+		return v.Time().UTC(), nil
+	case bson.ObjectID:
+		return v.Hex(), nil
+	}
+
+	return value, nil
+}
+
+// sqlJSON encodes value as relaxed extended JSON, so dates and ObjectIDs keep
+// their type when read back.
+func sqlJSON(value any) (string, error) {
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+	if err != nil {
+		return "", err
+	}
+
+	var wrapper struct {
+		V json.RawMessage `json:"v"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return "", err
+	}
+
+	return string(wrapper.V), nil
+}
+
+// sqlDocumentValue converts a value read from column to the value stored in
+// the BSON document decoded into the model.
+func sqlDocumentValue(column *sqlColumn, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch column.Kind {
+	case sqlColumnObjectID:
+		switch v := value.(type) {
+		case string:
+			return bson.ObjectIDFromHex(v)
+		case []byte:
+			return bson.ObjectIDFromHex(string(v))
+		}
+	case sqlColumnJSON:
+		var data []byte
+		switch v := value.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			return value, nil
+		}
+
+		var wrapper bson.M
+		if err := bson.UnmarshalExtJSON([]byte(`{"v":`+string(data)+`}`), false, &wrapper); err != nil {
+			return nil, err
+		}
+		return wrapper["v"], nil
+	case sqlColumnScalar:
+		// Numeric columns are read as strings
+		if s, ok := value.(string); ok {
+			switch column.Field.IndirectFieldType.Kind() { //nolint:exhaustive
+			case reflect.Float32, reflect.Float64:
+				return strconv.ParseFloat(s, 64)
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return strconv.ParseInt(s, 10, 64)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				return strconv.ParseUint(s, 10, 64)
+			}
+		}
+	}
+
+	return value, nil
+}
+
+func quoteSQLIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func unsupportedSQLOperator(operator string) error {
+	return http_errors.BadRequestErrorWithCode(SQL_UNSUPPORTED_OPERATOR, "operator "+operator+" is not supported by the SQL repository")
+}
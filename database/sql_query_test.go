@@ -0,0 +1,175 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func newSQLTestBuilder() *sqlBuilder {
+	return newSQLBuilder(newSQLTable(NewSchema(RepositoryTestModel{})))
+}
+
+func TestSQLTable_Columns(t *testing.T) {
+	table := newSQLTable(NewSchema(RepositoryTestModel{}))
+
+	assert.Equal(t, []string{"_id", "age", "created", "deleted", "email", "modified", "name", "tags"}, table.names)
+	assert.Equal(t, sqlColumnObjectID, table.columns["_id"].Kind)
+	assert.Equal(t, sqlColumnDate, table.columns["created"].Kind)
+	assert.Equal(t, sqlColumnDate, table.columns["deleted"].Kind)
+	assert.Equal(t, sqlColumnJSON, table.columns["tags"].Kind)
+	assert.Equal(t, sqlColumnScalar, table.columns["age"].Kind)
+
+	column, ok := table.column("id")
+	require.True(t, ok, "JSON names resolve to their column")
+	assert.Equal(t, "_id", column.Name)
+}
+
+func TestSQLBuilder_Where(t *testing.T) {
+	id := bson.NewObjectID()
+
+	tests := []struct {
+		name      string
+		query     bson.M
+		condition string
+		args      []any
+	}{
+		{"empty", bson.M{}, "", nil},
+		{"eq", bson.M{"name": "Bob"}, `"name" = $1`, []any{"Bob"}},
+		{"object id", bson.M{"_id": id}, `"_id" = $1`, []any{id.Hex()}},
+		{"null", bson.M{"email": nil}, `"email" IS NULL`, nil},
+		{"ne", bson.M{"name": bson.M{"$ne": "Bob"}}, `"name" IS DISTINCT FROM $1`, []any{"Bob"}},
+		{"range", bson.M{"age": bson.M{"$gte": 25, "$lt": 30}}, `"age" >= $1 AND "age" < $2`, []any{25, 30}},
+		{"in", bson.M{"name": bson.M{"$in": []any{"Alice", nil}}}, `("name" IS NULL OR "name" IN ($1))`, []any{"Alice"}},
+		{"nin", bson.M{"name": bson.M{"$nin": []any{"Alice"}}}, `COALESCE(NOT ("name" IN ($1)), TRUE)`, []any{"Alice"}},
+		{"empty in", bson.M{"name": bson.M{"$in": []any{}}}, `FALSE`, nil},
+		{"json element", bson.M{"tags": "ops"}, `"tags" @> $1::jsonb`, []any{`["ops"]`}},
+		{"exists", bson.M{"email": bson.M{"$exists": false}}, `"email" IS NULL`, nil},
+		{"soft delete", bson.M{"deleted": bson.M{TYPE: 10}}, `"deleted" IS NULL`, nil},
+		{"regex", bson.M{"name": bson.M{"$regex": "^c", "$options": "i"}}, `"name" ~* $1`, []any{"^c"}},
+		{"not regex", bson.M{"name": bson.M{"$not": bson.M{"$regex": "^A"}}}, `("name" IS NULL OR "name" !~ $1)`, []any{"^A"}},
+		{
+			"or",
+			bson.M{"$or": []any{bson.M{"name": "Bob"}, bson.M{"age": bson.M{"$gt": 40}}}},
+			`(("name" = $1) OR ("age" > $2))`,
+			[]any{"Bob", 40},
+		},
+		{
+			"and",
+			bson.M{AND: []any{bson.M{"name": "Bob"}, bson.M{"deleted": bson.M{TYPE: 10}}}},
+			`(("name" = $1) AND ("deleted" IS NULL))`,
+			[]any{"Bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := newSQLTestBuilder()
+			condition, err := builder.where(tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.condition, condition)
+			assert.Equal(t, tt.args, builder.args)
+		})
+	}
+}
+
+func TestSQLBuilder_WhereErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query bson.M
+		code  string
+	}{
+		{"unknown field", bson.M{"missing": 1}, SQL_UNSUPPORTED_FIELD},
+		{"nested field", bson.M{"tags.name": 1}, SQL_UNSUPPORTED_FIELD},
+		{"unsupported operator", bson.M{"tags": bson.M{"$size": 2}}, SQL_UNSUPPORTED_OPERATOR},
+		{"top-level operator", bson.M{"$where": "true"}, SQL_UNSUPPORTED_OPERATOR},
+		{"invalid in", bson.M{"name": bson.M{"$in": "Bob"}}, SQL_INVALID_OPERATOR},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSQLTestBuilder().where(tt.query)
+			var errResponse http_errors.ErrorResponse
+			require.ErrorAs(t, err, &errResponse)
+			assert.Equal(t, tt.code, errResponse.ErrorCode)
+		})
+	}
+}
+
+func TestSQLBuilder_OrderBy(t *testing.T) {
+	builder := newSQLTestBuilder()
+
+	order, err := builder.orderBy(bson.D{{Key: "age", Value: -1}, {Key: "id", Value: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, `"age" DESC NULLS LAST, "_id" ASC NULLS FIRST`, order)
+
+	_, err = builder.orderBy(bson.D{{Key: "missing", Value: 1}})
+	assert.Error(t, err)
+}
+
+func TestSQLBuilder_SelectColumns(t *testing.T) {
+	names := func(columns []*sqlColumn) []string {
+		result := make([]string, len(columns))
+		for i, column := range columns {
+			result[i] = column.Name
+		}
+		return result
+	}
+
+	builder := newSQLTestBuilder()
+	assert.Len(t, builder.selectColumns(nil), 8)
+	assert.Equal(t, []string{"_id", "name"}, names(builder.selectColumns(map[string]bool{"name": true})))
+	assert.Equal(t, []string{"name"}, names(builder.selectColumns(map[string]bool{"name": true, "id": false})))
+	assert.Equal(t, []string{"_id", "created", "deleted", "email", "modified", "name"}, names(builder.selectColumns(map[string]bool{"age": false, "tags": false})))
+}
+
+func TestSQLBuilder_Set(t *testing.T) {
+	builder := newSQLTestBuilder()
+
+	assignments, err := builder.set(bson.M{
+		SET:           bson.M{"name": "Bob", "tags": []string{"a"}},
+		"$inc":        bson.M{"age": 1},
+		"$unset":      bson.M{"email": ""},
+		CURRENT_DATE:  bson.M{MODIFIED: true},
+		SET_ON_INSERT: bson.M{CREATED: time.Now()},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`"modified" = $1`,
+		`"age" = COALESCE("age", 0) + $2`,
+		`"name" = $3`,
+		`"tags" = $4::jsonb`,
+		`"email" = NULL`,
+	}, assignments)
+	assert.Equal(t, `["a"]`, builder.args[3])
+
+	_, err = builder.set(bson.M{"$push": bson.M{"tags": "b"}})
+	var errResponse http_errors.ErrorResponse
+	require.ErrorAs(t, err, &errResponse)
+	assert.Equal(t, SQL_UNSUPPORTED_OPERATOR, errResponse.ErrorCode)
+}
+
+func TestSQLValues_RoundTrip(t *testing.T) {
+	table := newSQLTable(NewSchema(RepositoryTestModel{}))
+
+	id := bson.NewObjectID()
+	stored, err := sqlValue(table.columns["_id"], id)
+	require.NoError(t, err)
+	read, err := sqlDocumentValue(table.columns["_id"], stored)
+	require.NoError(t, err)
+	assert.Equal(t, id, read)
+
+	stored, err = sqlValue(table.columns["tags"], []string{"a", "b"})
+	require.NoError(t, err)
+	read, err = sqlDocumentValue(table.columns["tags"], []byte(stored.(string)))
+	require.NoError(t, err)
+	assert.Equal(t, bson.A{"a", "b"}, read)
+
+	read, err = sqlDocumentValue(table.columns["age"], "42")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), read)
+}
@@ -0,0 +1,733 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"github.com/xompass/vsaas-rest/lbq"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Error codes for sql_repository. Errors shared with MongoRepository (nil ids,
+// missing documents, duplicate keys) keep the MONGO_ codes, so application
+// code behaves the same with every repository.
+const (
+	SQL_CONNECTOR_TYPE_MISMATCH = "SQL_CONNECTOR_TYPE_MISMATCH"
+	SQL_CONNECTOR_NIL           = "SQL_CONNECTOR_NIL"
+	SQL_OPERATION_FAILED        = "SQL_OPERATION_FAILED"
+	SQL_VALIDATION_ERROR        = "SQL_VALIDATION_ERROR"
+)
+
+// mapSQLError maps PostgreSQL errors to standardized http_errors
+func mapSQLError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return http_errors.NotFoundErrorWithCode(MONGO_NO_DOCUMENTS_FOUND, "document not found")
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23505": // unique_violation
+			return http_errors.ConflictErrorWithCode(MONGO_DUPLICATE_KEY, "duplicate key error: "+pgErr.Message)
+		case strings.HasPrefix(pgErr.Code, "23"): // Other integrity constraint violations
+			return http_errors.BadRequestErrorWithCode(SQL_VALIDATION_ERROR, "validation error: "+pgErr.Message)
+		default:
+			return http_errors.BadRequestErrorWithCode(SQL_OPERATION_FAILED, "statement failed: "+pgErr.Message)
+		}
+	}
+
+	return http_errors.InternalServerErrorWithCode(SQL_OPERATION_FAILED, "database operation failed: "+err.Error())
+}
+
+// sqlExecutor is implemented by *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// SQLRepository is a Repository that stores its documents in a PostgreSQL
+// table. Each top-level field of the model is a column named after its BSON
+// name; slices, maps and structs are stored as jsonb. Filters use the same
+// LoopBack syntax as MongoRepository and are translated into parameterized SQL.
+type SQLRepository[T IModel] struct {
+	Options    RepositoryOptions
+	tableName  string
+	schema     *Schema
+	table      *sqlTable
+	connector  *PostgresConnector
+	datasource *Datasource
+}
+
+func NewSQLRepository[T IModel](ds *Datasource, options RepositoryOptions) (Repository[T], error) {
+	var instance T
+
+	schema := NewSchema(instance)
+
+	err := ds.RegisterModel(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ds.validateSchemaRelations(schema, false); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ds.GetModelConnector(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, ok := tmp.(*PostgresConnector)
+	if !ok {
+		return nil, http_errors.InternalServerErrorWithCode(SQL_CONNECTOR_TYPE_MISMATCH, "the connector for model "+instance.GetModelName()+" is not a PostgresConnector")
+	}
+
+	if connector == nil || connector.db == nil {
+		return nil, http_errors.InternalServerErrorWithCode(SQL_CONNECTOR_NIL, "connector is nil")
+	}
+
+	repository := &SQLRepository[T]{
+		Options:    options,
+		tableName:  connector.tableName(instance),
+		schema:     schema,
+		table:      newSQLTable(schema),
+		connector:  connector,
+		datasource: ds,
+	}
+
+	RegisterDatasourceRepository(ds, instance, repository)
+
+	return repository, nil
+}
+
+func (repository *SQLRepository[T]) GetSchema() *Schema {
+	return repository.schema
+}
+
+func (repository *SQLRepository[T]) GetConnector() Connector {
+	return repository.connector
+}
+
+func (repository *SQLRepository[T]) Find(ctx context.Context, filterBuilder *FilterBuilder) ([]T, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, parsedFilter, lbFilter, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	receiver, err := repository.find(ctx, repository.connector.db, query, parsedFilter.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repository.resolveIncludes(ctx, receiver, lbFilter.Include); err != nil {
+		return nil, err
+	}
+
+	return receiver, nil
+}
+
+func (repository *SQLRepository[T]) FindOne(ctx context.Context, filterBuilder *FilterBuilder) (*T, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, parsedFilter, lbFilter, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	one := uint(1)
+	options := parsedFilter.Options
+	options.Limit = &one
+
+	receiver, err := repository.find(ctx, repository.connector.db, query, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(receiver) == 0 {
+		return nil, nil
+	}
+
+	if err := repository.resolveIncludes(ctx, receiver, lbFilter.Include); err != nil {
+		return nil, err
+	}
+
+	return &receiver[0], nil
+}
+
+func (repository *SQLRepository[T]) FindById(ctx context.Context, id any, filterBuilder *FilterBuilder) (*T, error) {
+	if id == nil {
+		return nil, http_errors.BadRequestErrorWithCode(MONGO_ID_CANNOT_BE_NIL, "id cannot be nil")
+	}
+
+	var filterClone *FilterBuilder
+	if filterBuilder == nil {
+		filterClone = NewFilter()
+	} else {
+		filterClone = filterBuilder.Clone()
+	}
+
+	filterClone.WithWhere(NewWhere().Eq(ID, id))
+
+	return repository.FindOne(ctx, filterClone)
+}
+
+func (repository *SQLRepository[T]) Insert(ctx context.Context, doc T) (any, error) {
+	if hook, ok := any(&doc).(BeforeCreateHook); ok {
+		if err := hook.BeforeCreate(); err != nil {
+			return nil, err
+		}
+	}
+
+	document, err := repository.Options.prepareInsertDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.insert(ctx, repository.connector.db, document)
+}
+
+func (repository *SQLRepository[T]) Create(ctx context.Context, doc T) (*T, error) {
+	insertedID, err := repository.Insert(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.FindById(ctx, insertedID, NewFilter())
+}
+
+func (repository *SQLRepository[T]) FindOneOrCreate(ctx context.Context, filterBuilder *FilterBuilder, doc T) (*T, error) {
+	document, err := toBsonMap(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.findOneAndUpdate(ctx, filterBuilder, bson.M{SET_ON_INSERT: document}, true)
+}
+
+func (repository *SQLRepository[T]) Upsert(ctx context.Context, filterBuilder *FilterBuilder, update any) error {
+	if update == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	return recordChange(ctx, repository, filterBuilder, ChangeUpdate, func() error {
+		_, err := repository.findOneAndUpdate(ctx, filterBuilder, update, true)
+		return err
+	})
+}
+
+func (repository *SQLRepository[T]) UpdateOne(ctx context.Context, filterBuilder *FilterBuilder, update any) error {
+	if update == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	return recordChange(ctx, repository, filterBuilder, ChangeUpdate, func() error {
+		_, err := repository.update(ctx, filterBuilder, update, false)
+		return err
+	})
+}
+
+func (repository *SQLRepository[T]) UpdateById(ctx context.Context, id any, update any) error {
+	if id == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_ID_CANNOT_BE_NIL, "id cannot be nil")
+	}
+
+	if update == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	filter := NewFilter().
+		WithWhere(NewWhere().Eq(ID, id))
+	return repository.UpdateOne(ctx, filter, update)
+}
+
+func (repository *SQLRepository[T]) FindOneAndUpdate(ctx context.Context, filterBuilder *FilterBuilder, update any) (*T, error) {
+	if update == nil {
+		return nil, http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	var result *T
+	err := recordChange(ctx, repository, filterBuilder, ChangeUpdate, func() error {
+		var err error
+		result, err = repository.findOneAndUpdate(ctx, filterBuilder, update, false)
+		return err
+	})
+	return result, err
+}
+
+func (repository *SQLRepository[T]) UpdateMany(ctx context.Context, filterBuilder *FilterBuilder, update any) (int64, error) {
+	if update == nil {
+		return 0, http_errors.BadRequestErrorWithCode(MONGO_UPDATE_CANNOT_BE_NIL, "update cannot be nil")
+	}
+
+	return recordChanges(ctx, repository, filterBuilder, ChangeUpdate, func() (int64, error) {
+		return repository.update(ctx, filterBuilder, update, true)
+	})
+}
+
+func (repository *SQLRepository[T]) Count(ctx context.Context, filterBuilder *FilterBuilder) (int64, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, _, _, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return 0, err
+	}
+
+	builder := newSQLBuilder(repository.table)
+	condition, err := builder.where(query)
+	if err != nil {
+		return 0, err
+	}
+
+	statement := "SELECT COUNT(*) FROM " + repository.tableName + sqlWhereClause(condition)
+
+	var count int64
+	if err := repository.connector.db.QueryRowContext(ctx, statement, builder.args...).Scan(&count); err != nil {
+		return 0, mapSQLError(err)
+	}
+
+	return count, nil
+}
+
+func (repository *SQLRepository[T]) Exists(ctx context.Context, id any) (bool, error) {
+	if id == nil {
+		return false, http_errors.BadRequestErrorWithCode(MONGO_ID_CANNOT_BE_NIL, "id cannot be nil")
+	}
+
+	count, err := repository.Count(ctx, NewFilter().WithWhere(NewWhere().Eq(ID, id)))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (repository *SQLRepository[T]) DeleteOne(ctx context.Context, filterBuilder *FilterBuilder) error {
+	return recordChange(ctx, repository, filterBuilder, ChangeDelete, func() error {
+		deleted, err := repository.delete(ctx, filterBuilder, false)
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return http_errors.NotFoundErrorWithCode(MONGO_NO_DOCUMENTS_FOUND, NO_DOCUMENTS)
+		}
+
+		return nil
+	})
+}
+
+func (repository *SQLRepository[T]) DeleteById(ctx context.Context, id any) error {
+	if id == nil {
+		return http_errors.BadRequestErrorWithCode(MONGO_ID_CANNOT_BE_NIL, "id cannot be nil")
+	}
+
+	filterBuilder := NewFilter().
+		WithWhere(NewWhere().Eq(ID, id))
+
+	return repository.DeleteOne(ctx, filterBuilder)
+}
+
+func (repository *SQLRepository[T]) DeleteMany(ctx context.Context, filterBuilder *FilterBuilder) (int64, error) {
+	return recordChanges(ctx, repository, filterBuilder, ChangeDelete, func() (int64, error) {
+		return repository.delete(ctx, filterBuilder, true)
+	})
+}
+
+// find selects the rows matching query, ordered and paginated by options
+func (repository *SQLRepository[T]) find(ctx context.Context, executor sqlExecutor, query bson.M, options MongoFilterOptions) ([]T, error) {
+	builder := newSQLBuilder(repository.table)
+	columns := builder.selectColumns(options.Fields)
+
+	statement, err := repository.selectStatement(builder, columns, query, options)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := executor.QueryContext(ctx, statement, builder.args...)
+	if err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return repository.scan(rows, columns)
+}
+
+// selectStatement builds a SELECT of columns for the rows matching query
+func (repository *SQLRepository[T]) selectStatement(builder *sqlBuilder, columns []*sqlColumn, query bson.M, options MongoFilterOptions) (string, error) {
+	condition, err := builder.where(query)
+	if err != nil {
+		return "", err
+	}
+
+	order, err := builder.orderBy(options.Sort)
+	if err != nil {
+		return "", err
+	}
+
+	statement := "SELECT " + sqlColumnList(columns) + " FROM " + repository.tableName + sqlWhereClause(condition)
+	if order != "" {
+		statement += " ORDER BY " + order
+	}
+	if options.Limit != nil {
+		statement += " LIMIT " + strconv.FormatUint(uint64(*options.Limit), 10)
+	}
+	if options.Skip != nil {
+		statement += " OFFSET " + strconv.FormatUint(uint64(*options.Skip), 10)
+	}
+
+	return statement, nil
+}
+
+// matchedIDs returns a subquery selecting the id of the rows matching query.
+// Unless many is set only the first row is selected, as MongoDB updates and
+// deletes a single document.
+func (repository *SQLRepository[T]) matchedIDs(builder *sqlBuilder, query bson.M, sort any, many bool) (string, error) {
+	options := MongoFilterOptions{Sort: sort}
+	if !many {
+		one := uint(1)
+		options.Limit = &one
+	}
+
+	id := []*sqlColumn{repository.idColumn()}
+	statement, err := repository.selectStatement(builder, id, query, options)
+	if err != nil {
+		return "", err
+	}
+
+	return quoteSQLIdentifier(id[0].Name) + " IN (" + statement + ")", nil
+}
+
+// update applies update to the first row matching filterBuilder, or to all of
+// them when many is set, and returns the number of rows updated.
+func (repository *SQLRepository[T]) update(ctx context.Context, filterBuilder *FilterBuilder, update any, many bool) (int64, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, _, _, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return 0, err
+	}
+
+	fixedUpdate, err := repository.Options.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	builder := newSQLBuilder(repository.table)
+	assignments, err := builder.set(fixedUpdate)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(assignments) == 0 {
+		return 0, nil
+	}
+
+	condition, err := repository.matchedIDs(builder, query, nil, many)
+	if err != nil {
+		return 0, err
+	}
+
+	statement := "UPDATE " + repository.tableName + " SET " + strings.Join(assignments, ", ") + " WHERE " + condition
+	result, err := repository.connector.db.ExecContext(ctx, statement, builder.args...)
+	if err != nil {
+		return 0, mapSQLError(err)
+	}
+
+	return result.RowsAffected()
+}
+
+// findOneAndUpdate updates the first row matching filterBuilder and returns it
+// after the update. With upsert, a row is inserted when none matches; the
+// update and the insert run in a single transaction.
+func (repository *SQLRepository[T]) findOneAndUpdate(ctx context.Context, filterBuilder *FilterBuilder, update any, upsert bool) (*T, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, parsedFilter, _, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	fixedUpdate, err := repository.Options.prepareUpdateDocument(update, UpdateOptions{}, UpdateOptions{Insert: upsert})
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := repository.connector.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, mapSQLError(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	builder := newSQLBuilder(repository.table)
+	columns := builder.selectColumns(parsedFilter.Options.Fields)
+	assignments, err := builder.set(fixedUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	var statement string
+	if len(assignments) == 0 {
+		// Nothing to update on a match, e.g. a $setOnInsert only update
+		one := uint(1)
+		statement, err = repository.selectStatement(builder, columns, query, MongoFilterOptions{Sort: parsedFilter.Options.Sort, Limit: &one})
+		statement += " FOR UPDATE"
+	} else {
+		var condition string
+		condition, err = repository.matchedIDs(builder, query, parsedFilter.Options.Sort, false)
+		statement = "UPDATE " + repository.tableName + " SET " + strings.Join(assignments, ", ") + " WHERE " + condition + " RETURNING " + sqlColumnList(columns)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, statement, builder.args...)
+	if err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	receiver, err := repository.scan(rows, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(receiver) == 0 {
+		if !upsert {
+			return nil, nil
+		}
+
+		doc := memoryUpsertDocument(query)
+		if err := applyMemoryUpdate(doc, fixedUpdate, true); err != nil {
+			return nil, err
+		}
+
+		id, err := repository.insert(ctx, tx, doc)
+		if err != nil {
+			return nil, err
+		}
+
+		receiver, err = repository.find(ctx, tx, bson.M{"_id": id}, MongoFilterOptions{Fields: parsedFilter.Options.Fields})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	if len(receiver) == 0 {
+		return nil, nil
+	}
+
+	return &receiver[0], nil
+}
+
+// insert adds document to the table, generating its _id when missing, and
+// returns the id of the new row. Integer ids are left to the column default.
+func (repository *SQLRepository[T]) insert(ctx context.Context, executor sqlExecutor, document bson.M) (any, error) {
+	if id, ok := document["_id"]; !ok || id == nil || reflect.ValueOf(id).IsZero() {
+		delete(document, "_id")
+		if id, ok := repository.newID(); ok {
+			document["_id"] = id
+		}
+	}
+
+	names := make([]string, 0, len(document))
+	for name := range document {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	builder := newSQLBuilder(repository.table)
+	columns := make([]string, 0, len(names))
+	placeholders := make([]string, 0, len(names))
+	for _, name := range names {
+		column, ok := repository.table.columns[name]
+		if !ok {
+			return nil, http_errors.BadRequestErrorWithCode(SQL_UNSUPPORTED_FIELD, "field `"+name+"` is not a column of "+repository.tableName)
+		}
+
+		placeholder, err := builder.arg(column, document[name])
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, quoteSQLIdentifier(name))
+		placeholders = append(placeholders, placeholder)
+	}
+
+	idColumn := repository.idColumn()
+	statement := "INSERT INTO " + repository.tableName
+	if len(columns) == 0 {
+		statement += " DEFAULT VALUES"
+	} else {
+		statement += " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+	}
+	statement += " RETURNING " + quoteSQLIdentifier(idColumn.Name)
+
+	var id any
+	rows, err := executor.QueryContext(ctx, statement, builder.args...)
+	if err != nil {
+		return nil, mapSQLError(err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		err = rows.Scan(&id)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return sqlDocumentValue(idColumn, id)
+}
+
+// newID generates an _id matching the type of the model id field
+func (repository *SQLRepository[T]) newID() (any, bool) {
+	switch repository.idColumn().Field.IndirectFieldType {
+	case reflect.TypeOf(bson.ObjectID{}):
+		return bson.NewObjectID(), true
+	case reflect.TypeOf(""):
+		return bson.NewObjectID().Hex(), true
+	}
+
+	return nil, false
+}
+
+// idColumn returns the _id column. A model without an id field has a
+// virtual column, so its rows can still be addressed by the database.
+func (repository *SQLRepository[T]) idColumn() *sqlColumn {
+	if column, ok := repository.table.columns["_id"]; ok {
+		return column
+	}
+
+	return &sqlColumn{Name: "_id", Field: &Field{IndirectFieldType: reflect.TypeOf("")}}
+}
+
+func (repository *SQLRepository[T]) delete(ctx context.Context, filterBuilder *FilterBuilder, many bool) (int64, error) {
+	if filterBuilder == nil {
+		filterBuilder = NewFilter()
+	}
+
+	query, _, _, err := buildQuery(*filterBuilder, repository.schema, repository.Options)
+	if err != nil {
+		return 0, err
+	}
+
+	builder := newSQLBuilder(repository.table)
+	statement := "DELETE FROM " + repository.tableName
+	if repository.Options.Deleted {
+		assignments, err := builder.set(bson.M{CURRENT_DATE: bson.M{DELETED: true}})
+		if err != nil {
+			return 0, err
+		}
+		statement = "UPDATE " + repository.tableName + " SET " + strings.Join(assignments, ", ")
+	}
+
+	condition, err := repository.matchedIDs(builder, query, nil, many)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := repository.connector.db.ExecContext(ctx, statement+" WHERE "+condition, builder.args...)
+	if err != nil {
+		return 0, mapSQLError(err)
+	}
+
+	return result.RowsAffected()
+}
+
+// scan reads rows, whose values are columns, and decodes them into T. rows is
+// closed when done.
+func (repository *SQLRepository[T]) scan(rows *sql.Rows, columns []*sqlColumn) ([]T, error) {
+	defer rows.Close()
+
+	receiver := make([]T, 0)
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, mapSQLError(err)
+		}
+
+		document := bson.M{}
+		for i, column := range columns {
+			value, err := sqlDocumentValue(column, values[i])
+			if err != nil {
+				return nil, http_errors.InternalServerErrorWithCode(SQL_OPERATION_FAILED, "cannot decode column "+column.Name+": "+err.Error())
+			}
+			if value != nil {
+				document[column.Name] = value
+			}
+		}
+
+		data, err := bson.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+
+		var item T
+		if err := bson.Unmarshal(data, &item); err != nil {
+			return nil, err
+		}
+		receiver = append(receiver, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return receiver, nil
+}
+
+func (repository *SQLRepository[T]) resolveIncludes(ctx context.Context, docs []T, includes []lbq.Include) error {
+	return resolveIncludes(ctx, repository.datasource, repository.schema, reflect.ValueOf(docs), includes)
+}
+
+func (repository *SQLRepository[T]) findRelated(ctx context.Context, foreignKey string, keys []any, scope *lbq.Filter) (reflect.Value, error) {
+	return findRelated(ctx, repository, foreignKey, keys, scope)
+}
+
+func sqlColumnList(columns []*sqlColumn) string {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, quoteSQLIdentifier(column.Name))
+	}
+	return strings.Join(names, ", ")
+}
+
+func sqlWhereClause(condition string) string {
+	if condition == "" {
+		return ""
+	}
+	return " WHERE " + condition
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// repositoryTestTable is the table of RepositoryTestModel
+const repositoryTestTable = `CREATE TABLE %s (
+	"_id" text PRIMARY KEY,
+	"name" text NOT NULL,
+	"email" text,
+	"age" bigint NOT NULL DEFAULT 0,
+	"tags" jsonb,
+	"created" timestamptz,
+	"modified" timestamptz,
+	"deleted" timestamptz
+)`
+
+// TestSQLRepositorySuite runs the shared repository suite against PostgreSQL.
+// It needs a server, e.g. POSTGRES_TEST_URI=postgres://postgres@localhost:5432/postgres
+func TestSQLRepositorySuite(t *testing.T) {
+	uri := os.Getenv("POSTGRES_TEST_URI")
+	if uri == "" {
+		t.Skip("POSTGRES_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("vsaas_rest_test_%d", time.Now().UnixNano())
+	connector, err := NewPostgresConnector(&PostgresConnectorOpts{Name: "test", DSN: uri, Schema: schema})
+	require.NoError(t, err)
+
+	_, err = connector.db.ExecContext(ctx, "CREATE SCHEMA "+quoteSQLIdentifier(schema))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = connector.db.ExecContext(ctx, "DROP SCHEMA "+quoteSQLIdentifier(schema)+" CASCADE")
+		_ = connector.Disconnect()
+	})
+
+	table := connector.tableName(RepositoryTestModel{})
+	runRepositorySuite(t, func(t testing.TB, options RepositoryOptions, docs ...RepositoryTestModel) Repository[RepositoryTestModel] {
+		t.Helper()
+
+		_, err := connector.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table)
+		require.NoError(t, err)
+		_, err = connector.db.ExecContext(ctx, fmt.Sprintf(repositoryTestTable, table))
+		require.NoError(t, err)
+
+		ds := &Datasource{}
+		require.NoError(t, ds.AddConnector(connector))
+
+		repo, err := NewSQLRepository[RepositoryTestModel](ds, options)
+		require.NoError(t, err)
+
+		for _, doc := range docs {
+			_, err := repo.Insert(ctx, doc)
+			require.NoError(t, err)
+		}
+
+		return repo
+	}, "ArrayUpdates")
+}
+
+func TestPostgresConnector_CopiesOptions(t *testing.T) {
+	db, err := sql.Open("pgx", "postgres://localhost:5432/postgres")
+	require.NoError(t, err)
+
+	opts := PostgresConnectorOpts{Name: "pg"}
+	connector := NewPostgresConnectorWithDB(db, &opts)
+	t.Cleanup(func() { _ = connector.Disconnect() })
+
+	assert.Empty(t, opts.Schema, "the caller options are not modified")
+	assert.Equal(t, "public", connector.GetOptions().Schema)
+	assert.Equal(t, `"public"."repository_test_models"`, connector.tableName(RepositoryTestModel{}))
+}
+
+func TestNewSQLRepository_ConnectorMismatch(t *testing.T) {
+	ds := &Datasource{}
+	require.NoError(t, ds.AddConnector(NewMemoryConnector("test")))
+
+	_, err := NewSQLRepository[RepositoryTestModel](ds, RepositoryOptions{})
+	assert.ErrorContains(t, err, "is not a PostgresConnector")
+}
+
+func TestPostgresIndexManager_CreateIndexStatement(t *testing.T) {
+	db, err := sql.Open("pgx", "postgres://localhost:5432/postgres")
+	require.NoError(t, err)
+
+	connector := NewPostgresConnectorWithDB(db, &PostgresConnectorOpts{Name: "pg", Schema: "app"})
+	t.Cleanup(func() { _ = connector.Disconnect() })
+	manager := connector.GetIndexManager()
+
+	tests := []struct {
+		name      string
+		index     PostgresIndexDefinition
+		statement string
+	}{
+		{
+			"simple unique",
+			NewPostgresSimpleIndex("email", true),
+			`CREATE UNIQUE INDEX IF NOT EXISTS "repository_test_models_email_1" ON "app"."repository_test_models" USING btree ("email")`,
+		},
+		{
+			"compound partial",
+			NewPostgresCompoundIndex("name_age", []IndexField{{Name: "name", Order: 1}, {Name: "age", Order: -1}}, false).WithWhere(`"deleted" IS NULL`),
+			`CREATE INDEX IF NOT EXISTS "repository_test_models_name_age" ON "app"."repository_test_models" USING btree ("name", "age" DESC) WHERE "deleted" IS NULL`,
+		},
+		{
+			"gin",
+			NewPostgresGINIndex("tags"),
+			`CREATE INDEX IF NOT EXISTS "repository_test_models_tags_gin" ON "app"."repository_test_models" USING gin ("tags")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := manager.createIndexStatement(RepositoryTestModel{}, tt.index)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statement, statement)
+		})
+	}
+
+	_, err = manager.createIndexStatement(RepositoryTestModel{}, PostgresIndexDefinition{})
+	assert.Error(t, err)
+}
+
+func TestPostgresIndexManager_CompareIndexDetails(t *testing.T) {
+	manager := &PostgresIndexManager{}
+	defined := NewPostgresCompoundIndex("name_age", []IndexField{{Name: "name", Order: 1}, {Name: "age", Order: -1}}, true)
+
+	existing := postgresIndex{Unique: true, Method: "btree", Columns: parsePostgresIndexColumns("name,-age")}
+	assert.Empty(t, manager.compareIndexDetails(defined, existing))
+
+	existing = postgresIndex{Unique: false, Method: "hash", Columns: parsePostgresIndexColumns("name,age")}
+	assert.Equal(t, "field 'age' order mismatch, method differs, unique constraint differs", manager.compareIndexDetails(defined, existing))
+}
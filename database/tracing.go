@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/xompass/vsaas-rest/lbq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the repository spans
+const tracerName = "github.com/xompass/vsaas-rest/database"
+
+// SetTracerProvider makes the repositories of the datasource record a span
+// for each operation, child of the span of the context they get. RestApp sets
+// the provider of its tracing configuration.
+func (receiver *Datasource) SetTracerProvider(provider trace.TracerProvider) {
+	if receiver == nil {
+		return
+	}
+
+	if provider == nil {
+		receiver.tracer = nil
+		return
+	}
+	receiver.tracer = provider.Tracer(tracerName)
+}
+
+// startSpan starts the span of an operation of model on collection when the
+// datasource has a tracer. The span has the shape of the filter, never its values.
+func startSpan(ctx context.Context, ds *Datasource, model string, collection string, operation string, filter *FilterBuilder) (context.Context, trace.Span) {
+	if ds == nil || ds.tracer == nil {
+		return ctx, nil
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemNameMongoDB,
+		semconv.DBCollectionName(collection),
+		semconv.DBOperationName(operation),
+		attribute.String("db.model", model),
+	}
+	if filter != nil && len(filter.where) > 0 {
+		attrs = append(attrs, semconv.DBQueryText(filterShape(filter.where)))
+	}
+
+	return ds.tracer.Start(ctx, model+"."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, recording err when set
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// filterShape returns the where conditions as JSON with every value replaced
+// by "?", e.g. {"age":{"gt":"?"},"name":"?"}, so spans can be grouped by query
+// without exposing the data of the requests
+func filterShape(where []lbq.Where) string {
+	var shape any
+	if len(where) == 1 {
+		shape = whereShape(map[string]any(where[0]))
+	} else {
+		conditions := make([]any, len(where))
+		for i, condition := range where {
+			conditions[i] = whereShape(map[string]any(condition))
+		}
+		shape = map[string]any{"and": conditions}
+	}
+
+	data, err := json.Marshal(shape)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// whereShape replaces the values of value by "?", keeping the field names,
+// operators and nested conditions
+func whereShape(value any) any {
+	switch v := value.(type) {
+	case lbq.Where:
+		return whereShape(map[string]any(v))
+	case map[string]any:
+		shape := make(map[string]any, len(v))
+		for key, item := range v {
+			shape[key] = whereShape(item)
+		}
+		return shape
+	case lbq.AndOrCondition:
+		conditions := make([]any, len(v))
+		for i, condition := range v {
+			conditions[i] = whereShape(map[string]any(condition))
+		}
+		return conditions
+	case []any:
+		// Lists of conditions keep their shape, lists of values become a single "?"
+		conditions := make([]any, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.(map[string]any); !ok {
+				return "?"
+			}
+			conditions = append(conditions, whereShape(item))
+		}
+		return conditions
+	default:
+		return "?"
+	}
+}
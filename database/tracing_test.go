@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/lbq"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+)
+
+func TestFilterShape(t *testing.T) {
+	filter := NewFilter().
+		WithWhere(NewWhere().Eq("name", "Camera 1").Gt("age", 30)).
+		WithWhere(NewWhere().Or(NewWhere().In("tags", []string{"a", "b"}), NewWhere().IsNull("deleted")))
+
+	assert.Equal(t,
+		`{"and":[{"and":[{"name":"?"},{"age":{"gt":"?"}}]},{"or":[{"tags":{"inq":"?"}},{"deleted":{"eq":"?"}}]}]}`,
+		filterShape(filter.where))
+
+	// Conditions decoded from a query string
+	assert.Equal(t, `{"or":[{"name":"?"}],"serial":{"inq":"?"}}`, filterShape([]lbq.Where{{
+		"or":     []any{map[string]any{"name": "x"}},
+		"serial": map[string]any{"inq": []any{"s1", "s2"}},
+	}}))
+}
+
+func TestStartOperation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	ds := &Datasource{}
+	ds.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	var observed []string
+	ds.SetOperationObserver(func(ctx context.Context, model string, operation string, duration time.Duration, err error) {
+		observed = append(observed, model+"."+operation)
+	})
+
+	filter := NewFilter().WithWhere(NewWhere().Eq("serial", "S-123"))
+	_, end := startOperation(context.Background(), ds, "Camera", "cameras", "find", filter)
+	err := errors.New("timeout")
+	end(&err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "Camera.find", span.Name)
+	assert.Contains(t, span.Attributes, semconv.DBCollectionName("cameras"))
+	assert.Contains(t, span.Attributes, semconv.DBOperationName("find"))
+	assert.Contains(t, span.Attributes, semconv.DBQueryText(`{"serial":"?"}`), "the filter values are not recorded")
+	assert.Equal(t, codes.Error, span.Status.Code)
+	assert.Equal(t, []string{"Camera.find"}, observed)
+
+	// Without tracer the operations are only observed
+	ds.SetTracerProvider(nil)
+	exporter.Reset()
+	_, end = startOperation(context.Background(), ds, "Camera", "cameras", "count", nil)
+	err = nil
+	end(&err)
+	assert.Empty(t, exporter.GetSpans())
+	assert.Equal(t, []string{"Camera.find", "Camera.count"}, observed)
+}
@@ -1,7 +1,7 @@
 package rest
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -12,12 +12,14 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 
 	"github.com/xompass/vsaas-rest/http_errors"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // EchoAppConfig contiene todas las configuraciones para el Echo app
 type EchoAppConfig struct {
 	CORS     *CORSConfig
 	Security *SecurityConfig
+	Logger   *slog.Logger // Logger of the error handler. Defaults to slog.Default()
 	// Se pueden agregar más configuraciones aquí en el futuro
 	// Rate limiting, compression, etc.
 }
@@ -63,6 +65,8 @@ func NewEchoApp(config ...EchoAppConfig) *echo.Echo {
 		appConfig = DefaultEchoAppConfig()
 	}
 
+	logger := loggerOrDefault(appConfig.Logger)
+
 	app := echo.New()
 	app.Use(middleware.Recover())
 
@@ -90,6 +94,14 @@ func NewEchoApp(config ...EchoAppConfig) *echo.Echo {
 			corsConfig.AllowOriginFunc = appConfig.CORS.AllowOriginFunc
 		}
 
+		// The CORS middleware answers every OPTIONS request. Only the preflight
+		// requests of the browsers are left to it, so the other ones reach the
+		// OPTIONS endpoints or the default handler of the router.
+		corsConfig.Skipper = func(c echo.Context) bool {
+			req := c.Request()
+			return req.Method == http.MethodOptions && req.Header.Get(echo.HeaderAccessControlRequestMethod) == ""
+		}
+
 		app.Use(middleware.CORSWithConfig(corsConfig))
 	}
 
@@ -98,7 +110,7 @@ func NewEchoApp(config ...EchoAppConfig) *echo.Echo {
 		app.Use(middleware.Secure())
 	}
 
-	app.JSONSerializer = fj4echo.New()
+	app.JSONSerializer = negotiatingSerializer{fj4echo.New()}
 
 	isProduction := os.Getenv("APP_ENV") == "production"
 
@@ -111,11 +123,14 @@ func NewEchoApp(config ...EchoAppConfig) *echo.Echo {
 			return
 		}
 
+		requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+		reqCtx := c.Request().Context()
+
 		// Log the full error internally
 		if e, ok := err.(*errors.Error); ok {
-			log.Printf("Unhandled error: %s\n%s", e.Error(), e.ErrorStack())
+			logger.ErrorContext(reqCtx, "Unhandled error", "error", e.Error(), "uri", c.Request().RequestURI, "stack", e.ErrorStack())
 		} else {
-			log.Printf("Unhandled error: %s: %s", err.Error(), c.Request().RequestURI)
+			logger.ErrorContext(reqCtx, "Unhandled error", "error", err.Error(), "uri", c.Request().RequestURI)
 		}
 
 		statusCode := http.StatusInternalServerError
@@ -136,12 +151,19 @@ func NewEchoApp(config ...EchoAppConfig) *echo.Echo {
 				} else if msg, ok := e.Message.(error); ok {
 					responseError = http_errors.NewErrorResponse(statusCode, errorCode, msg.Error())
 				} else {
-					log.Printf("Unexpected HTTPError: %v", e.Message)
+					logger.WarnContext(reqCtx, "Unexpected HTTPError message", "message", e.Message)
 				}
 			}
 		case http_errors.ErrorResponse:
 			responseError = e
 			statusCode = e.StatusCode
+		case ParamErrors:
+			// Errors of the Accepts parameters of any endpoint
+			responseError = http_errors.BadRequestError("Invalid parameters", []http_errors.ErrorResponse(e))
+			if len(e) == 1 {
+				responseError = e[0]
+			}
+			statusCode = responseError.StatusCode
 		default:
 			if !isProduction {
 				if goErr, ok := e.(*errors.Error); ok {
@@ -153,6 +175,14 @@ func NewEchoApp(config ...EchoAppConfig) *echo.Echo {
 			}
 		}
 
+		// Errors are always sent as JSON, also when a negotiated encoder failed
+		c.Set(responseEncoderKey, nil)
+		c.Response().Header().Del(echo.HeaderContentType)
+
+		responseError.RequestID = requestID
+		if spanContext := trace.SpanContextFromContext(reqCtx); spanContext.IsValid() {
+			responseError.TraceID = spanContext.TraceID().String()
+		}
 		c.JSON(statusCode, responseError)
 	}
 
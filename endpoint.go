@@ -3,14 +3,17 @@ package rest
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/xompass/vsaas-rest/database"
 	"github.com/xompass/vsaas-rest/http_errors"
 )
 
-// ContentType defines the types of content an endpoint can accept
+// ContentType defines the types of content an endpoint can accept or produce
 type ContentType string
 
 const (
@@ -18,12 +21,19 @@ const (
 	ContentTypeMultipart ContentType = "multipart/form-data"
 	ContentTypeFormData  ContentType = "application/x-www-form-urlencoded"
 	ContentTypeAny       ContentType = "*/*" // Accept any content type
+	ContentTypeXML       ContentType = "application/xml"
+	ContentTypeCSV       ContentType = "text/csv"
+	ContentTypeMsgPack   ContentType = "application/msgpack"
+	ContentTypeNDJSON    ContentType = "application/x-ndjson" // One JSON document per line
 )
 
 type RateLimit struct {
-	Max    int
-	Window time.Duration
-	Key    string
+	Max       int
+	Window    time.Duration
+	Key       string             // Fixed counter key. When set, KeyFunc and Shared are ignored
+	KeyFunc   RateLimitKeyFunc   // Dimension the requests are counted by. Defaults to RateLimitByIP
+	Shared    bool               // If true, the endpoints using this limit share their counters
+	Algorithm RateLimitAlgorithm // Defaults to RateLimitSlidingWindow
 }
 
 type EndpointRole interface {
@@ -78,35 +88,58 @@ type Endpoint struct {
 	Method          EndpointMethod
 	Path            string
 	Handler         func(c *EndpointContext) error
-	Disabled        bool       // If true, the endpoint is disabled and will not be registered or accessible.
+	Disabled        bool       // If true, the endpoint answers 404 until RestApp.EnableEndpoint is called
 	BodyParams      func() any // Function that returns a struct for body binding.
 	Scope           string
 	RateLimiter     func(*EndpointContext) RateLimit // Function to get rate limit configuration for the endpoint.
+	RateLimits      []RateLimit                      // Limits applied along with RateLimiter. Setting either replaces RestAppOptions.DefaultRateLimits
+	RateLimitExempt bool                             // If true, RestAppOptions.DefaultRateLimits do not apply to the endpoint
 	Public          bool                             // If true, the endpoint is publicly accessible without authentication.
 	Roles           []EndpointRole                   // List of roles that can access this endpoint.
-	AllowedIncludes map[EndpointRole][]string
-	ActionType      string // e.g., "create", "read", "update", "delete". Used for logging.
-	Model           string // The related model or resource, e.g., "User", "Order", etc. Used for logging
+	AllowedIncludes map[EndpointRole][]string        // Relations each role may include. Nil means no restriction.
+	ActionType      string                           // e.g., "create", "read", "update", "delete". Used for logging.
+	Model           string                           // The related model or resource, e.g., "User", "Order", etc. Used for logging
 	app             *RestApp
 	Accepts         []Param
 	AuditDisabled   bool           // Disable audit logging for this endpoint
 	Timeout         uint16         // Maximum timeout for the endpoint in seconds
 	MetaData        map[string]any // Additional metadata for the endpoint
 
+	// Middlewares run before the endpoint, after the middlewares of its router group
+	Middlewares []MiddlewareFunc
+
+	// Include configuration
+	StripForbiddenIncludes bool // If true, forbidden includes are removed from the filter instead of rejected
+
 	// Content type configuration
 	AcceptedContentTypes []ContentType // Explicitly define what content types this endpoint accepts
+	Produces             []ContentType // Types of the JSON responses, negotiated with the Accept header. Only JSON when empty
 
 	// File upload configuration
 	FileUploadConfig      *FileUploadConfig      // Global file upload settings for this endpoint
 	echoFileUploadHandler *EchoFileUploadHandler // Internal file upload handler for Echo
+
+	// Typed endpoint configuration, see NewTypedEndpoint
+	responseType reflect.Type // Type returned by the typed handler
+	typedErr     error        // Invalid Body or Params type, returned by RestApp.RegisterEndpoint
 }
 
 func (ep *Endpoint) run(c echo.Context) error {
-	if ep.Disabled {
+	if !ep.app.registry.enabled(ep) {
 		return http_errors.NotFoundError("Endpoint not found")
 	}
 
+	response := c.Response()
 	stdContext := c.Request().Context()
+	tracing := ep.app.tracing
+	if tracing != nil {
+		var finish func(status int)
+		stdContext, finish = tracing.startRequest(c, ep)
+		// The access log and the error handler log with the request context
+		c.SetRequest(c.Request().WithContext(stdContext))
+		defer finishRequest(finish, response)
+	}
+
 	if ep.Timeout > 0 {
 		var cancel context.CancelFunc
 		stdContext, cancel = context.WithTimeout(stdContext, time.Duration(ep.Timeout)*time.Second)
@@ -119,76 +152,132 @@ func (ep *Endpoint) run(c echo.Context) error {
 		Endpoint:  ep,
 		App:       ep.app,
 		IpAddress: c.RealIP(),
+		RequestID: RequestIDFromContext(stdContext),
+		startTime: time.Now(),
 	}
+	c.Set(endpointContextKey, ctx)
 
-	// Validate Content-Type if endpoint has body parameters or file upload configuration
-	if err := ep.validateContentType(c); err != nil {
-		return err
+	audited := ep.app.auditPipeline != nil && !ep.AuditDisabled
+	metrics := ep.app.metrics
+	if !audited && metrics == nil && tracing == nil {
+		return ep.serve(ctx)
 	}
 
-	// Process file uploads FIRST if the endpoint has file upload configuration
-	// This prevents conflicts with body parsing when both BodyParams and FileUploadConfig are present
-	var uploadedFiles map[string][]*UploadedFile
-	if ep.FileUploadConfig != nil && ep.echoFileUploadHandler != nil {
-		var err error
-		var formValues map[string][]string
-		uploadedFiles, formValues, err = ep.echoFileUploadHandler.ProcessStreamingFileUploads(c)
-		if err != nil {
-			return err
-		}
-		ctx.UploadedFiles = uploadedFiles
-		ctx.FormValues = formValues
+	if metrics != nil {
+		defer finishRequest(metrics.startRequest(ep, c.Request().Method), response)
+	}
 
-		// Setup cleanup after response if configured
-		if !ep.FileUploadConfig.KeepFilesAfterSend {
-			defer ep.echoFileUploadHandler.CleanupAfterResponse(uploadedFiles)
+	var writer *auditResponseWriter
+	if audited {
+		// Let the repositories report the documents changed by the handler to the audit event
+		if !ep.app.auditLogConfig.DisableChanges {
+			ctx.auditChanges = &auditChangeRecorder{}
+			ctx.context = database.WithChangeRecorder(ctx.context, ctx.auditChanges)
 		}
+
+		writer = newAuditResponseWriter(response, ep.app.auditLogConfig.ResponseBodyLimit)
+		response.Writer = writer
+		defer func() { response.Writer = writer.ResponseWriter }()
 	}
 
-	err := parseBody(ep, ctx)
+	err := ep.serve(ctx)
 	if err != nil {
+		// Send the error response now, so the audit, the metrics and the span
+		// get its status. The error handler ignores the error when Echo passes it again.
+		c.Error(err)
+	}
+
+	if audited {
+		ep.app.auditPipeline.enqueue(ctx.Context(), newAuditEvent(ctx, response.Status, writer.body))
+	}
+	return err
+}
+
+// finishRequest records the outcome of a request with finish, as a 500 when
+// the request panicked. It must be deferred.
+func finishRequest(finish func(status int), response *echo.Response) {
+	if r := recover(); r != nil {
+		finish(http.StatusInternalServerError)
+		panic(r)
+	}
+	finish(response.Status)
+}
+
+// serve runs the stages of the request, from the Content-Type validation to the handler
+func (ep *Endpoint) serve(ctx *EndpointContext) error {
+	c := ctx.EchoCtx
+
+	// Validate Content-Type if endpoint has body parameters or file upload configuration
+	if err := ep.validateContentType(c); err != nil {
 		return err
 	}
 
-	err = processBody(ctx)
-	if err != nil {
+	if err := ep.negotiate(c); err != nil {
 		return err
 	}
 
-	err = parseAllParams(ep, ctx)
-	if err != nil {
+	// Parameters and access are checked before the body is read, so that
+	// rejected requests do not stream file uploads to the disk
+	if err := parseAllParams(ep, ctx); err != nil {
 		return err
 	}
 
-	_, err = ctx.GetFilterParam()
-	if err != nil {
+	if _, err := ctx.GetFilterParam(); err != nil {
 		return err
 	}
 
-	err = ep.app.Authorize(ctx)
+	err := ctx.traceStage("authorize", func() error {
+		if err := ep.app.Authorize(ctx); err != nil {
+			return err
+		}
+
+		if err := ep.app.checkAccess(ctx); err != nil {
+			return err
+		}
+
+		return ep.validateIncludes(ctx)
+	})
 	if err != nil {
 		return err
 	}
 
-	// TODO: validate includes
-	/* if !helpers.ValidateInclude(ctx.Filter, ep.AllowedIncludes[ctx.Role]) {
-		return ErrorResponse{
-			Code: 401,
+	err = ctx.traceStage("parseBody", func() error {
+		// Process file uploads FIRST if the endpoint has file upload configuration
+		// This prevents conflicts with body parsing when both BodyParams and FileUploadConfig are present
+		if ep.FileUploadConfig != nil && ep.echoFileUploadHandler != nil {
+			uploadedFiles, formValues, err := ep.echoFileUploadHandler.ProcessStreamingFileUploads(c)
+			if err != nil {
+				return err
+			}
+			ctx.UploadedFiles = uploadedFiles
+			ctx.FormValues = formValues
 		}
-	} */
 
-	// TODO: Implement rate limiting
+		if err := parseBody(ep, ctx); err != nil {
+			return err
+		}
+		return processBody(ctx)
+	})
+
+	// Setup cleanup after response if configured
+	if ctx.UploadedFiles != nil && !ep.FileUploadConfig.KeepFilesAfterSend {
+		defer ep.echoFileUploadHandler.CleanupAfterResponse(ctx.UploadedFiles)
+	}
 
-	err = checkRateLimit(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err := ep.Handler(ctx); err != nil {
+	err = ctx.traceStage("rateLimit", func() error {
+		return checkRateLimit(ctx)
+	})
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return ctx.traceStage("handler", func() error {
+		return ep.Handler(ctx)
+	})
 }
 
 // validateContentType validates that the request's Content-Type is acceptable for this endpoint
@@ -3,6 +3,7 @@ package rest
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/xompass/vsaas-rest/database"
@@ -20,15 +21,39 @@ type EndpointContext struct {
 	UploadedFiles map[string][]*UploadedFile
 	FormValues    map[string][]string // Non-file form values from multipart forms
 	IpAddress     string
+	RequestID     string // ID of the request, from the X-Request-ID header or generated
 	Principal     Principal
 	Token         AuthToken
 	context       context.Context
+	startTime     time.Time
+	auditChanges  *auditChangeRecorder // Set when the changes of the request are audited
+	auditModelID  any                  // Set by RespondAndLog
 }
 
 func (eCtx *EndpointContext) Context() context.Context {
 	return eCtx.context
 }
 
+// Debugf logs a message with the ID of the request
+func (eCtx *EndpointContext) Debugf(format string, args ...any) {
+	eCtx.App.log(eCtx.context, LogLevelDebug, format, args...)
+}
+
+// Infof logs a message with the ID of the request
+func (eCtx *EndpointContext) Infof(format string, args ...any) {
+	eCtx.App.log(eCtx.context, LogLevelInfo, format, args...)
+}
+
+// Warnf logs a message with the ID of the request
+func (eCtx *EndpointContext) Warnf(format string, args ...any) {
+	eCtx.App.log(eCtx.context, LogLevelWarn, format, args...)
+}
+
+// Errorf logs a message with the ID of the request
+func (eCtx *EndpointContext) Errorf(format string, args ...any) {
+	eCtx.App.log(eCtx.context, LogLevelError, format, args...)
+}
+
 func (eCtx *EndpointContext) ValidateStruct(v any) error {
 	if v == nil {
 		return nil
@@ -77,10 +102,13 @@ func (eCtx *EndpointContext) GetFilterParam() (*database.FilterBuilder, error) {
 }
 
 /**
- * RespondAndLog sends a response and logs the audit if enabled.
+ * RespondAndLog sends a response and logs the audit if enabled. The audit handler
+ * is called before the response is sent, and affectedModelId is recorded in the AuditEvent
+ * of the request.
  * @param response The response data to send.
  * @param affectedModelId The ID of the model affected by the operation, used for logging.
- * @param contentType The type of response to send (JSON, XML, Text, HTML, NoContent).
+ * @param contentType The type of response to send (JSON, XML, Text, HTML, NoContent). JSON responses
+ *        are sent with the type negotiated from the Accept header when the endpoint sets Produces.
  * @param statuCode Optional status code to override the default 200 OK.
  * @return error if any issue occurs while sending the response or logging the audit.
  */
@@ -89,9 +117,11 @@ func (ctx *EndpointContext) RespondAndLog(response any, affectedModelId any, con
 		if ctx.Endpoint.app.auditLogConfig.Enabled && ctx.Endpoint.app.auditLogConfig.Handler != nil {
 			err := ctx.Endpoint.app.auditLogConfig.Handler(ctx, response, affectedModelId)
 			if err != nil {
-				ctx.App.Errorf("Failed to log audit: %v", err)
+				ctx.Logger().Error("Failed to log audit", "error", err)
 			}
 		}
+
+		ctx.auditModelID = affectedModelId
 	}
 
 	status := http.StatusOK
@@ -136,7 +166,8 @@ func (ctx *EndpointContext) RespondAndLog(response any, affectedModelId any, con
 	return nil
 }
 
-// JSON sends a JSON response
+// JSON sends a JSON response, or the type negotiated from the Accept header
+// when the endpoint sets Produces
 func (ctx *EndpointContext) JSON(response any, statusCode ...int) error {
 	status := http.StatusOK
 	if len(statusCode) > 0 {
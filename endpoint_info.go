@@ -0,0 +1,187 @@
+package rest
+
+import (
+	"strings"
+)
+
+// EndpointInfo describes a route of a registered endpoint
+type EndpointInfo struct {
+	Name                 string          `json:"name"`
+	Method               string          `json:"method"` // Upper case HTTP method, e.g. "GET"
+	Path                 string          `json:"path"`   // Route template including the group prefix, e.g. "/api/devices/:id"
+	Model                string          `json:"model,omitempty"`
+	ActionType           string          `json:"actionType,omitempty"`
+	Enabled              bool            `json:"enabled"`
+	Public               bool            `json:"public"`
+	Roles                []string        `json:"roles,omitempty"`
+	Scope                string          `json:"scope,omitempty"`
+	RateLimits           []RateLimitInfo `json:"rateLimits,omitempty"`
+	DynamicRateLimit     bool            `json:"dynamicRateLimit,omitempty"` // Endpoint.RateLimiter computes a limit per request
+	TimeoutSeconds       uint16          `json:"timeoutSeconds,omitempty"`
+	AcceptedContentTypes []ContentType   `json:"acceptedContentTypes,omitempty"`
+	Produces             []ContentType   `json:"produces,omitempty"`
+	AuditDisabled        bool            `json:"auditDisabled,omitempty"`
+	MetaData             map[string]any  `json:"metadata,omitempty"`
+	Endpoint             *Endpoint       `json:"-"`
+}
+
+// RateLimitInfo describes a static rate limit of an endpoint
+type RateLimitInfo struct {
+	Max           int                `json:"max"`
+	WindowSeconds float64            `json:"windowSeconds"`
+	Algorithm     RateLimitAlgorithm `json:"algorithm"`
+	Key           string             `json:"key,omitempty"`
+	Shared        bool               `json:"shared,omitempty"`
+	Default       bool               `json:"default,omitempty"` // From RestAppOptions.DefaultRateLimits
+}
+
+// EndpointQuery selects registered endpoints. Empty fields match every endpoint.
+type EndpointQuery struct {
+	Name       string
+	Path       string         // Route template including the group prefix, e.g. "/api/devices/:id"
+	Method     EndpointMethod // Compared case-insensitively
+	Model      string
+	ActionType string
+}
+
+// matches reports whether the route matches the query
+func (query EndpointQuery) matches(route endpointRoute) bool {
+	ep := route.endpoint
+	return (query.Name == "" || query.Name == ep.Name) &&
+		(query.Path == "" || query.Path == route.path) &&
+		(query.Method == "" || strings.EqualFold(string(query.Method), string(ep.Method))) &&
+		(query.Model == "" || query.Model == ep.Model) &&
+		(query.ActionType == "" || query.ActionType == ep.ActionType)
+}
+
+// Endpoint returns the registered endpoint named name
+func (receiver *RestApp) Endpoint(name string) (*Endpoint, bool) {
+	receiver.registry.mu.RLock()
+	defer receiver.registry.mu.RUnlock()
+
+	ep, ok := receiver.registry.byName[name]
+	return ep, ok
+}
+
+// Endpoints describes every registered route, in registration order
+func (receiver *RestApp) Endpoints() []EndpointInfo {
+	return receiver.FindEndpoints(EndpointQuery{})
+}
+
+// FindEndpoints describes the registered routes matching query, in
+// registration order. An endpoint registered under several groups has one
+// entry per route.
+func (receiver *RestApp) FindEndpoints(query EndpointQuery) []EndpointInfo {
+	var infos []EndpointInfo
+	for _, route := range receiver.registry.snapshot() {
+		if query.matches(route) {
+			infos = append(infos, receiver.endpointInfo(route))
+		}
+	}
+	return infos
+}
+
+func (receiver *RestApp) endpointInfo(route endpointRoute) EndpointInfo {
+	ep := route.endpoint
+	info := EndpointInfo{
+		Name:                 ep.Name,
+		Method:               strings.ToUpper(string(ep.Method)),
+		Path:                 route.path,
+		Model:                ep.Model,
+		ActionType:           ep.ActionType,
+		Enabled:              receiver.registry.enabled(ep),
+		Public:               ep.Public,
+		Scope:                ep.Scope,
+		DynamicRateLimit:     ep.RateLimiter != nil,
+		TimeoutSeconds:       ep.Timeout,
+		AcceptedContentTypes: ep.getAcceptedContentTypes(),
+		Produces:             ep.Produces,
+		AuditDisabled:        ep.AuditDisabled,
+		MetaData:             ep.MetaData,
+		Endpoint:             ep,
+	}
+
+	for _, role := range ep.Roles {
+		info.Roles = append(info.Roles, role.RoleName())
+	}
+
+	limits, isDefault := ep.RateLimits, false
+	if ep.RateLimiter == nil && len(limits) == 0 && !ep.RateLimitExempt {
+		limits, isDefault = receiver.options.DefaultRateLimits, true
+	}
+	for _, limit := range limits {
+		info.RateLimits = append(info.RateLimits, RateLimitInfo{
+			Max:           limit.Max,
+			WindowSeconds: limit.Window.Seconds(),
+			Algorithm:     limit.algorithm(),
+			Key:           limit.Key,
+			Shared:        limit.Shared,
+			Default:       isDefault,
+		})
+	}
+
+	return info
+}
+
+// EndpointRegistryConfig configures the endpoint that lists the registered
+// routes, see ServeEndpointRegistry
+type EndpointRegistryConfig struct {
+	Name  string         // Name of the endpoint. Defaults to "ListEndpoints"
+	Path  string         // Defaults to "/endpoints"
+	Group *RouterGroup   // Group the endpoint is registered under. Defaults to the root of the application
+	Roles []EndpointRole // Roles allowed to list the routes. Any authenticated principal when empty
+}
+
+// ServeEndpointRegistry registers an endpoint that lists the registered
+// routes as EndpointInfo, e.g. for gateway configuration generators and
+// security reviews. The name, path, method, model and actionType query
+// parameters filter the list like EndpointQuery. The endpoint is not public.
+func (receiver *RestApp) ServeEndpointRegistry(config EndpointRegistryConfig) error {
+	if config.Name == "" {
+		config.Name = "ListEndpoints"
+	}
+
+	if config.Path == "" {
+		config.Path = "/endpoints"
+	}
+
+	if config.Group == nil {
+		config.Group = receiver.Group("")
+	}
+
+	return receiver.RegisterEndpoint(&Endpoint{
+		Name:       config.Name,
+		Method:     MethodGET,
+		Path:       config.Path,
+		Roles:      config.Roles,
+		ActionType: string(ActionTypeRead),
+		Accepts: []Param{
+			NewQueryParam("name", QueryParamTypeString),
+			NewQueryParam("path", QueryParamTypeString),
+			NewQueryParam("method", QueryParamTypeString),
+			NewQueryParam("model", QueryParamTypeString),
+			NewQueryParam("actionType", QueryParamTypeString),
+		},
+		Handler: func(ctx *EndpointContext) error {
+			query := EndpointQuery{
+				Name:       queryString(ctx, "name"),
+				Path:       queryString(ctx, "path"),
+				Method:     EndpointMethod(queryString(ctx, "method")),
+				Model:      queryString(ctx, "model"),
+				ActionType: queryString(ctx, "actionType"),
+			}
+
+			endpoints := receiver.FindEndpoints(query)
+			if endpoints == nil {
+				endpoints = []EndpointInfo{}
+			}
+			return ctx.JSON(endpoints)
+		},
+	}, config.Group)
+}
+
+// queryString returns the parsed string query parameter name, or an empty string
+func queryString(ctx *EndpointContext, name string) string {
+	value, _ := ctx.ParsedQuery[name].(string)
+	return value
+}
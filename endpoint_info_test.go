@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindEndpoints(t *testing.T) {
+	app := NewRestApp(RestAppOptions{
+		LogLevel:          LogLevelError,
+		DefaultRateLimits: []RateLimit{{Max: 100, Window: time.Minute}},
+	})
+	api := app.Group("/api")
+
+	noContent := func(c *EndpointContext) error { return c.NoContent() }
+	getDevice := &Endpoint{
+		Name: "GetDevice", Method: MethodGET, Path: "/devices/:id", Handler: noContent,
+		Model: "Device", ActionType: string(ActionTypeRead), Roles: []EndpointRole{testRole("admin")},
+		Timeout: 5, MetaData: map[string]any{"team": "video"},
+	}
+	require.NoError(t, app.RegisterEndpoints([]*Endpoint{
+		getDevice,
+		{Name: "CreateDevice", Method: MethodPOST, Path: "/devices", Handler: noContent, Model: "Device", ActionType: "write",
+			RateLimits: []RateLimit{{Max: 10, Window: time.Second, Algorithm: RateLimitTokenBucket, Shared: true}}},
+		{Name: "Ping", Method: MethodGET, Path: "/ping", Handler: noContent, Public: true, RateLimitExempt: true},
+	}, api))
+	require.NoError(t, app.DisableEndpoint("CreateDevice"))
+
+	ep, ok := app.Endpoint("GetDevice")
+	require.True(t, ok)
+	assert.Same(t, getDevice, ep)
+	_, ok = app.Endpoint("Missing")
+	assert.False(t, ok)
+
+	assert.Len(t, app.Endpoints(), 3)
+	assert.Len(t, app.FindEndpoints(EndpointQuery{Model: "Device"}), 2)
+	assert.Empty(t, app.FindEndpoints(EndpointQuery{Model: "Device", Method: "delete"}))
+
+	infos := app.FindEndpoints(EndpointQuery{Path: "/api/devices/:id", Method: "get"})
+	require.Len(t, infos, 1)
+	assert.Same(t, getDevice, infos[0].Endpoint)
+	infos[0].Endpoint = nil // Endpoints hold funcs, which are never deep equal
+	assert.Equal(t, EndpointInfo{
+		Name: "GetDevice", Method: "GET", Path: "/api/devices/:id", Model: "Device", ActionType: "read",
+		Enabled: true, Roles: []string{"admin"}, TimeoutSeconds: 5,
+		RateLimits: []RateLimitInfo{{Max: 100, WindowSeconds: 60, Algorithm: RateLimitSlidingWindow, Default: true}},
+		MetaData:   map[string]any{"team": "video"},
+	}, infos[0])
+
+	infos = app.FindEndpoints(EndpointQuery{Name: "CreateDevice"})
+	require.Len(t, infos, 1)
+	assert.False(t, infos[0].Enabled)
+	assert.Equal(t, []RateLimitInfo{{Max: 10, WindowSeconds: 1, Algorithm: RateLimitTokenBucket, Shared: true}}, infos[0].RateLimits)
+
+	infos = app.FindEndpoints(EndpointQuery{Name: "Ping"})
+	require.Len(t, infos, 1)
+	assert.True(t, infos[0].Public)
+	assert.Empty(t, infos[0].RateLimits, "exempt endpoints do not get the default limits")
+}
+
+func TestServeEndpointRegistry(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1", role: "admin"}, testToken{valid: true})
+	api := app.Group("/api")
+
+	noContent := func(c *EndpointContext) error { return c.NoContent() }
+	require.NoError(t, app.RegisterEndpoints([]*Endpoint{
+		{Name: "GetDevice", Method: MethodGET, Path: "/devices/:id", Handler: noContent, Model: "Device"},
+		{Name: "GetCamera", Method: MethodGET, Path: "/cameras/:id", Handler: noContent, Model: "Camera"},
+	}, api))
+	require.NoError(t, app.ServeEndpointRegistry(EndpointRegistryConfig{
+		Group: api,
+		Path:  "/admin/endpoints",
+		Roles: []EndpointRole{testRole("admin")},
+	}))
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/admin/endpoints?model=Device", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var infos []EndpointInfo
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&infos))
+	require.Len(t, infos, 1)
+	assert.Equal(t, "GetDevice", infos[0].Name)
+	assert.Equal(t, "/api/devices/:id", infos[0].Path)
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/admin/endpoints?model=Missing", nil))
+	require.NoError(t, err)
+	infos = nil
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&infos))
+	assert.NotNil(t, infos, "no match is an empty list")
+	assert.Empty(t, infos)
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/admin/endpoints", nil))
+	require.NoError(t, err)
+	infos = nil
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&infos))
+	assert.Len(t, infos, 3, "the registry endpoint lists itself")
+
+	app.authorizer = authorizerFor(testPrincipal{id: "u2", role: "viewer"}, testToken{valid: true})
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/admin/endpoints", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
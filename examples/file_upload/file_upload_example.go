@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	rest "github.com/xompass/vsaas-rest"
@@ -134,7 +135,7 @@ func main() {
 	log.Println(`  -F "documents=@/path/to/your/document.pdf" \`)
 	log.Println(`  -F "documents=@/path/to/another/document.pdf"`)
 
-	if err := app.Start(); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := app.Run(context.Background()); err != nil {
+		log.Fatalf("Server stopped: %v", err)
 	}
 }
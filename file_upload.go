@@ -1,9 +1,10 @@
 package rest
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -49,7 +50,10 @@ type UploadedFile struct {
 
 // StreamingFileUploadHandler handles file uploads with Echo's multipart capabilities
 type EchoFileUploadHandler struct {
-	config *FileUploadConfig
+	config   *FileUploadConfig
+	logger   *slog.Logger // Set by RegisterEndpoint. Defaults to slog.Default()
+	metrics  *appMetrics  // Set by RegisterEndpoint when the metrics are enabled
+	endpoint string       // Name of the endpoint, the label of the metrics
 }
 
 // NewEchoFileUploadHandler creates a new Echo file upload handler
@@ -72,7 +76,13 @@ func NewEchoFileUploadHandler(config *FileUploadConfig) *EchoFileUploadHandler {
 }
 
 // ProcessStreamingFileUploads processes multipart form data using Echo's multipart parsing with size limits
-func (h *EchoFileUploadHandler) ProcessStreamingFileUploads(c echo.Context) (map[string][]*UploadedFile, map[string][]string, error) {
+func (h *EchoFileUploadHandler) ProcessStreamingFileUploads(c echo.Context) (_ map[string][]*UploadedFile, _ map[string][]string, err error) {
+	defer func() {
+		if err != nil {
+			h.metrics.uploadRejected(h.endpoint)
+		}
+	}()
+
 	// Get content type and verify it's multipart
 	contentType := c.Request().Header.Get("Content-Type")
 	if !strings.HasPrefix(contentType, "multipart/form-data") {
@@ -130,7 +140,7 @@ func (h *EchoFileUploadHandler) ProcessStreamingFileUploads(c echo.Context) (map
 		}
 
 		// Process the file part with streaming
-		uploadedFile, err := h.processStreamingFile(fieldName, part)
+		uploadedFile, err := h.processStreamingFile(c.Request().Context(), fieldName, part)
 		if err != nil {
 			part.Close()
 			h.cleanupFiles(uploadedFiles)
@@ -152,6 +162,12 @@ func (h *EchoFileUploadHandler) ProcessStreamingFileUploads(c echo.Context) (map
 		return nil, nil, err
 	}
 
+	for fieldName, files := range uploadedFiles {
+		for _, file := range files {
+			h.metrics.uploaded(h.endpoint, fieldName, file.Size)
+		}
+	}
+
 	return uploadedFiles, formValues, nil
 }
 
@@ -180,7 +196,7 @@ func (h *EchoFileUploadHandler) validateFieldRequirements(uploadedFiles map[stri
 }
 
 // processStreamingFile processes a single file part with streaming validation
-func (h *EchoFileUploadHandler) processStreamingFile(fieldName string, part *multipart.Part) (*UploadedFile, error) {
+func (h *EchoFileUploadHandler) processStreamingFile(ctx context.Context, fieldName string, part *multipart.Part) (*UploadedFile, error) {
 	filename := part.FileName()
 
 	// Get file extension
@@ -208,7 +224,7 @@ func (h *EchoFileUploadHandler) processStreamingFile(fieldName string, part *mul
 		filePath = filepath.Join(h.config.TempPath, uniqueFilename)
 	} else {
 		filePath = filepath.Join(h.config.UploadPath, uniqueFilename)
-		log.Println("Saving file to:", filePath)
+		loggerOrDefault(h.logger).DebugContext(ctx, "Saving uploaded file", "field", fieldName, "path", filePath)
 	}
 
 	// Create the destination file
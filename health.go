@@ -0,0 +1,190 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultLivenessPath       = "/healthz"
+	defaultReadinessPath      = "/readyz"
+	defaultHealthCheckTimeout = 2 * time.Second
+)
+
+// Statuses of the health responses and of their checks
+const (
+	HealthStatusOK           = "ok"
+	HealthStatusFail         = "fail"
+	HealthStatusShuttingDown = "shutting_down"
+)
+
+// HealthConfig configures the liveness and readiness endpoints, meant for the
+// probes of Kubernetes and load balancers. They are not authenticated.
+type HealthConfig struct {
+	Enabled       bool
+	LivenessPath  string        // Defaults to /healthz
+	ReadinessPath string        // Defaults to /readyz
+	Timeout       time.Duration // Max duration of each check. Defaults to 2s
+
+	// ShutdownDelay is how long Shutdown keeps serving requests after the
+	// readiness endpoint starts failing, so the load balancers stop sending
+	// traffic before the server stops accepting connections
+	ShutdownDelay time.Duration
+}
+
+// HealthCheck reports whether a dependency of the application works. It
+// should return once ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// HealthCheckResult is the outcome of a check in a health response
+type HealthCheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthResponse is the body of the liveness and readiness endpoints, served
+// with a 200 status when Status is ok and a 503 otherwise
+type HealthResponse struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// namedHealthCheck is a check registered with AddLivenessCheck or AddReadinessCheck
+type namedHealthCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// AddLivenessCheck registers a check of the liveness endpoint. Keep them to
+// the state of the process: a dependency down should not restart it.
+func (receiver *RestApp) AddLivenessCheck(name string, check HealthCheck) {
+	receiver.livenessChecks = append(receiver.livenessChecks, namedHealthCheck{name: name, check: check})
+}
+
+// AddReadinessCheck registers a check of the readiness endpoint, run along
+// with the pings of the datasource connectors and Redis
+func (receiver *RestApp) AddReadinessCheck(name string, check HealthCheck) {
+	receiver.readinessChecks = append(receiver.readinessChecks, namedHealthCheck{name: name, check: check})
+}
+
+// registerHealthEndpoints adds the liveness and readiness endpoints to the server
+func (receiver *RestApp) registerHealthEndpoints(config HealthConfig) {
+	livenessPath := config.LivenessPath
+	if livenessPath == "" {
+		livenessPath = defaultLivenessPath
+	}
+
+	readinessPath := config.ReadinessPath
+	if readinessPath == "" {
+		readinessPath = defaultReadinessPath
+	}
+
+	receiver.EchoApp.GET(livenessPath, func(c echo.Context) error {
+		return receiver.respondHealth(c, config.Timeout, receiver.livenessChecks)
+	})
+
+	receiver.EchoApp.GET(readinessPath, func(c echo.Context) error {
+		if receiver.shuttingDown.Load() {
+			return c.JSON(http.StatusServiceUnavailable, HealthResponse{Status: HealthStatusShuttingDown})
+		}
+		return receiver.respondHealth(c, config.Timeout, receiver.dependencyChecks())
+	})
+}
+
+// dependencyChecks returns the pings of the datasource connectors and Redis,
+// followed by the readiness checks
+func (receiver *RestApp) dependencyChecks() []namedHealthCheck {
+	var checks []namedHealthCheck
+	for _, connector := range receiver.Datasource.GetConnectors() {
+		checks = append(checks, namedHealthCheck{
+			name:  connector.GetName(),
+			check: func(context.Context) error { return connector.Ping() },
+		})
+	}
+
+	redisClient := receiver.redisClient
+	if redisClient == nil {
+		redisClient = receiver.options.RedisClient
+	}
+	if redisClient != nil {
+		checks = append(checks, namedHealthCheck{
+			name:  "redis",
+			check: func(ctx context.Context) error { return redisClient.Ping(ctx).Err() },
+		})
+	}
+
+	return append(checks, receiver.readinessChecks...)
+}
+
+// respondHealth runs checks concurrently and sends their results
+func (receiver *RestApp) respondHealth(c echo.Context, timeout time.Duration, checks []namedHealthCheck) error {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	response := HealthResponse{Status: HealthStatusOK}
+	if len(checks) > 0 {
+		response.Checks = make(map[string]HealthCheckResult, len(checks))
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := runHealthCheck(c.Request().Context(), timeout, check.check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[check.name] = result
+			if result.Status != HealthStatusOK {
+				response.Status = HealthStatusFail
+				receiver.logger.WarnContext(c.Request().Context(), "Health check failed", "check", check.name, "error", result.Error)
+			}
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if response.Status != HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, response)
+}
+
+// runHealthCheck runs check with a timeout. Checks that ignore their context,
+// like Connector.Ping, are abandoned when the timeout expires.
+func runHealthCheck(ctx context.Context, timeout time.Duration, check HealthCheck) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.Errorf("timed out after %s", timeout)
+	}
+
+	result := HealthCheckResult{
+		Status:    HealthStatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = HealthStatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/database"
+)
+
+// stubConnector is a connector whose Ping succeeds after delay
+type stubConnector struct {
+	name  string
+	delay atomic.Int64
+}
+
+func (c *stubConnector) Ping() error {
+	time.Sleep(time.Duration(c.delay.Load()))
+	return nil
+}
+func (c *stubConnector) Disconnect() error       { return nil }
+func (c *stubConnector) GetName() string         { return c.name }
+func (c *stubConnector) GetDatabaseName() string { return c.name }
+func (c *stubConnector) GetDriver() any          { return nil }
+
+func TestHealthEndpoints(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	mongo := &stubConnector{name: "mongodb"}
+	ds := &database.Datasource{}
+	require.NoError(t, ds.AddConnector(mongo))
+	require.NoError(t, ds.AddConnector(database.NewMemoryConnector("memory")))
+
+	app := NewRestApp(RestAppOptions{
+		LogLevel:    LogLevelError,
+		Datasource:  ds,
+		RedisClient: client,
+		Health:      &HealthConfig{Enabled: true, Timeout: 50 * time.Millisecond},
+	})
+
+	var cacheErr error
+	app.AddReadinessCheck("cache", func(ctx context.Context) error { return cacheErr })
+
+	get := func(path string) (int, HealthResponse) {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		var body HealthResponse
+		require.NoError(t, sonic.ConfigDefault.NewDecoder(res.Body).Decode(&body))
+		return res.StatusCode, body
+	}
+
+	status, body := get("/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, HealthStatusOK, body.Status)
+	assert.ElementsMatch(t, []string{"mongodb", "memory", "redis", "cache"}, mapKeys(body.Checks))
+	assert.Equal(t, HealthStatusOK, body.Checks["redis"].Status)
+
+	mongo.delay.Store(int64(time.Second))
+	cacheErr = errors.New("cache unavailable")
+	status, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, HealthStatusFail, body.Status)
+	assert.Equal(t, HealthStatusFail, body.Checks["mongodb"].Status)
+	assert.Contains(t, body.Checks["mongodb"].Error, "timed out", "slow pings time out")
+	assert.Less(t, body.Checks["mongodb"].LatencyMs, 500.0)
+	assert.Equal(t, "cache unavailable", body.Checks["cache"].Error)
+	assert.Equal(t, HealthStatusOK, body.Checks["redis"].Status)
+
+	status, body = get("/healthz")
+	assert.Equal(t, http.StatusOK, status, "liveness does not depend on the dependencies")
+	assert.Equal(t, HealthStatusOK, body.Status)
+	assert.Empty(t, body.Checks)
+
+	mongo.delay.Store(0)
+	cacheErr = nil
+	require.NoError(t, app.Shutdown(context.Background()))
+	status, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, HealthStatusShuttingDown, body.Status)
+}
+
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
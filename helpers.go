@@ -3,7 +3,6 @@ package rest
 import (
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -60,7 +59,7 @@ func parseBody(e *Endpoint, ec *EndpointContext) error {
 	}
 
 	if err := bindFormToStruct(ec, form); err != nil {
-		log.Println("cannot bind to struct", err)
+		ec.Logger().Debug("Cannot bind the request body", "error", err)
 		return http_errors.BadRequestError("Failed to bind request body", fmt.Sprintf("Failed to bind request body: %s", err.Error()))
 	}
 
@@ -241,7 +240,7 @@ func parseParam(ctx *EndpointContext, param Param) (any, error) {
 	case string(QueryParamTypeFilter):
 		filter, err := lbq.ParseFilter(raw)
 		if err != nil {
-			log.Println("Error parsing filter:", err)
+			ctx.Logger().Debug("Cannot parse the filter", "param", param.name, "error", err)
 			return nil, http_errors.BadRequestError("Invalid filter", "Parameter "+param.name+" must be a valid filter: "+err.Error())
 		}
 
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestParamErrors_BadRequest(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+
+	require.NoError(t, app.RegisterEndpoint(&Endpoint{
+		Name:   "GetDevice",
+		Method: MethodGET,
+		Path:   "/devices/:id",
+		Accepts: []Param{
+			NewPathParam("id", PathParamTypeObjectID),
+			NewQueryParam("limit", QueryParamTypeInt),
+		},
+		Handler: func(ctx *EndpointContext) error { return ctx.NoContent() },
+	}, app.Group("/api")))
+
+	get := func(path string) (int, http_errors.ErrorResponse) {
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		var body http_errors.ErrorResponse
+		if res.StatusCode != http.StatusNoContent {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		}
+		return res.StatusCode, body
+	}
+
+	status, _ := get("/api/devices/" + bson.NewObjectID().Hex() + "?limit=10")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	status, body := get("/api/devices/" + bson.NewObjectID().Hex() + "?limit=ten")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Parameter limit must be an integer", body.Details, "a single error is sent as is")
+
+	status, body = get("/api/devices/invalid?limit=ten")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Invalid parameters", body.Message)
+	assert.Len(t, body.Details, 2)
+}
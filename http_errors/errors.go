@@ -4,7 +4,9 @@ type ErrorResponse struct {
 	Message    string `json:"message"`
 	StatusCode int    `json:"statusCode"`
 	ErrorCode  string `json:"errorCode"`
-	Details    any    `json:"details,omitempty"` // Optional field for additional error details
+	Details    any    `json:"details,omitempty"`   // Optional field for additional error details
+	RequestID  string `json:"requestId,omitempty"` // Set by the error handler from the X-Request-ID of the request
+	TraceID    string `json:"traceId,omitempty"`   // Set by the error handler when the request is traced
 } // @name ErrorResponse
 
 func (e ErrorResponse) Error() string {
@@ -91,3 +93,11 @@ func InternalServerError(message string, details ...any) ErrorResponse {
 func InternalServerErrorWithCode(errorCode string, message string, details ...any) ErrorResponse {
 	return NewErrorResponse(500, errorCode, message, details...)
 }
+
+func ServiceUnavailableError(message string, details ...any) ErrorResponse {
+	return NewErrorResponse(503, "SERVICE_UNAVAILABLE", message, details...)
+}
+
+func ServiceUnavailableErrorWithCode(errorCode string, message string, details ...any) ErrorResponse {
+	return NewErrorResponse(503, errorCode, message, details...)
+}
@@ -0,0 +1,107 @@
+package rest
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/xompass/vsaas-rest/http_errors"
+	"github.com/xompass/vsaas-rest/lbq"
+)
+
+const FORBIDDEN_INCLUDE = "FORBIDDEN_INCLUDE"
+
+// validateIncludes checks the relations requested in the filter against
+// Endpoint.AllowedIncludes for the caller role. Nested includes are matched
+// by their dotted path, e.g. "camera.site". An entry ending in ".*" allows the
+// relation and any nested relation below it, and "*" allows everything.
+//
+// Forbidden relations are rejected with a 403, or removed from the filter when
+// Endpoint.StripForbiddenIncludes is set.
+func (ep *Endpoint) validateIncludes(ctx *EndpointContext) error {
+	if ep.AllowedIncludes == nil {
+		return nil
+	}
+
+	filter, err := ctx.GetFilterParam()
+	if err != nil {
+		return err
+	}
+
+	if len(filter.GetIncludes()) == 0 {
+		return nil
+	}
+
+	allowed := ep.allowedIncludesFor(ctx)
+	includes, forbidden := filterIncludes(filter.GetIncludes(), "", allowed)
+	if len(forbidden) == 0 {
+		return nil
+	}
+
+	if !ep.StripForbiddenIncludes {
+		return http_errors.ForbiddenErrorWithCode(FORBIDDEN_INCLUDE,
+			"Some of the requested relations cannot be included",
+			map[string][]string{"relations": forbidden})
+	}
+
+	filter.SetIncludes(includes)
+	return nil
+}
+
+// allowedIncludesFor collects the includes allowed for the principal role,
+// including those of every role it implies through the app role hierarchy.
+func (ep *Endpoint) allowedIncludesFor(ctx *EndpointContext) []string {
+	role := ""
+	if ctx.Principal != nil {
+		role = ctx.Principal.GetPrincipalRole()
+	}
+
+	var allowed []string
+	for endpointRole, relations := range ep.AllowedIncludes {
+		if endpointRole == nil {
+			continue
+		}
+		if ep.app.hasAnyRole(role, []EndpointRole{endpointRole}) {
+			allowed = append(allowed, relations...)
+		}
+	}
+
+	return allowed
+}
+
+func filterIncludes(includes []lbq.Include, prefix string, allowed []string) ([]lbq.Include, []string) {
+	var result []lbq.Include
+	var forbidden []string
+
+	for _, include := range includes {
+		path := prefix + include.Relation
+		if !isIncludeAllowed(path, allowed) {
+			forbidden = append(forbidden, path)
+			continue
+		}
+
+		if include.Scope != nil && len(include.Scope.Include) > 0 {
+			nested, nestedForbidden := filterIncludes(include.Scope.Include, path+".", allowed)
+			forbidden = append(forbidden, nestedForbidden...)
+
+			scope := *include.Scope
+			scope.Include = nested
+			include.Scope = &scope
+		}
+
+		result = append(result, include)
+	}
+
+	return result, forbidden
+}
+
+func isIncludeAllowed(path string, allowed []string) bool {
+	return slices.ContainsFunc(allowed, func(entry string) bool {
+		if entry == "*" || entry == path {
+			return true
+		}
+		if parent, ok := strings.CutSuffix(entry, ".*"); ok {
+			return path == parent || strings.HasPrefix(path, parent+".")
+		}
+		return false
+	})
+}
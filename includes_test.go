@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/database"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"github.com/xompass/vsaas-rest/lbq"
+)
+
+func runIncludeEndpoint(t *testing.T, ep *Endpoint, role string, filter string) (*database.FilterBuilder, error) {
+	t.Helper()
+
+	app := createTestApp()
+	app.roleHierarchy = StaticRoleHierarchy{"admin": {"operator"}}
+	app.authorizer = authorizerFor(testPrincipal{id: "1", role: role}, testToken{valid: true})
+
+	var received *database.FilterBuilder
+	ep.Method = MethodGET
+	ep.Path = "/devices"
+	ep.Accepts = []Param{NewQueryParam("filter", QueryParamTypeFilter)}
+	ep.Handler = func(c *EndpointContext) error {
+		var err error
+		received, err = c.GetFilterParam()
+		return err
+	}
+	ep.app = app
+
+	req := httptest.NewRequest(http.MethodGet, "/devices?filter="+url.QueryEscape(filter), nil)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	return received, ep.run(c)
+}
+
+func includePaths(includes []lbq.Include, prefix string) []string {
+	var paths []string
+	for _, include := range includes {
+		paths = append(paths, prefix+include.Relation)
+		if include.Scope != nil {
+			paths = append(paths, includePaths(include.Scope.Include, prefix+include.Relation+".")...)
+		}
+	}
+	return paths
+}
+
+func TestValidateIncludes_NoRestriction(t *testing.T) {
+	filter, err := runIncludeEndpoint(t, &Endpoint{Name: "devices"}, "viewer", `{"include":["camera","site"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"camera", "site"}, includePaths(filter.GetIncludes(), ""))
+}
+
+func TestValidateIncludes_Rejects(t *testing.T) {
+	ep := &Endpoint{
+		Name: "devices",
+		AllowedIncludes: map[EndpointRole][]string{
+			testRole("viewer"): {"camera"},
+		},
+	}
+
+	_, err := runIncludeEndpoint(t, ep, "viewer", `{"include":[{"relation":"camera","scope":{"include":"site"}},"owner"]}`)
+	require.Error(t, err)
+
+	errResponse, ok := err.(http_errors.ErrorResponse)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusForbidden, errResponse.StatusCode)
+	assert.Equal(t, FORBIDDEN_INCLUDE, errResponse.ErrorCode)
+	assert.Equal(t, map[string][]string{"relations": {"camera.site", "owner"}}, errResponse.Details)
+}
+
+func TestValidateIncludes_Strips(t *testing.T) {
+	ep := &Endpoint{
+		Name:                   "devices",
+		StripForbiddenIncludes: true,
+		AllowedIncludes: map[EndpointRole][]string{
+			testRole("viewer"): {"camera"},
+		},
+	}
+
+	filter, err := runIncludeEndpoint(t, ep, "viewer", `{"include":[{"relation":"camera","scope":{"include":"site"}},"owner"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"camera"}, includePaths(filter.GetIncludes(), ""))
+}
+
+func TestValidateIncludes_WildcardsAndHierarchy(t *testing.T) {
+	ep := &Endpoint{
+		Name: "devices",
+		AllowedIncludes: map[EndpointRole][]string{
+			testRole("viewer"):   {"camera"},
+			testRole("operator"): {"owner.*"},
+		},
+	}
+
+	_, err := runIncludeEndpoint(t, ep, "operator", `{"include":[{"relation":"owner","scope":{"include":"company"}}]}`)
+	assert.NoError(t, err)
+
+	_, err = runIncludeEndpoint(t, ep, "operator", `{"include":"camera"}`)
+	assert.Error(t, err)
+
+	// admin implies operator, so it inherits the operator includes
+	_, err = runIncludeEndpoint(t, ep, "admin", `{"include":"owner"}`)
+	assert.NoError(t, err)
+}
@@ -1,7 +1,7 @@
 package lbq
 
 import (
-	"log"
+	"log/slog"
 	"strings"
 
 	"github.com/go-errors/errors"
@@ -167,7 +167,7 @@ func getRawValue(v *fastjson.Value) any {
 		return value
 	case fastjson.TypeObject:
 	default:
-		log.Println(valueType.String())
+		slog.Debug("Unsupported filter value type", "type", valueType.String())
 	}
 
 	return nil
@@ -310,7 +310,7 @@ func parseIncludeValue(include *fastjson.Value) ([]Include, error) {
 func parseFilterValue(parsedFilter *fastjson.Value) (*Filter, error) {
 
 	if parsedFilter.Type() != fastjson.TypeObject {
-		log.Println("Invalid filter type:", parsedFilter.Type())
+		slog.Debug("Invalid filter type", "type", parsedFilter.Type().String())
 		return nil, errors.New("invalid filter")
 	}
 	whereValue := parsedFilter.Get("where")
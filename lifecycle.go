@@ -0,0 +1,107 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownTimeout is the default of RestAppOptions.ShutdownTimeout
+const defaultShutdownTimeout = 30 * time.Second
+
+// LifecycleHook starts or stops a resource of the application, see
+// RestApp.OnStart and RestApp.OnShutdown
+type LifecycleHook func(ctx context.Context) error
+
+// OnStart registers a hook run by Run before the server starts listening, in
+// registration order. If a hook fails, Run shuts the application down and
+// returns its error.
+func (receiver *RestApp) OnStart(hook LifecycleHook) {
+	receiver.startHooks = append(receiver.startHooks, hook)
+}
+
+// OnShutdown registers a hook run by Shutdown once the in-flight requests are
+// done, in reverse registration order, before the datasource and Redis are closed
+func (receiver *RestApp) OnShutdown(hook LifecycleHook) {
+	receiver.shutdownHooks = append(receiver.shutdownHooks, hook)
+}
+
+// Run runs the OnStart hooks and serves the application until ctx is done or
+// the process gets SIGINT or SIGTERM, then shuts it down gracefully. It
+// returns nil after a graceful shutdown, or the error that stopped it.
+func (receiver *RestApp) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, hook := range receiver.startHooks {
+		if err := hook(ctx); err != nil {
+			return errors.Join(err, receiver.Shutdown(context.Background()))
+		}
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- receiver.Start()
+	}()
+
+	select {
+	case err := <-serverErr:
+		// The server could not listen
+		return errors.Join(err, receiver.Shutdown(context.Background()))
+	case <-ctx.Done():
+	}
+
+	// A second signal stops the process without waiting for the shutdown
+	stop()
+	receiver.Infof("Shutting down")
+
+	err := receiver.Shutdown(context.Background())
+	if serveErr := <-serverErr; !errors.Is(serveErr, http.ErrServerClosed) {
+		err = errors.Join(err, serveErr)
+	}
+	return err
+}
+
+// Shutdown stops the application gracefully: the readiness endpoint starts
+// failing, and after HealthConfig.ShutdownDelay the server stops accepting
+// connections and waits for the in-flight requests, then the OnShutdown hooks
+// run and Destroy flushes the audit log and the spans and closes the
+// connectors. The requests and hooks get RestAppOptions.ShutdownTimeout, or
+// until ctx is done; the requests still running after it are aborted.
+func (receiver *RestApp) Shutdown(ctx context.Context) error {
+	receiver.shuttingDown.Store(true)
+	if health := receiver.options.Health; health != nil && health.Enabled && health.ShutdownDelay > 0 {
+		// Let the load balancers see the readiness endpoint failing
+		select {
+		case <-time.After(health.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	timeout := receiver.options.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var errs []error
+	if err := receiver.EchoApp.Shutdown(ctx); err != nil {
+		receiver.Errorf("Failed to wait for the in-flight requests: %v", err)
+		errs = append(errs, err, receiver.EchoApp.Close())
+	}
+
+	for i := len(receiver.shutdownHooks) - 1; i >= 0; i-- {
+		if err := receiver.shutdownHooks[i](ctx); err != nil {
+			receiver.Errorf("Shutdown hook failed: %v", err)
+			errs = append(errs, err)
+		}
+	}
+
+	errs = append(errs, receiver.Destroy())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,102 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError, ShutdownTimeout: 5 * time.Second})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+
+	var events []string
+	app.OnStart(func(ctx context.Context) error {
+		events = append(events, "start")
+		return nil
+	})
+	app.OnShutdown(func(ctx context.Context) error {
+		events = append(events, "shutdown 1")
+		return nil
+	})
+	app.OnShutdown(func(ctx context.Context) error {
+		events = append(events, "shutdown 2")
+		return nil
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	app.RegisterEndpoint(&Endpoint{Name: "Slow", Method: MethodGET, Path: "/slow", Handler: func(c *EndpointContext) error {
+		close(started)
+		<-release
+		return c.JSON(map[string]string{"status": "done"})
+	}}, app.Group("/api"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- app.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool { return app.EchoApp.ListenerAddr() != nil }, 2*time.Second, 10*time.Millisecond)
+	url := "http://" + app.EchoApp.ListenerAddr().String() + "/api/slow"
+
+	type result struct {
+		body string
+		err  error
+	}
+	response := make(chan result, 1)
+	go func() {
+		res, err := http.Get(url)
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		response <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-runErr:
+		t.Fatalf("Run returned before the in-flight request finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err := http.Get(url)
+	assert.Error(t, err, "new connections are refused while draining")
+
+	close(release)
+	res := <-response
+	require.NoError(t, res.err)
+	assert.JSONEq(t, `{"status":"done"}`, res.body, "the in-flight request is answered")
+
+	require.NoError(t, <-runErr)
+	assert.Equal(t, []string{"start", "shutdown 2", "shutdown 1"}, events)
+}
+
+func TestRun_StartHookError(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+
+	hookErr := errors.New("cache unavailable")
+	shutdown := false
+	app.OnStart(func(ctx context.Context) error { return hookErr })
+	app.OnShutdown(func(ctx context.Context) error {
+		shutdown = true
+		return nil
+	})
+
+	err := app.Run(context.Background())
+	assert.ErrorIs(t, err, hookErr)
+	assert.True(t, shutdown)
+	assert.Nil(t, app.EchoApp.ListenerAddr(), "the server is not started")
+}
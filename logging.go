@@ -0,0 +1,107 @@
+package rest
+
+import (
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LogFormat selects the handler of the application logger
+type LogFormat string
+
+const (
+	LogFormatText LogFormat = "text" // slog.TextHandler, the default
+	LogFormatJSON LogFormat = "json" // slog.JSONHandler
+)
+
+// newLogger builds the application logger from the Log* options. Records
+// logged with the context of a request get its requestId, and its traceId
+// and spanId when tracing is enabled.
+func newLogger(options RestAppOptions) *slog.Logger {
+	handler := options.LogHandler
+	if handler == nil {
+		output := options.LogOutput
+		if output == nil {
+			output = os.Stdout
+		}
+
+		handlerOptions := &slog.HandlerOptions{Level: options.LogLevel.slogLevel()}
+		if options.LogFormat == LogFormatJSON {
+			handler = slog.NewJSONHandler(output, handlerOptions)
+		} else {
+			handler = slog.NewTextHandler(output, handlerOptions)
+		}
+	}
+
+	return slog.New(contextLogHandler{Handler: handler})
+}
+
+// slogLevel returns the slog level matching level
+func (level LogLevel) slogLevel() slog.Level {
+	switch level {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Logger returns the application logger. Pass the request context to its
+// *Context methods to log the request ID, or use EndpointContext.Logger.
+func (receiver *RestApp) Logger() *slog.Logger {
+	return receiver.logger
+}
+
+// Logger returns the application logger with the endpoint, method, path,
+// request ID, trace and principal of the request
+func (eCtx *EndpointContext) Logger() *slog.Logger {
+	var logger *slog.Logger
+	if eCtx.App != nil {
+		logger = eCtx.App.logger
+	}
+
+	var attrs []any
+	if eCtx.Endpoint != nil {
+		attrs = append(attrs, slog.String("endpoint", eCtx.Endpoint.Name))
+	}
+
+	if eCtx.EchoCtx != nil {
+		attrs = append(attrs,
+			slog.String("method", eCtx.EchoCtx.Request().Method),
+			slog.String("path", eCtx.EchoCtx.Request().URL.Path),
+		)
+	}
+
+	if eCtx.RequestID != "" {
+		attrs = append(attrs, slog.String("requestId", eCtx.RequestID))
+	}
+
+	if spanContext := trace.SpanContextFromContext(eCtx.context); spanContext.IsValid() {
+		attrs = append(attrs,
+			slog.String("traceId", spanContext.TraceID().String()),
+			slog.String("spanId", spanContext.SpanID().String()),
+		)
+	}
+
+	if eCtx.Principal != nil {
+		attrs = append(attrs,
+			slog.String("principalId", eCtx.Principal.GetPrincipalID()),
+			slog.String("principalRole", eCtx.Principal.GetPrincipalRole()),
+		)
+	}
+
+	return loggerOrDefault(logger).With(attrs...)
+}
+
+// loggerOrDefault returns logger, or slog.Default() when it is nil
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logRecords decodes the JSON records written to buf
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		require.NoError(t, sonic.UnmarshalString(line, &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelDebug, LogFormat: LogFormatJSON, LogOutput: &buf})
+	app.Debugf("debug %d", 1)
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 1, "LogLevelDebug enables debug records")
+	assert.Equal(t, "DEBUG", records[0]["level"])
+	assert.Equal(t, "debug 1", records[0]["msg"])
+
+	buf.Reset()
+	app = NewRestApp(RestAppOptions{LogLevel: LogLevelWarn, LogOutput: &buf})
+	app.Infof("hidden")
+	app.Logger().Info("hidden")
+	app.Warnf("shown")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "level=WARN msg=shown", "the text format is the default")
+
+	buf.Reset()
+	app = NewRestApp(RestAppOptions{LogHandler: slog.NewJSONHandler(&buf, nil), LogFormat: LogFormatText})
+	app.Logger().Info("injected", "key", "value")
+	records = logRecords(t, &buf)
+	require.Len(t, records, 1, "LogHandler takes precedence over LogFormat")
+	assert.Equal(t, "value", records[0]["key"])
+}
+
+func TestEndpointContext_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	app := NewRestApp(RestAppOptions{
+		LogFormat:         LogFormatJSON,
+		LogOutput:         &buf,
+		RateLimitStore:    NewMemoryRateLimitStore(),
+		DefaultRateLimits: []RateLimit{{Max: 1, Window: time.Minute}},
+	})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1", role: "admin"}, testToken{valid: true})
+
+	app.RegisterEndpoint(&Endpoint{Name: "GetReport", Method: MethodGET, Path: "/reports", Handler: func(c *EndpointContext) error {
+		c.Logger().Info("loaded", "count", 2)
+		c.Logger().InfoContext(c.Context(), "loaded again")
+		return c.NoContent()
+	}}, app.Group("/api"))
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/api/reports", nil)
+		req.Header.Set("X-Request-ID", "req-1")
+		_, err := app.Test(req)
+		require.NoError(t, err)
+	}
+
+	records := logRecords(t, &buf)
+	require.GreaterOrEqual(t, len(records), 3)
+	for _, record := range records[:2] {
+		assert.Equal(t, "GetReport", record["endpoint"])
+		assert.Equal(t, http.MethodGet, record["method"])
+		assert.Equal(t, "/api/reports", record["path"])
+		assert.Equal(t, "req-1", record["requestId"])
+		assert.Equal(t, "u1", record["principalId"])
+		assert.Equal(t, "admin", record["principalRole"])
+	}
+	assert.Equal(t, float64(2), records[0]["count"])
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, 1, strings.Count(lines[1], `"requestId"`), "loggers with the request ID do not log it twice")
+
+	// The rate limiter logs through the request logger
+	assert.Equal(t, "Rate limit exceeded", records[2]["msg"])
+	assert.Equal(t, "req-1", records[2]["requestId"])
+	assert.Equal(t, "GetReport", records[2]["endpoint"])
+}
@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	defaultMetricsPath      = "/metrics"
+	defaultMetricsNamespace = "vsaas"
+)
+
+// MetricsConfig configures the Prometheus metrics of the application, served
+// in the text exposition format
+type MetricsConfig struct {
+	Enabled   bool
+	Path      string               // Path of the metrics endpoint. Defaults to /metrics
+	Namespace string               // Prefix of the metric names. Defaults to "vsaas"
+	Registry  *prometheus.Registry // Registry the metrics are added to and served from. Defaults to a new registry with the Go and process collectors
+	Buckets   []float64            // Buckets of the latency histograms, in seconds. Defaults to prometheus.DefBuckets
+}
+
+// appMetrics are the collectors updated by the request pipeline
+type appMetrics struct {
+	registry            *prometheus.Registry
+	requests            *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	inFlight            *prometheus.GaugeVec
+	rateLimitRejections *prometheus.CounterVec
+	uploadBytes         *prometheus.CounterVec
+	uploadRejections    *prometheus.CounterVec
+	operationDuration   *prometheus.HistogramVec
+	operationErrors     *prometheus.CounterVec
+}
+
+func newAppMetrics(config MetricsConfig) *appMetrics {
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = defaultMetricsNamespace
+	}
+
+	buckets := config.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	registry := config.Registry
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+
+	metrics := &appMetrics{
+		registry: registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Requests handled by the endpoints, by endpoint, method and status.",
+		}, []string{"endpoint", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time to handle the requests of the endpoints, by endpoint and method.",
+			Buckets:   buckets,
+		}, []string{"endpoint", "method"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Requests being handled by the endpoints, by endpoint.",
+		}, []string{"endpoint"}),
+		rateLimitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_rejections_total",
+			Help:      "Requests rejected by the rate limiter, by endpoint.",
+		}, []string{"endpoint"}),
+		uploadBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "file_upload_bytes_total",
+			Help:      "Bytes of the uploaded files, by endpoint and form field.",
+		}, []string{"endpoint", "field"}),
+		uploadRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "file_upload_rejections_total",
+			Help:      "Rejected multipart uploads, by endpoint.",
+		}, []string{"endpoint"}),
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_operation_duration_seconds",
+			Help:      "Duration of the repository operations, by model and operation.",
+			Buckets:   buckets,
+		}, []string{"model", "operation"}),
+		operationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_operation_errors_total",
+			Help:      "Failed repository operations, by model and operation.",
+		}, []string{"model", "operation"}),
+	}
+
+	registry.MustRegister(
+		metrics.requests,
+		metrics.requestDuration,
+		metrics.inFlight,
+		metrics.rateLimitRejections,
+		metrics.uploadBytes,
+		metrics.uploadRejections,
+		metrics.operationDuration,
+		metrics.operationErrors,
+	)
+
+	return metrics
+}
+
+// handler serves the metrics in the text exposition format
+func (m *appMetrics) handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// startRequest counts a request of ep in flight. The returned function
+// records its outcome.
+func (m *appMetrics) startRequest(ep *Endpoint, method string) func(status int) {
+	start := time.Now()
+	inFlight := m.inFlight.WithLabelValues(ep.Name)
+	inFlight.Inc()
+
+	return func(status int) {
+		inFlight.Dec()
+		m.requests.WithLabelValues(ep.Name, method, strconv.Itoa(status)).Inc()
+		m.requestDuration.WithLabelValues(ep.Name, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeOperation is the database.OperationObserver of the application datasource
+func (m *appMetrics) observeOperation(ctx context.Context, model string, operation string, duration time.Duration, err error) {
+	m.operationDuration.WithLabelValues(model, operation).Observe(duration.Seconds())
+	if err != nil {
+		m.operationErrors.WithLabelValues(model, operation).Inc()
+	}
+}
+
+// rateLimited counts a request of endpoint rejected by the rate limiter
+func (m *appMetrics) rateLimited(endpoint string) {
+	if m != nil {
+		m.rateLimitRejections.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// uploaded counts the bytes of a file uploaded to endpoint
+func (m *appMetrics) uploaded(endpoint string, field string, size int64) {
+	if m != nil {
+		m.uploadBytes.WithLabelValues(endpoint, field).Add(float64(size))
+	}
+}
+
+// uploadRejected counts a multipart upload to endpoint rejected
+func (m *appMetrics) uploadRejected(endpoint string) {
+	if m != nil {
+		m.uploadRejections.WithLabelValues(endpoint).Inc()
+	}
+}
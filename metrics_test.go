@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+)
+
+func TestMetrics(t *testing.T) {
+	tempDir := t.TempDir()
+	app := NewRestApp(RestAppOptions{
+		LogLevel:       LogLevelError,
+		RateLimitStore: NewMemoryRateLimitStore(),
+		Metrics:        &MetricsConfig{Enabled: true, Namespace: "test"},
+	})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+
+	api := app.Group("/api")
+	app.RegisterEndpoint(&Endpoint{Name: "GetDevice", Method: MethodGET, Path: "/devices/:id", RateLimits: []RateLimit{{Max: 2, Window: time.Minute}}, Handler: func(c *EndpointContext) error {
+		if c.EchoCtx.Param("id") == "missing" {
+			return http_errors.NotFoundError("Device not found")
+		}
+		return c.NoContent()
+	}}, api)
+	app.RegisterEndpoint(&Endpoint{Name: "UploadImage", Method: MethodPOST, Path: "/images", FileUploadConfig: &FileUploadConfig{
+		FileFields: map[string]*FileFieldConfig{
+			"image": {FieldName: "image", AllowedTypes: []FileExtension{FileExtensionPNG}},
+		},
+		UploadPath: filepath.Join(tempDir, "uploads"),
+		TempPath:   filepath.Join(tempDir, "temp"),
+	}, Handler: func(c *EndpointContext) error {
+		return c.NoContent()
+	}}, api)
+
+	for _, path := range []string{"/api/devices/d1", "/api/devices/missing", "/api/devices/d2"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+	}
+
+	upload := func(filename string) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("image", filename)
+		require.NoError(t, err)
+		_, err = part.Write(bytes.Repeat([]byte("x"), 100))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/images", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		_, err = app.Test(req)
+		require.NoError(t, err)
+	}
+	upload("image.png")
+	upload("image.exe")
+
+	app.metrics.observeOperation(context.Background(), "Device", "find", 10*time.Millisecond, nil)
+	app.metrics.observeOperation(context.Background(), "Device", "find", 10*time.Millisecond, errors.New("timeout"))
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	text := string(data)
+
+	for _, line := range []string{
+		`test_http_requests_total{endpoint="GetDevice",method="GET",status="204"} 1`,
+		`test_http_requests_total{endpoint="GetDevice",method="GET",status="404"} 1`,
+		`test_http_requests_total{endpoint="GetDevice",method="GET",status="429"} 1`,
+		`test_http_request_duration_seconds_count{endpoint="GetDevice",method="GET"} 3`,
+		`test_http_requests_in_flight{endpoint="GetDevice"} 0`,
+		`test_rate_limit_rejections_total{endpoint="GetDevice"} 1`,
+		`test_file_upload_bytes_total{endpoint="UploadImage",field="image"} 100`,
+		`test_file_upload_rejections_total{endpoint="UploadImage"} 1`,
+		`test_repository_operation_duration_seconds_count{model="Device",operation="find"} 2`,
+		`test_repository_operation_errors_total{model="Device",operation="find"} 1`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, text, line)
+	}
+}
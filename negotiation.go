@@ -0,0 +1,465 @@
+package rest
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/labstack/echo/v4"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/xompass/vsaas-rest/http_errors"
+)
+
+// responseEncoderKey is the key of the negotiated responseEncoder in the Echo context
+const responseEncoderKey = "_rest.responseEncoder"
+
+// responseEncoder writes the responses of a content type
+type responseEncoder struct {
+	header  string   // Content-Type header of the responses
+	aliases []string // Other media types of the Accept header served by the encoder
+	encode  func(c echo.Context, serializer echo.JSONSerializer, v any, indent string) error
+}
+
+// responseEncoders are the encoders of the content types an endpoint can produce
+var responseEncoders = map[ContentType]*responseEncoder{
+	ContentTypeJSON: {
+		header: echo.MIMEApplicationJSON,
+		encode: func(c echo.Context, serializer echo.JSONSerializer, v any, indent string) error {
+			return serializer.Serialize(c, v, indent)
+		},
+	},
+	ContentTypeXML: {
+		header:  echo.MIMEApplicationXMLCharsetUTF8,
+		aliases: []string{"text/xml"},
+		encode:  encodeXML,
+	},
+	ContentTypeCSV: {
+		header: string(ContentTypeCSV) + "; charset=UTF-8",
+		encode: encodeCSV,
+	},
+	ContentTypeMsgPack: {
+		header:  string(ContentTypeMsgPack),
+		aliases: []string{"application/x-msgpack", "application/vnd.msgpack"},
+		encode:  encodeMsgPack,
+	},
+	ContentTypeNDJSON: {
+		header:  string(ContentTypeNDJSON),
+		aliases: []string{"application/ndjson", "application/jsonl"},
+		encode:  encodeNDJSON,
+	},
+}
+
+// negotiatingSerializer sends the JSON responses of the endpoints with the
+// encoder negotiated with the Accept header, see Endpoint.Produces
+type negotiatingSerializer struct {
+	echo.JSONSerializer
+}
+
+func (s negotiatingSerializer) Serialize(c echo.Context, v any, indent string) error {
+	encoder, _ := c.Get(responseEncoderKey).(*responseEncoder)
+	if encoder == nil {
+		return s.JSONSerializer.Serialize(c, v, indent)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, encoder.header)
+	return encoder.encode(c, s.JSONSerializer, v, indent)
+}
+
+// validateProduces checks that the endpoint can produce every type of Produces
+func (ep *Endpoint) validateProduces() error {
+	for _, contentType := range ep.Produces {
+		if responseEncoders[contentType] == nil {
+			return errors.Errorf("endpoint %s cannot produce %s", ep.Name, contentType)
+		}
+	}
+	return nil
+}
+
+// negotiate selects the encoder of the JSON responses from the Accept header of
+// the request. Endpoints without Produces always respond JSON.
+func (ep *Endpoint) negotiate(c echo.Context) error {
+	if len(ep.Produces) == 0 {
+		return nil
+	}
+
+	if len(ep.Produces) > 1 {
+		c.Response().Header().Add(echo.HeaderVary, "Accept")
+	}
+
+	contentType, ok := negotiateContentType(c.Request().Header.Get("Accept"), ep.Produces)
+	if !ok {
+		var produced []string
+		for _, contentType := range ep.Produces {
+			produced = append(produced, string(contentType))
+		}
+
+		return http_errors.NewErrorResponse(http.StatusNotAcceptable, "NOT_ACCEPTABLE",
+			fmt.Sprintf("None of the accepted types can be produced. Available types: %s", strings.Join(produced, ", ")))
+	}
+
+	c.Set(responseEncoderKey, responseEncoders[contentType])
+	return nil
+}
+
+// negotiateContentType returns the offer with the highest quality in the
+// Accept header, the first one on ties or when the header is empty
+func negotiateContentType(accept string, offers []ContentType) (ContentType, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+
+	var best ContentType
+	bestQuality := 0.0
+	for _, offer := range offers {
+		if quality := acceptQuality(ranges, offer); quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// acceptRange is a media range of an Accept header
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns the media ranges of an Accept header. Ranges with an
+// invalid quality are ignored.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := acceptRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), quality: 1}
+		if r.mediaType == "" {
+			continue
+		}
+
+		valid := true
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				quality, err := strconv.ParseFloat(value, 64)
+				valid = err == nil && quality >= 0 && quality <= 1
+				r.quality = quality
+			}
+		}
+
+		if valid {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality of the most specific range matching offer
+func acceptQuality(ranges []acceptRange, offer ContentType) float64 {
+	mediaTypes := append([]string{string(offer)}, responseEncoders[offer].aliases...)
+
+	quality, specificity := 0.0, 0
+	for _, r := range ranges {
+		matched := 0
+		switch {
+		case slices.Contains(mediaTypes, r.mediaType):
+			matched = 3
+		case strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(string(offer), strings.TrimSuffix(r.mediaType, "*")):
+			matched = 2
+		case r.mediaType == "*/*":
+			matched = 1
+		}
+
+		if matched > specificity {
+			quality, specificity = r.quality, matched
+		}
+	}
+	return quality
+}
+
+// listItems returns the elements of v when it is a slice or an array, other
+// than []byte
+func listItems(v any) ([]reflect.Value, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+
+	items := make([]reflect.Value, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i)
+	}
+	return items, true
+}
+
+// encodeXML writes v as an XML document. Lists are wrapped in an items element.
+// The document is buffered, so types XML cannot encode, like maps, fail
+// before the response is sent.
+func encodeXML(c echo.Context, _ echo.JSONSerializer, v any, indent string) error {
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buffer)
+	encoder.Indent("", indent)
+
+	items, ok := listItems(v)
+	if !ok {
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+	} else {
+		start := xml.StartElement{Name: xml.Name{Local: "items"}}
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := encoder.Encode(item.Interface()); err != nil {
+				return err
+			}
+		}
+		if err := encoder.EncodeToken(start.End()); err != nil {
+			return err
+		}
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+	}
+
+	_, err := c.Response().Write(buffer.Bytes())
+	return err
+}
+
+// encodeMsgPack writes v as MessagePack, with the field names of the JSON responses
+func encodeMsgPack(c echo.Context, _ echo.JSONSerializer, v any, _ string) error {
+	encoder := msgpack.NewEncoder(c.Response())
+	encoder.SetCustomStructTag("json")
+	return encoder.Encode(v)
+}
+
+// encodeNDJSON writes each element of a list as a JSON line, or v as a single line
+func encodeNDJSON(c echo.Context, _ echo.JSONSerializer, v any, _ string) error {
+	items, ok := listItems(v)
+	if !ok {
+		items = []reflect.Value{reflect.ValueOf(v)}
+	}
+
+	encoder := json.NewEncoder(c.Response())
+	for _, item := range items {
+		var value any
+		if item.IsValid() {
+			value = item.Interface()
+		}
+
+		// Encode ends each value with a new line
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvColumn is a column of a CSV response
+type csvColumn struct {
+	name  string
+	index []int  // Index of the struct field of the column
+	key   string // Key of the map entry of the column
+}
+
+// encodeCSV writes v, a list of structs or of maps with string keys, as CSV
+// with a header row. A single struct or map is written as one row. The
+// columns are named like the JSON fields, and nested values are written as JSON.
+func encodeCSV(c echo.Context, _ echo.JSONSerializer, v any, _ string) error {
+	items, ok := listItems(v)
+	if !ok {
+		items = []reflect.Value{reflect.ValueOf(v)}
+	}
+
+	rows := make([]reflect.Value, 0, len(items))
+	for _, item := range items {
+		for item.Kind() == reflect.Ptr || item.Kind() == reflect.Interface {
+			if item.IsNil() {
+				item = reflect.Value{}
+				break
+			}
+			item = item.Elem()
+		}
+		rows = append(rows, item)
+	}
+
+	columns, err := csvColumns(rows)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(c.Response())
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = csvText(column.name) // Map keys may come from the request
+	}
+	if err := writer.Write(record); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		for i, column := range columns {
+			var cell reflect.Value
+			switch {
+			case !row.IsValid():
+			case column.index != nil:
+				cell, _ = row.FieldByIndexErr(column.index) // Fails for nil embedded pointers
+			default:
+				cell = row.MapIndex(reflect.ValueOf(column.key).Convert(row.Type().Key()))
+			}
+
+			if record[i], err = csvCell(cell); err != nil {
+				return err
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvColumns returns the columns of rows: the fields of their struct type, or
+// the sorted keys of their maps
+func csvColumns(rows []reflect.Value) ([]csvColumn, error) {
+	var rowType reflect.Type
+	keys := map[string]bool{}
+	for _, row := range rows {
+		if !row.IsValid() {
+			continue
+		}
+
+		if rowType == nil {
+			rowType = row.Type()
+		} else if row.Type() != rowType {
+			return nil, errors.Errorf("cannot write %s and %s rows in the same CSV", rowType, row.Type())
+		}
+
+		switch {
+		case row.Kind() == reflect.Struct:
+		case row.Kind() == reflect.Map && row.Type().Key().Kind() == reflect.String:
+			for _, key := range row.MapKeys() {
+				keys[key.String()] = true
+			}
+		default:
+			return nil, errors.Errorf("cannot write %s as CSV", row.Type())
+		}
+	}
+
+	if rowType == nil {
+		return nil, nil
+	}
+
+	if rowType.Kind() == reflect.Struct {
+		return structColumns(rowType, nil), nil
+	}
+
+	columns := make([]csvColumn, 0, len(keys))
+	for key := range keys {
+		columns = append(columns, csvColumn{name: key, key: key})
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].name < columns[j].name })
+	return columns, nil
+}
+
+// structColumns returns the columns of the exported fields of t, named like
+// the JSON fields. The fields of embedded structs are promoted.
+func structColumns(t reflect.Type, index []int) []csvColumn {
+	var columns []csvColumn
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		fieldIndex := append(slices.Clone(index), i)
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			columns = append(columns, structColumns(fieldType, fieldIndex)...)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, csvColumn{name: name, index: fieldIndex})
+	}
+	return columns
+}
+
+// csvCell formats a value of a CSV row. Text marshalers like time.Time and
+// bson.ObjectID use their text, and nested values are written as JSON. Text
+// is escaped by csvText; numbers and booleans are written as they are.
+func csvCell(v reflect.Value) (string, error) {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return "", nil
+		}
+		if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+			break
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() || ((v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.IsNil()) {
+		return "", nil
+	}
+
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return csvText(string(text)), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return csvText(v.String()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+
+	data, err := json.Marshal(v.Interface())
+	return csvText(string(data)), err
+}
+
+// csvText prefixes with a quote the text that spreadsheets would run as a
+// formula, i.e. starting with =, +, -, @, a tab or a carriage return
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
@@ -0,0 +1,193 @@
+package rest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type negotiatedBase struct {
+	ID bson.ObjectID `json:"id"`
+}
+
+type negotiatedDevice struct {
+	negotiatedBase
+	Name      string            `json:"name"`
+	Online    bool              `json:"online"`
+	Tags      []string          `json:"tags,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Parent    *negotiatedDevice `json:"parent,omitempty"`
+	Secret    string            `json:"-"`
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	offers := []ContentType{ContentTypeJSON, ContentTypeCSV, ContentTypeMsgPack}
+
+	tests := []struct {
+		accept string
+		want   ContentType
+		ok     bool
+	}{
+		{"", ContentTypeJSON, true},
+		{"*/*", ContentTypeJSON, true},
+		{"text/csv", ContentTypeCSV, true},
+		{"text/*", ContentTypeCSV, true},
+		{"application/x-msgpack", ContentTypeMsgPack, true},
+		{"application/json;q=0.5, text/csv", ContentTypeCSV, true},
+		{"text/csv;q=0.2, */*;q=0.1", ContentTypeCSV, true},
+		{"*/*, application/json;q=0", ContentTypeCSV, true},
+		{"text/csv;q=0.5, application/msgpack;q=0.5", ContentTypeCSV, true},
+		{"text/html", "", false},
+		{"text/csv;q=0", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := negotiateContentType(tt.accept, offers)
+		assert.Equal(t, tt.ok, ok, tt.accept)
+		assert.Equal(t, tt.want, got, tt.accept)
+	}
+}
+
+func TestNegotiatedResponses(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+	api := app.Group("/api")
+
+	createdAt := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	id := bson.NewObjectID()
+	devices := []negotiatedDevice{
+		{negotiatedBase: negotiatedBase{ID: id}, Name: "Lobby, main", Online: true, Tags: []string{"a", "b"}, CreatedAt: createdAt, Secret: "x"},
+		{Name: "Parking", CreatedAt: createdAt, Parent: &negotiatedDevice{Name: "Lobby"}},
+	}
+
+	err := app.RegisterEndpoint(&Endpoint{Name: "Unknown", Method: MethodGET, Path: "/unknown", Produces: []ContentType{"text/html"},
+		Handler: func(ctx *EndpointContext) error { return ctx.NoContent() }}, api)
+	assert.ErrorContains(t, err, "endpoint Unknown cannot produce text/html")
+
+	require.NoError(t, app.RegisterEndpoints([]*Endpoint{
+		{
+			Name: "ListDevices", Method: MethodGET, Path: "/devices",
+			Produces: []ContentType{ContentTypeJSON, ContentTypeCSV, ContentTypeXML, ContentTypeMsgPack, ContentTypeNDJSON},
+			Handler:  func(ctx *EndpointContext) error { return ctx.JSON(devices) },
+		},
+		{
+			Name: "ListRows", Method: MethodGET, Path: "/rows",
+			Produces: []ContentType{ContentTypeCSV, ContentTypeXML},
+			Handler: func(ctx *EndpointContext) error {
+				return ctx.JSON([]map[string]any{{"b": 1, "a": "=x"}, {"@c": true}})
+			},
+		},
+		{
+			Name: "Failing", Method: MethodGET, Path: "/failing",
+			Produces: []ContentType{ContentTypeCSV},
+			Handler:  func(ctx *EndpointContext) error { return ctx.JSON(nil, http.StatusNotFound) },
+		},
+	}, api))
+
+	get := func(path, accept string) (*http.Response, string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res, err := app.Test(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(body)
+	}
+
+	res, body := get("/api/devices", "")
+	assert.Equal(t, "application/json", mediaType(res))
+	assert.Contains(t, res.Header.Values("Vary"), "Accept")
+	var decoded []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(body), &decoded))
+	assert.Len(t, decoded, 2)
+
+	res, body = get("/api/devices", "text/csv")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/csv; charset=UTF-8", res.Header.Get("Content-Type"))
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"id", "name", "online", "tags", "createdAt", "parent"},
+		{id.Hex(), "Lobby, main", "true", `["a","b"]`, "2024-03-01T10:30:00Z", ""},
+		{bson.ObjectID{}.Hex(), "Parking", "false", "", "2024-03-01T10:30:00Z", `{"id":"000000000000000000000000","name":"Lobby","online":false,"createdAt":"0001-01-01T00:00:00Z"}`},
+	}, records)
+
+	res, body = get("/api/rows", "text/csv")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "'@c,a,b\n,'=x,1\ntrue,,\n", body, "keys and values are escaped against formula injection")
+
+	res, body = get("/api/devices", "application/xml")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/xml; charset=UTF-8", res.Header.Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(body, `<?xml version="1.0" encoding="UTF-8"?>`+"\n<items><negotiatedDevice>"), body)
+
+	res, body = get("/api/rows", "application/xml")
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "XML cannot encode maps")
+	assert.Equal(t, "application/json", mediaType(res), "errors are sent as JSON")
+	assert.Contains(t, body, "INTERNAL_SERVER_ERROR")
+
+	res, body = get("/api/devices", "application/msgpack")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/msgpack", res.Header.Get("Content-Type"))
+	var unpacked []map[string]any
+	require.NoError(t, msgpack.Unmarshal([]byte(body), &unpacked))
+	require.Len(t, unpacked, 2)
+	assert.Equal(t, "Lobby, main", unpacked[0]["name"])
+
+	res, body = get("/api/devices", "application/x-ndjson")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[1], `"name":"Parking"`)
+
+	res, body = get("/api/devices", "text/html")
+	assert.Equal(t, http.StatusNotAcceptable, res.StatusCode)
+	assert.Contains(t, body, "NOT_ACCEPTABLE")
+
+	res, _ = get("/api/failing", "text/csv")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestCSVCell_FormulaInjection(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1+1", "'+1+1"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"a=1", "a=1"},
+		{"", ""},
+		{-5, "-5"},
+		{-1.5, "-1.5"},
+		{[]string{"=x"}, `["=x"]`},
+	}
+
+	for _, tt := range tests {
+		got, err := csvCell(reflect.ValueOf(tt.value))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.value)
+	}
+}
+
+// mediaType returns the media type of the Content-Type of res
+func mediaType(res *http.Response) string {
+	mediaType, _, _ := strings.Cut(res.Header.Get("Content-Type"), ";")
+	return mediaType
+}
@@ -0,0 +1,822 @@
+package rest
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xompass/vsaas-rest/database"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const openAPIVersion = "3.1.0"
+
+// OpenAPIConfig configures the generated OpenAPI document and the routes that serve it
+type OpenAPIConfig struct {
+	Title              string       // Document title. Defaults to RestAppOptions.Name
+	Version            string       // API version. Defaults to "1.0.0"
+	Description        string       // API description
+	Servers            []string     // Server URLs
+	SpecPath           string       // Path of the JSON document. Defaults to "/openapi.json"
+	SwaggerUIPath      string       // Path of the Swagger UI. Empty disables the UI
+	SwaggerUIAssetsURL string       // Base URL of the swagger-ui-dist assets. Defaults to unpkg
+	Group              *RouterGroup // Optional group used to serve the routes, e.g. to protect them with middleware
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 document
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Servers    []OpenAPIServer            `json:"servers,omitempty"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIPathItem maps lower case HTTP methods to operations
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+type OpenAPIOperation struct {
+	OperationID string                     `json:"operationId,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+	Scope       string                     `json:"x-scope,omitempty"` // Token scope required by the endpoint
+}
+
+type OpenAPIParameter struct {
+	Name     string                      `json:"name"`
+	In       string                      `json:"in"`
+	Required bool                        `json:"required,omitempty"`
+	Schema   *OpenAPISchema              `json:"schema,omitempty"`
+	Content  map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema,omitempty"`
+}
+
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// OpenAPISchema is the subset of JSON Schema used by the generated documents
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	AdditionalProperties any                       `json:"additionalProperties,omitempty"` // bool or *OpenAPISchema
+	OneOf                []*OpenAPISchema          `json:"oneOf,omitempty"`
+	Enum                 []any                     `json:"enum,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64                  `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64                  `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	MinItems             *int                      `json:"minItems,omitempty"`
+	MaxItems             *int                      `json:"maxItems,omitempty"`
+}
+
+const bearerSecurityScheme = "bearerAuth"
+
+// openAPISchemaNames holds the names given to the library types by their @name annotations
+var openAPISchemaNames = map[reflect.Type]string{
+	reflect.TypeOf(Count{}):                     "CountResponse",
+	reflect.TypeOf(Exists{}):                    "ExistsResponse",
+	reflect.TypeOf(http_errors.ErrorResponse{}): "ErrorResponse",
+}
+
+var (
+	echoPathParamRegex    = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+	openAPIPathParamRegex = regexp.MustCompile(`\{([^}]+)\}`)
+	schemaNameRegex       = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// OpenAPI builds an OpenAPI 3.1 document describing all the registered endpoints
+func (receiver *RestApp) OpenAPI(config OpenAPIConfig) *OpenAPIDocument {
+	title := config.Title
+	if title == "" {
+		title = receiver.options.Name
+	}
+
+	version := config.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+
+	generator := newOpenAPISchemaGenerator()
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: OpenAPIInfo{
+			Title:       title,
+			Version:     version,
+			Description: config.Description,
+		},
+		Paths: map[string]OpenAPIPathItem{},
+		Components: OpenAPIComponents{
+			Schemas: generator.schemas,
+			SecuritySchemes: map[string]OpenAPISecurityScheme{
+				bearerSecurityScheme: {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+
+	for _, server := range config.Servers {
+		doc.Servers = append(doc.Servers, OpenAPIServer{URL: server})
+	}
+
+	for _, route := range receiver.registry.snapshot() {
+		ep := route.endpoint
+		if !receiver.registry.enabled(ep) {
+			continue
+		}
+
+		path := openAPIPath(route.path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = OpenAPIPathItem{}
+		}
+
+		doc.Paths[path][strings.ToLower(string(ep.Method))] = generator.operation(ep, path)
+	}
+
+	return doc
+}
+
+// ServeOpenAPI serves the OpenAPI document and, if configured, a Swagger UI.
+// The document is built on each request so it includes endpoints registered later.
+func (receiver *RestApp) ServeOpenAPI(config OpenAPIConfig) {
+	if config.SpecPath == "" {
+		config.SpecPath = "/openapi.json"
+	}
+
+	if config.SwaggerUIAssetsURL == "" {
+		config.SwaggerUIAssetsURL = "https://unpkg.com/swagger-ui-dist@5"
+	}
+
+	get := receiver.EchoApp.GET
+	specURL := config.SpecPath
+	if config.Group != nil {
+		get = config.Group.echoGroup.GET
+		specURL = config.Group.prefix + config.SpecPath
+	}
+
+	get(config.SpecPath, func(c echo.Context) error {
+		return c.JSON(http.StatusOK, receiver.OpenAPI(config))
+	})
+
+	if config.SwaggerUIPath != "" {
+		title := config.Title
+		if title == "" {
+			title = receiver.options.Name
+		}
+
+		page := swaggerUIPage(html.EscapeString(title), config.SwaggerUIAssetsURL, specURL)
+		get(config.SwaggerUIPath, func(c echo.Context) error {
+			return c.HTML(http.StatusOK, page)
+		})
+	}
+
+	receiver.Infof("Serving OpenAPI document at %s", specURL)
+}
+
+func swaggerUIPage(title string, assetsURL string, specURL string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <title>%s</title>
+  <link rel="stylesheet" href="%s/swagger-ui.css" />
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="%s/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => { window.ui = SwaggerUIBundle({ url: %s, dom_id: '#swagger-ui' }); };
+  </script>
+</body>
+</html>`, title, assetsURL, assetsURL, strconv.Quote(specURL))
+}
+
+// openAPIPath converts Echo path parameters (:id) to OpenAPI templates ({id})
+func openAPIPath(path string) string {
+	return echoPathParamRegex.ReplaceAllString(path, "{$1}")
+}
+
+type openAPISchemaGenerator struct {
+	schemas      map[string]*OpenAPISchema
+	names        map[reflect.Type]string
+	operationIDs map[string]bool
+}
+
+func newOpenAPISchemaGenerator() *openAPISchemaGenerator {
+	generator := &openAPISchemaGenerator{
+		schemas:      map[string]*OpenAPISchema{},
+		names:        map[reflect.Type]string{},
+		operationIDs: map[string]bool{},
+	}
+
+	generator.schemaFor(reflect.TypeOf(http_errors.ErrorResponse{}))
+	generator.addFilterSchemas()
+	return generator
+}
+
+func (g *openAPISchemaGenerator) operation(ep *Endpoint, path string) *OpenAPIOperation {
+	operation := &OpenAPIOperation{
+		OperationID: g.operationID(ep),
+		Summary:     ep.Name,
+		Scope:       ep.Scope,
+		Responses: map[string]OpenAPIResponse{
+			"200":     {Description: "Successful response"},
+			"default": g.errorResponse("Unexpected error"),
+		},
+	}
+
+	if summary, ok := ep.MetaData["summary"].(string); ok {
+		operation.Summary = summary
+	}
+
+	if description, ok := ep.MetaData["description"].(string); ok {
+		operation.Description = description
+	}
+
+	if ep.Model != "" {
+		operation.Tags = []string{ep.Model}
+	}
+
+	operation.Parameters = g.parameters(ep, path)
+	operation.RequestBody = g.requestBody(ep)
+
+	if ep.responseType != nil {
+		delete(operation.Responses, "200")
+		operation.Responses[strconv.Itoa(ep.typedStatus())] = g.typedResponse(ep)
+	} else if len(ep.Produces) > 0 {
+		response := OpenAPIResponse{Description: "Successful response", Content: map[string]OpenAPIMediaType{}}
+		for _, contentType := range ep.Produces {
+			response.Content[string(contentType)] = OpenAPIMediaType{}
+		}
+		operation.Responses["200"] = response
+	}
+
+	if len(operation.Parameters) > 0 || operation.RequestBody != nil {
+		operation.Responses["400"] = g.errorResponse("Invalid request")
+	}
+
+	if !ep.Public {
+		roles := []string{}
+		for _, role := range ep.Roles {
+			roles = append(roles, role.RoleName())
+		}
+		operation.Security = []map[string][]string{{bearerSecurityScheme: roles}}
+		operation.Responses["401"] = g.errorResponse("Authentication required")
+		operation.Responses["403"] = g.errorResponse("Insufficient role or scope")
+	}
+
+	if ep.hasRateLimits() {
+		operation.Responses["429"] = g.errorResponse("Rate limit exceeded")
+	}
+
+	return operation
+}
+
+// operationID returns a unique operation id derived from the endpoint name
+func (g *openAPISchemaGenerator) operationID(ep *Endpoint) string {
+	name := sanitizeSchemaName(ep.Name)
+	if name == "" {
+		name = "operation"
+	}
+
+	unique := name
+	for i := 2; g.operationIDs[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+
+	g.operationIDs[unique] = true
+	return unique
+}
+
+// typedResponse documents the successful response of a typed endpoint
+func (g *openAPISchemaGenerator) typedResponse(ep *Endpoint) OpenAPIResponse {
+	if ep.responseType == reflect.TypeFor[Empty]() {
+		return OpenAPIResponse{Description: "No content"}
+	}
+
+	produces := ep.Produces
+	if len(produces) == 0 {
+		produces = []ContentType{ContentTypeJSON}
+	}
+
+	schema := g.schemaFor(ep.responseType)
+	response := OpenAPIResponse{Description: "Successful response", Content: map[string]OpenAPIMediaType{}}
+	for _, contentType := range produces {
+		response.Content[string(contentType)] = OpenAPIMediaType{Schema: schema}
+	}
+	return response
+}
+
+func (g *openAPISchemaGenerator) errorResponse(description string) OpenAPIResponse {
+	return OpenAPIResponse{
+		Description: description,
+		Content: map[string]OpenAPIMediaType{
+			string(ContentTypeJSON): {Schema: schemaRef("ErrorResponse")},
+		},
+	}
+}
+
+func (g *openAPISchemaGenerator) parameters(ep *Endpoint, path string) []OpenAPIParameter {
+	var parameters []OpenAPIParameter
+	declared := map[string]bool{}
+
+	for _, param := range ep.Accepts {
+		parameter := OpenAPIParameter{
+			Name:     param.name,
+			In:       string(param.in),
+			Required: param.required || param.in == InPath,
+		}
+
+		switch param.paramType {
+		case string(QueryParamTypeFilter):
+			parameter.Content = map[string]OpenAPIMediaType{string(ContentTypeJSON): {Schema: schemaRef("Filter")}}
+		case string(QueryParamTypeWhere):
+			parameter.Content = map[string]OpenAPIMediaType{string(ContentTypeJSON): {Schema: schemaRef("Where")}}
+		default:
+			parameter.Schema = paramSchema(param.paramType)
+		}
+
+		if param.in == InPath {
+			declared[param.name] = true
+		}
+		parameters = append(parameters, parameter)
+	}
+
+	// Every template in the path must be described, even if the endpoint does not parse it
+	for _, match := range openAPIPathParamRegex.FindAllStringSubmatch(path, -1) {
+		if !declared[match[1]] {
+			parameters = append(parameters, OpenAPIParameter{
+				Name:     match[1],
+				In:       string(InPath),
+				Required: true,
+				Schema:   &OpenAPISchema{Type: "string"},
+			})
+		}
+	}
+
+	return parameters
+}
+
+func (g *openAPISchemaGenerator) requestBody(ep *Endpoint) *OpenAPIRequestBody {
+	if ep.Method != MethodPOST && ep.Method != MethodPUT && ep.Method != MethodPATCH {
+		return nil
+	}
+
+	if ep.BodyParams == nil && ep.FileUploadConfig == nil {
+		return nil
+	}
+
+	var bodySchema *OpenAPISchema
+	var bodyType reflect.Type
+	if ep.BodyParams != nil {
+		if body := ep.BodyParams(); body != nil {
+			bodyType = reflect.TypeOf(body)
+			bodySchema = g.schemaFor(bodyType)
+		}
+	}
+
+	requestBody := &OpenAPIRequestBody{Content: map[string]OpenAPIMediaType{}}
+	for _, contentType := range ep.getAcceptedContentTypes() {
+		if contentType == ContentTypeMultipart {
+			schema := g.multipartSchema(bodyType, ep.FileUploadConfig)
+			requestBody.Content[string(contentType)] = OpenAPIMediaType{Schema: schema}
+			requestBody.Required = requestBody.Required || len(schema.Required) > 0
+			continue
+		}
+
+		if bodySchema != nil {
+			requestBody.Content[string(contentType)] = OpenAPIMediaType{Schema: bodySchema}
+		}
+	}
+
+	if len(requestBody.Content) == 0 {
+		return nil
+	}
+
+	if resolved := g.resolve(bodySchema); resolved != nil && len(resolved.Required) > 0 {
+		requestBody.Required = true
+	}
+
+	return requestBody
+}
+
+// multipartSchema describes the form values of the body struct plus the configured file fields
+func (g *openAPISchemaGenerator) multipartSchema(bodyType reflect.Type, config *FileUploadConfig) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+
+	if body := g.resolve(g.schemaForBody(bodyType)); body != nil {
+		for name, property := range body.Properties {
+			schema.Properties[name] = property
+		}
+		schema.Required = append(schema.Required, body.Required...)
+	}
+
+	if config != nil {
+		for name, field := range config.FileFields {
+			if field.FieldName != "" {
+				name = field.FieldName
+			}
+
+			file := &OpenAPISchema{Type: "string", Format: "binary"}
+			if len(field.AllowedTypes) > 0 {
+				var extensions []string
+				for _, extension := range field.AllowedTypes {
+					extensions = append(extensions, string(extension))
+				}
+				file.Description = "Allowed extensions: " + strings.Join(extensions, ", ")
+			}
+
+			if field.MaxFiles == 1 {
+				schema.Properties[name] = file
+			} else {
+				files := &OpenAPISchema{Type: "array", Items: file}
+				if field.MaxFiles > 1 {
+					files.MaxItems = intPtr(field.MaxFiles)
+				}
+				schema.Properties[name] = files
+			}
+
+			if field.Required {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+	}
+
+	return schema
+}
+
+func (g *openAPISchemaGenerator) schemaForBody(bodyType reflect.Type) *OpenAPISchema {
+	if bodyType == nil {
+		return nil
+	}
+	return g.schemaFor(bodyType)
+}
+
+// resolve returns the component referenced by schema, or schema itself
+func (g *openAPISchemaGenerator) resolve(schema *OpenAPISchema) *OpenAPISchema {
+	if schema == nil || schema.Ref == "" {
+		return schema
+	}
+	return g.schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+}
+
+// schemaFor returns the JSON schema of t. Structs are added to the components
+// and referenced so recursive types are supported.
+func (g *openAPISchemaGenerator) schemaFor(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(database.MongoDate{}):
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case reflect.TypeOf(bson.ObjectID{}):
+		return &OpenAPISchema{Type: "string", Pattern: "^[0-9a-fA-F]{24}$"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema := &OpenAPISchema{Type: "integer"}
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 {
+			schema.Format = "int64"
+		}
+		return schema
+	case reflect.Float32, reflect.Float64:
+		return &OpenAPISchema{Type: "number"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: g.schemaFor(t.Elem())}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return &OpenAPISchema{Type: "object", AdditionalProperties: true}
+		}
+		return &OpenAPISchema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	default:
+		return &OpenAPISchema{}
+	}
+}
+
+func (g *openAPISchemaGenerator) structSchema(t reflect.Type) *OpenAPISchema {
+	name := g.schemaName(t)
+	if _, ok := g.schemas[name]; ok {
+		return schemaRef(name)
+	}
+
+	schema := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	g.schemas[name] = schema // Registered before the fields to stop recursion
+	g.addStructFields(schema, t)
+
+	return schemaRef(name)
+}
+
+func (g *openAPISchemaGenerator) addStructFields(schema *OpenAPISchema, t reflect.Type) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := getFieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		// Embedded structs without a json name are flattened, as encoding/json does
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addStructFields(schema, embedded)
+				continue
+			}
+		}
+
+		property := g.schemaFor(field.Type)
+		if applyValidateTag(property, field.Type, field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// schemaName returns a unique component name for t
+func (g *openAPISchemaGenerator) schemaName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name, ok := openAPISchemaNames[t]
+	if !ok {
+		name = sanitizeSchemaName(t.Name())
+		if name == "" {
+			name = "Anonymous"
+		}
+	}
+
+	unique := name
+	for i := 2; g.isNameTaken(unique); i++ {
+		unique = name + strconv.Itoa(i)
+	}
+
+	g.names[t] = unique
+	return unique
+}
+
+func (g *openAPISchemaGenerator) isNameTaken(name string) bool {
+	for _, existing := range g.names {
+		if existing == name {
+			return true
+		}
+	}
+	_, ok := g.schemas[name]
+	return ok
+}
+
+func sanitizeSchemaName(name string) string {
+	return strings.Trim(schemaNameRegex.ReplaceAllString(name, "_"), "_")
+}
+
+// addFilterSchemas describes the LoopBack filter and where query parameters
+func (g *openAPISchemaGenerator) addFilterSchemas() {
+	g.schemas["Where"] = &OpenAPISchema{
+		Type:                 "object",
+		Description:          `LoopBack where clause, e.g. {"name":{"like":"cam"},"or":[{"status":"active"}]}`,
+		AdditionalProperties: true,
+	}
+
+	g.schemas["Include"] = &OpenAPISchema{
+		OneOf: []*OpenAPISchema{
+			{Type: "string", Description: "Relation name"},
+			{
+				Type: "object",
+				Properties: map[string]*OpenAPISchema{
+					"relation": {Type: "string"},
+					"scope":    schemaRef("Filter"),
+				},
+				Required: []string{"relation"},
+			},
+		},
+	}
+
+	g.schemas["Filter"] = &OpenAPISchema{
+		Type:        "object",
+		Description: "LoopBack filter",
+		Properties: map[string]*OpenAPISchema{
+			"fields": {Type: "object", AdditionalProperties: &OpenAPISchema{Type: "boolean"}},
+			"limit":  {Type: "integer", Minimum: floatPtr(0)},
+			"skip":   {Type: "integer", Minimum: floatPtr(0)},
+			"order": {OneOf: []*OpenAPISchema{
+				{Type: "string", Description: `e.g. "name ASC"`},
+				{Type: "array", Items: &OpenAPISchema{Type: "string"}},
+			}},
+			"where": schemaRef("Where"),
+			"include": {OneOf: []*OpenAPISchema{
+				{Type: "string"},
+				{Type: "array", Items: schemaRef("Include")},
+			}},
+		},
+	}
+}
+
+// applyValidateTag maps validator rules to JSON schema keywords and reports
+// whether the field is required. Rules after dive apply to the elements and are ignored.
+func applyValidateTag(schema *OpenAPISchema, t reflect.Type, tag string) bool {
+	if tag == "" || tag == "-" {
+		return false
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, value, _ := strings.Cut(rule, "=")
+		if name == "dive" {
+			break
+		}
+
+		if schema.Ref != "" && name != "required" {
+			continue
+		}
+
+		switch name {
+		case "required":
+			required = true
+		case "min", "max", "len":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			applyLengthRule(schema, t, name, number)
+		case "gt", "gte", "lt", "lte":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			switch name {
+			case "gt":
+				schema.ExclusiveMinimum = floatPtr(number)
+			case "gte":
+				schema.Minimum = floatPtr(number)
+			case "lt":
+				schema.ExclusiveMaximum = floatPtr(number)
+			case "lte":
+				schema.Maximum = floatPtr(number)
+			}
+		case "oneof":
+			for _, option := range strings.Fields(value) {
+				schema.Enum = append(schema.Enum, enumValue(t, option))
+			}
+		case "email":
+			schema.Format = "email"
+		case "url", "uri", "http_url":
+			schema.Format = "uri"
+		case "uuid", "uuid4", "uuid_rfc4122", "uuid4_rfc4122":
+			schema.Format = "uuid"
+		case "ipv4":
+			schema.Format = "ipv4"
+		case "ipv6":
+			schema.Format = "ipv6"
+		case "hostname", "hostname_rfc1123":
+			schema.Format = "hostname"
+		case "mongodb":
+			schema.Pattern = "^[0-9a-fA-F]{24}$"
+		}
+	}
+
+	return required
+}
+
+func applyLengthRule(schema *OpenAPISchema, t reflect.Type, rule string, value float64) {
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.String:
+		if rule != "max" {
+			schema.MinLength = intPtr(int(value))
+		}
+		if rule != "min" {
+			schema.MaxLength = intPtr(int(value))
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if rule != "max" {
+			schema.MinItems = intPtr(int(value))
+		}
+		if rule != "min" {
+			schema.MaxItems = intPtr(int(value))
+		}
+	default:
+		if rule != "max" {
+			schema.Minimum = floatPtr(value)
+		}
+		if rule != "min" {
+			schema.Maximum = floatPtr(value)
+		}
+	}
+}
+
+func enumValue(t reflect.Type, option string) any {
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if number, err := strconv.ParseInt(option, 10, 64); err == nil {
+			return number
+		}
+	case reflect.Float32, reflect.Float64:
+		if number, err := strconv.ParseFloat(option, 64); err == nil {
+			return number
+		}
+	}
+	return option
+}
+
+// paramSchema returns the schema of a path, query or header parameter type
+func paramSchema(paramType string) *OpenAPISchema {
+	switch paramType {
+	case string(QueryParamTypeInt):
+		return &OpenAPISchema{Type: "integer"}
+	case string(QueryParamTypeFloat):
+		return &OpenAPISchema{Type: "number"}
+	case string(QueryParamTypeBool):
+		return &OpenAPISchema{Type: "boolean"}
+	case string(QueryParamTypeDate):
+		return &OpenAPISchema{Type: "string", Format: "date"}
+	case string(QueryParamTypeDateTime):
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case string(QueryParamTypeObjectID):
+		return &OpenAPISchema{Type: "string", Pattern: "^[0-9a-fA-F]{24}$"}
+	default:
+		return &OpenAPISchema{Type: "string"}
+	}
+}
+
+func schemaRef(name string) *OpenAPISchema {
+	return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func intPtr(value int) *int {
+	return &value
+}
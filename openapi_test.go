@@ -0,0 +1,188 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openAPIAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type openAPICreateUser struct {
+	Name     string          `json:"name" validate:"required,min=2,max=50"`
+	Email    string          `json:"email,omitempty" validate:"omitempty,email"`
+	Age      int             `json:"age" validate:"gte=18,lte=120"`
+	Status   string          `json:"status" validate:"oneof=active inactive"`
+	Tags     []string        `json:"tags" validate:"max=5,dive,min=1"`
+	Address  *openAPIAddress `json:"address"`
+	Birthday time.Time       `json:"birthday"`
+	Internal string          `json:"-"`
+}
+
+func newOpenAPITestApp() *RestApp {
+	app := createTestApp()
+	app.options.Name = "Test API"
+	api := app.Group("/api")
+
+	app.RegisterEndpoints([]*Endpoint{
+		{
+			Name:    "ListUsers",
+			Method:  MethodGET,
+			Path:    "/users",
+			Model:   "User",
+			Public:  true,
+			Handler: func(c *EndpointContext) error { return nil },
+			Accepts: []Param{NewQueryParam("filter", QueryParamTypeFilter)},
+		},
+		{
+			Name:        "CreateUser",
+			Method:      MethodPOST,
+			Path:        "/users",
+			Roles:       []EndpointRole{testRole("admin")},
+			Scope:       "users:write",
+			BodyParams:  func() any { return &openAPICreateUser{} },
+			RateLimiter: func(*EndpointContext) RateLimit { return RateLimit{Max: 1, Window: time.Second} },
+			Handler:     func(c *EndpointContext) error { return nil },
+		},
+		{
+			Name:    "GetUser",
+			Method:  MethodGET,
+			Path:    "/users/:id",
+			Handler: func(c *EndpointContext) error { return nil },
+			Accepts: []Param{NewPathParam("id", PathParamTypeObjectID)},
+		},
+		{
+			Name:   "UploadAvatar",
+			Method: MethodPOST,
+			Path:   "/users/:id/avatar",
+			FileUploadConfig: &FileUploadConfig{
+				FileFields: map[string]*FileFieldConfig{
+					"avatar": {FieldName: "avatar", Required: true, MaxFiles: 1},
+				},
+			},
+			Handler: func(c *EndpointContext) error { return nil },
+		},
+		{
+			Name:     "Hidden",
+			Method:   MethodGET,
+			Path:     "/hidden",
+			Disabled: true,
+			Handler:  func(c *EndpointContext) error { return nil },
+		},
+	}, api)
+
+	return app
+}
+
+func TestOpenAPI_Operations(t *testing.T) {
+	doc := newOpenAPITestApp().OpenAPI(OpenAPIConfig{})
+
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.Equal(t, "Test API", doc.Info.Title)
+	assert.NotContains(t, doc.Paths, "/api/hidden")
+
+	list := doc.Paths["/api/users"]["get"]
+	require.NotNil(t, list)
+	assert.Equal(t, []string{"User"}, list.Tags)
+	assert.Empty(t, list.Security, "public endpoints need no credentials")
+	require.Len(t, list.Parameters, 1)
+	assert.Equal(t, "#/components/schemas/Filter", list.Parameters[0].Content["application/json"].Schema.Ref)
+
+	create := doc.Paths["/api/users"]["post"]
+	require.NotNil(t, create)
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {"admin"}}}, create.Security)
+	assert.Equal(t, "users:write", create.Scope)
+	assert.Contains(t, create.Responses, "401")
+	assert.Contains(t, create.Responses, "429")
+	require.NotNil(t, create.RequestBody)
+	assert.True(t, create.RequestBody.Required)
+	assert.Equal(t, "#/components/schemas/openAPICreateUser", create.RequestBody.Content["application/json"].Schema.Ref)
+
+	get := doc.Paths["/api/users/{id}"]["get"]
+	require.NotNil(t, get)
+	require.Len(t, get.Parameters, 1)
+	assert.Equal(t, "path", get.Parameters[0].In)
+	assert.True(t, get.Parameters[0].Required)
+	assert.Equal(t, "^[0-9a-fA-F]{24}$", get.Parameters[0].Schema.Pattern)
+
+	upload := doc.Paths["/api/users/{id}/avatar"]["post"]
+	require.NotNil(t, upload)
+	require.Len(t, upload.Parameters, 1, "undeclared path templates are described")
+	multipart := upload.RequestBody.Content["multipart/form-data"].Schema
+	assert.Equal(t, &OpenAPISchema{Type: "string", Format: "binary"}, multipart.Properties["avatar"])
+	assert.Equal(t, []string{"avatar"}, multipart.Required)
+}
+
+func TestOpenAPI_OperationIDs(t *testing.T) {
+	app := createTestApp()
+	upload := &Endpoint{
+		Name:    "Upload Files",
+		Method:  MethodPOST,
+		Path:    "/files",
+		Public:  true,
+		Handler: func(c *EndpointContext) error { return nil },
+	}
+	app.RegisterEndpoint(upload, app.Group("/v1"))
+	app.RegisterEndpoint(upload, app.Group("/v2"))
+
+	doc := app.OpenAPI(OpenAPIConfig{})
+
+	v1 := doc.Paths["/v1/files"]["post"]
+	v2 := doc.Paths["/v2/files"]["post"]
+	require.NotNil(t, v1, "every registration of an endpoint is described")
+	require.NotNil(t, v2)
+	assert.Equal(t, "Upload_Files", v1.OperationID)
+	assert.Equal(t, "Upload_Files2", v2.OperationID)
+}
+
+func TestOpenAPI_BodySchemaFromValidateTags(t *testing.T) {
+	doc := newOpenAPITestApp().OpenAPI(OpenAPIConfig{})
+
+	schema := doc.Components.Schemas["openAPICreateUser"]
+	require.NotNil(t, schema)
+	assert.ElementsMatch(t, []string{"name"}, schema.Required)
+	assert.NotContains(t, schema.Properties, "Internal")
+
+	name := schema.Properties["name"]
+	assert.Equal(t, 2, *name.MinLength)
+	assert.Equal(t, 50, *name.MaxLength)
+
+	assert.Equal(t, "email", schema.Properties["email"].Format)
+	assert.Equal(t, 18.0, *schema.Properties["age"].Minimum)
+	assert.Equal(t, 120.0, *schema.Properties["age"].Maximum)
+	assert.Equal(t, []any{"active", "inactive"}, schema.Properties["status"].Enum)
+	assert.Equal(t, 5, *schema.Properties["tags"].MaxItems)
+	assert.Nil(t, schema.Properties["tags"].MinItems, "rules after dive apply to the elements")
+	assert.Equal(t, "date-time", schema.Properties["birthday"].Format)
+
+	assert.Equal(t, "#/components/schemas/openAPIAddress", schema.Properties["address"].Ref)
+	assert.Equal(t, []string{"city"}, doc.Components.Schemas["openAPIAddress"].Required)
+	assert.Contains(t, doc.Components.Schemas, "ErrorResponse")
+	assert.Contains(t, doc.Components.Schemas, "Where")
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	app := newOpenAPITestApp()
+	app.ServeOpenAPI(OpenAPIConfig{SwaggerUIPath: "/docs"})
+
+	rec := httptest.NewRecorder()
+	app.EchoApp.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "3.1.0", doc["openapi"])
+	assert.Contains(t, doc["paths"], "/api/users")
+
+	rec = httptest.NewRecorder()
+	app.EchoApp.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `url: "/openapi.json"`)
+}
@@ -443,6 +443,7 @@ func TestParseBody_IntegrationWithEndpoint(t *testing.T) {
 			Name:   "test-endpoint",
 			Method: MethodPOST,
 			Path:   "/test",
+			Public: true,
 			BodyParams: func() any {
 				return &TestRequestBody{}
 			},
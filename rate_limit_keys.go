@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// RateLimitKeyFunc returns the value the requests of a RateLimit are counted
+// by, e.g. the ID of the principal. An empty value means the request has no
+// such dimension, and it is counted by IP instead.
+//
+// The built-in functions prefix their values with the dimension, e.g.
+// "principal:42", so limits keyed by different dimensions never share a counter.
+type RateLimitKeyFunc func(*EndpointContext) string
+
+// RateLimitByIP counts the requests of each client IP address
+func RateLimitByIP(e *EndpointContext) string {
+	return "ip:" + e.IpAddress
+}
+
+// RateLimitByIPAndRoute counts the requests of each client IP address to each
+// route. It only differs from RateLimitByIP in shared limits.
+func RateLimitByIPAndRoute(e *EndpointContext) string {
+	return "ip:" + e.IpAddress + ":route:" + e.EchoCtx.Request().Method + " " + e.EchoCtx.Path()
+}
+
+// RateLimitByPrincipal counts the requests of each authenticated principal
+func RateLimitByPrincipal(e *EndpointContext) string {
+	if e.Principal == nil || e.Principal.GetPrincipalID() == "" {
+		return ""
+	}
+	return "principal:" + e.Principal.GetPrincipalID()
+}
+
+// RateLimitByRole counts the requests of all the principals with the same role together
+func RateLimitByRole(e *EndpointContext) string {
+	if e.Principal == nil || e.Principal.GetPrincipalRole() == "" {
+		return ""
+	}
+	return "role:" + e.Principal.GetPrincipalRole()
+}
+
+// RateLimitByTenant counts the requests of all the principals of a tenant
+// together. The principal must implement TenantPrincipal.
+func RateLimitByTenant(e *EndpointContext) string {
+	principal, ok := e.Principal.(TenantPrincipal)
+	if !ok || principal.GetTenantID() == "" {
+		return ""
+	}
+	return "tenant:" + principal.GetTenantID()
+}
+
+// RateLimitByToken counts the requests made with each token, e.g. an API key.
+// Tokens are hashed, so they are never written to the store.
+func RateLimitByToken(e *EndpointContext) string {
+	if e.Token == nil || e.Token.GetToken() == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(e.Token.GetToken()))
+	return "token:" + hex.EncodeToString(sum[:16])
+}
+
+// rateLimitKey returns the counter key of limit for the request. Keys are
+// scoped by endpoint, unless the limit is shared, and by window, so stacked
+// limits keyed by the same dimension use their own counters.
+func rateLimitKey(e *EndpointContext, limit RateLimit) string {
+	if limit.Key != "" {
+		return limit.Key
+	}
+
+	value := ""
+	if limit.KeyFunc != nil {
+		value = limit.KeyFunc(e)
+	}
+	if value == "" {
+		value = RateLimitByIP(e)
+	}
+
+	scope := e.Endpoint.Name
+	if limit.Shared {
+		scope = "shared"
+	}
+
+	return scope + ":" + value + ":" + strconv.FormatInt(limit.Window.Milliseconds(), 10)
+}
+
+// rateLimits returns the limits of the endpoint for the request: the one of
+// RateLimiter followed by RateLimits or, when there are none, the defaults of
+// the application. Only the limit of RateLimiter is validated here, the static
+// ones are validated when the endpoint and the application are created.
+func (ep *Endpoint) rateLimits(e *EndpointContext) ([]RateLimit, error) {
+	var limits []RateLimit
+	if ep.RateLimiter != nil {
+		limit := ep.RateLimiter(e)
+		if err := limit.validate(); err != nil {
+			return nil, err
+		}
+		limits = append(limits, limit)
+	}
+	limits = append(limits, ep.RateLimits...)
+
+	if len(limits) == 0 && !ep.RateLimitExempt && ep.app != nil {
+		limits = ep.app.options.DefaultRateLimits
+	}
+
+	return limits, nil
+}
+
+// hasRateLimits reports whether requests to the endpoint can be rate limited
+func (ep *Endpoint) hasRateLimits() bool {
+	if ep.RateLimiter != nil || len(ep.RateLimits) > 0 {
+		return true
+	}
+	return !ep.RateLimitExempt && ep.app != nil && len(ep.app.options.DefaultRateLimits) > 0
+}
@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryRateLimitSweep is the number of requests between sweeps of the expired entries
+const memoryRateLimitSweep = 1000
+
+// MemoryRateLimitStore is a RateLimitStore that keeps its counters in the
+// process. Limits are not shared between instances of the application, so it
+// suits single instance deployments, development and tests.
+type MemoryRateLimitStore struct {
+	mu       sync.Mutex
+	entries  map[string]*memoryRateLimitEntry
+	requests int
+	now      func() time.Time
+}
+
+// memoryRateLimitEntry is the state of a key. Each algorithm uses its own fields.
+type memoryRateLimitEntry struct {
+	expires  int64   // Time after which the entry can be dropped, in ms
+	count    int64   // Fixed window: requests of the window
+	window   int64   // Sliding window: index of the current window
+	current  int64   // Sliding window: requests of the current window
+	previous int64   // Sliding window: requests of the previous window
+	log      []int64 // Sliding log: time of the requests, in ms
+	tokens   float64 // Token bucket: tokens left
+	updated  int64   // Token bucket: time of the last refill, in ms
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries: map[string]*memoryRateLimitEntry{},
+		now:     time.Now,
+	}
+}
+
+func (store *MemoryRateLimitStore) Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	if err := limit.validate(); err != nil {
+		return RateLimitResult{}, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := store.now().UnixMilli()
+	store.sweep(now)
+
+	algorithm := limit.algorithm()
+	entryKey := key + ":" + string(algorithm)
+	entry, ok := store.entries[entryKey]
+	if !ok || entry.expires <= now {
+		entry = &memoryRateLimitEntry{}
+		store.entries[entryKey] = entry
+	}
+
+	window := limit.Window.Milliseconds()
+	switch algorithm {
+	case RateLimitFixedWindow:
+		if entry.count == 0 {
+			entry.expires = now + window
+		}
+		entry.count++
+		return fixedWindowResult(limit, entry.count, entry.expires-now), nil
+
+	case RateLimitSlidingLog:
+		for len(entry.log) > 0 && entry.log[0] <= now-window {
+			entry.log = entry.log[1:]
+		}
+		allowed := len(entry.log) < limit.Max
+		if allowed {
+			entry.log = append(entry.log, now)
+		}
+		entry.expires = now + window
+
+		var oldest, newest int64
+		if len(entry.log) > 0 {
+			oldest = entry.log[0] + window - now
+			newest = entry.log[len(entry.log)-1] + window - now
+		}
+		return slidingLogResult(limit, allowed, int64(len(entry.log)), oldest, newest), nil
+
+	case RateLimitTokenBucket:
+		rate := tokenBucketRate(limit)
+		if entry.updated == 0 {
+			entry.tokens = float64(limit.Max)
+		} else if now > entry.updated {
+			entry.tokens = min(float64(limit.Max), entry.tokens+float64(now-entry.updated)*rate)
+		}
+		entry.updated = now
+
+		allowed := entry.tokens >= 1
+		if allowed {
+			entry.tokens--
+		}
+		entry.expires = now + window
+		return tokenBucketResult(limit, allowed, entry.tokens, rate), nil
+
+	default:
+		index := now / window
+		if entry.window != index {
+			if entry.window == index-1 {
+				entry.previous = entry.current
+			} else {
+				entry.previous = 0
+			}
+			entry.current = 0
+			entry.window = index
+		}
+
+		elapsed := now - index*window
+		allowed := slidingWindowEstimate(window, elapsed, entry.current+1, entry.previous) <= float64(limit.Max)
+		if allowed {
+			entry.current++
+		}
+		entry.expires = (index + 2) * window
+		return slidingWindowResult(limit, allowed, window, elapsed, entry.current, entry.previous), nil
+	}
+}
+
+// Reset clears all the counters
+func (store *MemoryRateLimitStore) Reset() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.entries = map[string]*memoryRateLimitEntry{}
+}
+
+// sweep drops the expired entries every memoryRateLimitSweep requests. The
+// caller must hold the lock.
+func (store *MemoryRateLimitStore) sweep(now int64) {
+	store.requests++
+	if store.requests < memoryRateLimitSweep {
+		return
+	}
+
+	store.requests = 0
+	for key, entry := range store.entries {
+		if entry.expires <= now {
+			delete(store.entries, key)
+		}
+	}
+}
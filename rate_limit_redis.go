@@ -0,0 +1,183 @@
+package rest
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisRateLimitStore is a RateLimitStore backed by Redis, so limits are
+// shared by every instance of the application. Each algorithm runs as a Lua
+// script, which keeps concurrent requests atomic.
+//
+// Keys are wrapped in a hash tag, e.g. "{Login_10.0.0.1}:sw:42", so the keys
+// of a limit are stored in the same Redis Cluster slot.
+type RedisRateLimitStore struct {
+	client redis.UniversalClient
+	now    func() time.Time
+}
+
+func NewRedisRateLimitStore(client redis.UniversalClient) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client, now: time.Now}
+}
+
+// fixedWindowScript counts a request in KEYS[1], which expires ARGV[1] ms
+// after the first request. Returns the count and the ms left in the window.
+var fixedWindowScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {count, ttl}
+`)
+
+// slidingLogScript keeps the requests of the last ARGV[2] ms in the sorted set
+// KEYS[1], scored by time. ARGV: now (ms), window (ms), max, member. Returns
+// whether the request was allowed, the requests in the window and the ms until
+// the oldest and the newest of them expire.
+var slidingLogScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+local oldestExpiry, newestExpiry = 0, 0
+if oldest[2] then
+	oldestExpiry = tonumber(oldest[2]) + window - now
+	newestExpiry = tonumber(newest[2]) + window - now
+end
+return {allowed, count, oldestExpiry, newestExpiry}
+`)
+
+// slidingWindowScript counts a request in KEYS[1], the counter of the current
+// window, when the count of the previous window KEYS[2], weighted by its
+// overlap, plus the current count stays within the limit. ARGV: max, window
+// (ms), ms elapsed in the current window. Returns whether the request was
+// allowed and both counts.
+var slidingWindowScript = redis.NewScript(`
+local max = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+local allowed = 0
+if previous * (window - elapsed) / window + current + 1 <= max then
+	current = redis.call('INCR', KEYS[1])
+	redis.call('PEXPIRE', KEYS[1], window * 2 - elapsed)
+	allowed = 1
+end
+return {allowed, current, previous}
+`)
+
+// tokenBucketScript takes a token from the bucket KEYS[1], a hash with the
+// tokens left and the time of the last refill. ARGV: capacity, refill rate
+// (tokens per ms), now (ms), ttl (ms). Returns whether the request was allowed
+// and the tokens left, as a string to keep the fraction.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or capacity
+local updated = tonumber(bucket[2]) or now
+if now > updated then
+	tokens = math.min(capacity, tokens + (now - updated) * rate)
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {allowed, tostring(tokens)}
+`)
+
+func (store *RedisRateLimitStore) Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	if err := limit.validate(); err != nil {
+		return RateLimitResult{}, err
+	}
+
+	now := store.now().UnixMilli()
+	window := limit.Window.Milliseconds()
+	tag := "{" + key + "}"
+
+	switch limit.algorithm() {
+	case RateLimitFixedWindow:
+		values, err := runRateLimitScript(ctx, store.client, fixedWindowScript, 2, []string{tag + ":fw"}, window)
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		return fixedWindowResult(limit, values[0], values[1]), nil
+
+	case RateLimitSlidingLog:
+		member := strconv.FormatInt(now, 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+		values, err := runRateLimitScript(ctx, store.client, slidingLogScript, 4, []string{tag + ":sl"}, now, window, limit.Max, member)
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		return slidingLogResult(limit, values[0] == 1, values[1], values[2], values[3]), nil
+
+	case RateLimitTokenBucket:
+		rate := tokenBucketRate(limit)
+		result, err := tokenBucketScript.Run(ctx, store.client, []string{tag + ":tb"}, limit.Max, rate, now, window).Slice()
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		if len(result) != 2 {
+			return RateLimitResult{}, errors.Errorf("unexpected token bucket reply %v", result)
+		}
+
+		allowed, _ := result[0].(int64)
+		tokens, err := strconv.ParseFloat(toString(result[1]), 64)
+		if err != nil {
+			return RateLimitResult{}, errors.Errorf("unexpected token bucket reply %v", result)
+		}
+		return tokenBucketResult(limit, allowed == 1, tokens, rate), nil
+
+	default:
+		index := now / window
+		elapsed := now - index*window
+		keys := []string{tag + ":sw:" + strconv.FormatInt(index, 10), tag + ":sw:" + strconv.FormatInt(index-1, 10)}
+		values, err := runRateLimitScript(ctx, store.client, slidingWindowScript, 3, keys, limit.Max, window, elapsed)
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		return slidingWindowResult(limit, values[0] == 1, window, elapsed, values[1], values[2]), nil
+	}
+}
+
+// runRateLimitScript runs script and returns its reply, a list of size integers
+func runRateLimitScript(ctx context.Context, client redis.Scripter, script *redis.Script, size int, keys []string, args ...any) ([]int64, error) {
+	values, err := script.Run(ctx, client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) != size {
+		return nil, errors.Errorf("unexpected rate limit reply %v", values)
+	}
+
+	return values, nil
+}
+
+func toString(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return ""
+}
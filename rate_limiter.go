@@ -2,93 +2,341 @@ package rest
 
 import (
 	"context"
+	"crypto/tls"
+	"log/slog"
+	"math"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/gommon/log"
+	"github.com/go-errors/errors"
 	"github.com/redis/go-redis/v9"
+	"github.com/xompass/vsaas-rest/http_errors"
 )
 
-// Este archivo implementa un limitador de splicitudes (rate limiter) para los endpoints HTTP utilizando Redis.
+// Este archivo implementa un limitador de solicitudes (rate limiter) para los endpoints HTTP.
 // Incluye las siguientes funcionalidades principales:
-// 1. Configuración del cliente Redis utilizando las variables de entorno para el host, puerto y contraseña.
-// 2. Definición de la función rateLimiter que aplica la limitación de tasa a un endpoint específico.
-// 3. Implementación de la función checkRateLimit que verifica y aplica la limitación de tasa basada en la dirección IP del cliente y el nombre del endpoint.
-// 4. Funciones auxiliares para obtener la configuración de Redis desde las variables de entorno.
+// 1. Configuración del cliente Redis desde RestAppOptions (servidor único, Sentinel o Cluster, con TLS y usuario ACL)
+//    o, por defecto, desde las variables de entorno para el host, puerto, usuario y contraseña.
+// 2. Definición de los algoritmos de limitación (ventana fija, ventana deslizante, registro deslizante y token bucket).
+// 3. Implementación de la función checkRateLimit que verifica y aplica los límites del endpoint (o los límites por defecto de la aplicación).
+//    Cada límite cuenta las solicitudes por una dimensión: IP, principal, rol, tenant, token o una función propia (rate_limit_keys.go).
+//    Las solicitudes se registran en un RateLimitStore: Redis (rate_limit_redis.go), memoria (rate_limit_memory.go) o uno propio (p. ej. en tests).
+// 4. Envío de las cabeceras X-RateLimit-* y Retry-After para que los clientes conozcan su cuota.
+// 5. Funciones auxiliares para obtener la configuración de Redis desde las variables de entorno.
 
-var ctx = context.Background()
+// Error codes returned by the rate limiting stage
+const (
+	RATE_LIMIT_EXCEEDED    = "RATE_LIMIT_EXCEEDED"
+	RATE_LIMIT_UNAVAILABLE = "RATE_LIMIT_UNAVAILABLE"
+)
 
-func newRedisClient() *redis.Client {
-	redisHost := getRedisHost()
-	redisPort := getRedisPort()
-	redisPassword := getRedisPassword()
+// Rate limit response headers
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitReset     = "X-RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+)
 
-	return redis.NewClient(&redis.Options{
-		Addr:     redisHost + ":" + redisPort,
-		Password: redisPassword,
-		DB:       1, // Use database 1 for rate limiting
+// RateLimitAlgorithm selects how the requests of a RateLimit are counted
+type RateLimitAlgorithm string
+
+const (
+	// RateLimitSlidingWindow weights the count of the previous window by its
+	// overlap with a window ending now. It uses two counters per key and is the
+	// default algorithm.
+	RateLimitSlidingWindow RateLimitAlgorithm = "sliding_window"
+	// RateLimitSlidingLog keeps the time of every request made during the last
+	// window. It is exact, but uses memory proportional to Max.
+	RateLimitSlidingLog RateLimitAlgorithm = "sliding_log"
+	// RateLimitTokenBucket refills Max tokens per Window, one request costs a
+	// token. Bursts of up to Max requests are allowed.
+	RateLimitTokenBucket RateLimitAlgorithm = "token_bucket"
+	// RateLimitFixedWindow counts the requests of fixed windows. It allows up to
+	// twice Max requests around the end of a window.
+	RateLimitFixedWindow RateLimitAlgorithm = "fixed_window"
+)
+
+// RateLimitResult is the outcome of recording a request in a RateLimitStore
+type RateLimitResult struct {
+	Allowed    bool          // Whether the request is within the limit
+	Limit      int           // Max requests of the limit
+	Remaining  int           // Requests left before the limit is reached
+	Reset      time.Duration // Time until the limit is fully restored
+	RetryAfter time.Duration // Time until the next request is allowed, when Allowed is false
+}
+
+// RateLimitStore records the requests made with a key and applies the
+// algorithm of the RateLimit
+type RateLimitStore interface {
+	// Allow records a request made with key and reports whether it is within limit
+	Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// RedisConfig configures the Redis connection of the rate limiter. A single
+// address connects to a standalone server, MasterName enables Sentinel
+// failover and several addresses, or Cluster, connect to a Redis Cluster.
+type RedisConfig struct {
+	Addrs            []string      // host:port of the server, of the Sentinels or of the Cluster seed nodes
+	MasterName       string        // Sentinel master name
+	Cluster          bool          // Connect to a Redis Cluster, even with a single seed address
+	Username         string        // ACL username
+	Password         string        // Password of the ACL user, or the server password
+	SentinelUsername string        // ACL username of the Sentinels
+	SentinelPassword string        // Password of the Sentinels
+	DB               int           // Database number. Not supported by Cluster
+	TLS              *tls.Config   // Enables TLS when set
+	Timeout          time.Duration // Dial, read and write timeout. Defaults to the go-redis timeouts
+}
+
+// newRedisClient creates the client of config, or of the REDIS_* environment
+// variables when config is nil. Missing variables are logged to logger.
+func newRedisClient(config *RedisConfig, logger *slog.Logger) redis.UniversalClient {
+	if config == nil {
+		config = redisConfigFromEnv(logger)
+	}
+
+	return redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            config.Addrs,
+		MasterName:       config.MasterName,
+		IsClusterMode:    config.Cluster,
+		Username:         config.Username,
+		Password:         config.Password,
+		SentinelUsername: config.SentinelUsername,
+		SentinelPassword: config.SentinelPassword,
+		DB:               config.DB,
+		TLSConfig:        config.TLS,
+		DialTimeout:      config.Timeout,
+		ReadTimeout:      config.Timeout,
+		WriteTimeout:     config.Timeout,
 	})
 }
 
+func redisConfigFromEnv(logger *slog.Logger) *RedisConfig {
+	return &RedisConfig{
+		Addrs:    []string{getRedisHost(logger) + ":" + getRedisPort(logger)},
+		Username: os.Getenv("REDIS_USERNAME"),
+		Password: getRedisPassword(),
+		DB:       1, // Use database 1 for rate limiting
+	}
+}
+
+// checkRateLimit records the request in every limit of the endpoint, in
+// order. The request is rejected by the first limit it exceeds, and the
+// remaining limits are not recorded. The limits before it keep the request:
+// each store records a key atomically, but not several keys at once, so a
+// rejected request still counts against the earlier limits.
 func checkRateLimit(e *EndpointContext) error {
-	redisClient := e.App.redisClient
-	rateLimiter := e.Endpoint.RateLimiter
+	store := e.App.rateLimitStore
+	limits, err := e.Endpoint.rateLimits(e)
+	if err != nil {
+		return err
+	}
 
-	if rateLimiter == nil {
+	if len(limits) == 0 {
 		return nil
 	}
 
-	rateLimit := e.Endpoint.RateLimiter(e)
+	if store == nil {
+		e.Logger().Warn("Rate limiter configured for the endpoint but the application has no rate limit store")
+		return nil
+	}
 
-	ip := e.IpAddress
-	name := e.Endpoint.Name
+	var reported RateLimitResult
+	for i, limit := range limits {
+		key := e.App.options.RateLimitKeyPrefix + rateLimitKey(e, limit)
+		result, err := store.Allow(e.Context(), key, limit)
+		if err != nil {
+			if e.App.options.RateLimitFailOpen {
+				e.Logger().Error("Rate limit store failed, allowing request", "error", err)
+				continue
+			}
 
-	key := name + "_" + ip
-	if rateLimit.Key != "" {
-		key = rateLimit.Key
-	}
+			e.Logger().Error("Rate limit store failed, rejecting request", "error", err)
+			return http_errors.ServiceUnavailableErrorWithCode(RATE_LIMIT_UNAVAILABLE, "Rate limiting is temporarily unavailable")
+		}
 
-	pipe := redisClient.TxPipeline()
-	incrCmd := pipe.Incr(ctx, key)
-	expireCmd := pipe.ExpireNX(ctx, key, rateLimit.Window)
+		// The headers describe the limit closest to being exceeded
+		if i == 0 || !result.Allowed || result.Remaining < reported.Remaining {
+			reported = result
+		}
 
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return err
+		if !result.Allowed {
+			setRateLimitHeaders(e.EchoCtx.Response().Header(), reported)
+			e.Logger().Warn("Rate limit exceeded", "key", key, "max", limit.Max, "window", limit.Window)
+			e.App.metrics.rateLimited(e.Endpoint.Name)
+			return http_errors.TooManyRequestsErrorWithCode(RATE_LIMIT_EXCEEDED, "Rate limit exceeded")
+		}
 	}
 
-	count, err := incrCmd.Result()
-	if err != nil {
-		return err
+	setRateLimitHeaders(e.EchoCtx.Response().Header(), reported)
+	return nil
+}
+
+// setRateLimitHeaders lets clients discover their quota. Durations are sent in
+// whole seconds, rounded up.
+func setRateLimitHeaders(header http.Header, result RateLimitResult) {
+	header.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+	header.Set(HeaderRateLimitRemaining, strconv.Itoa(max(result.Remaining, 0)))
+	header.Set(HeaderRateLimitReset, strconv.FormatInt(ceilSeconds(result.Reset), 10))
+
+	if !result.Allowed {
+		header.Set(HeaderRetryAfter, strconv.FormatInt(max(ceilSeconds(result.RetryAfter), 1), 10))
 	}
+}
 
-	_, err = expireCmd.Result()
-	if err != nil {
-		return err
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
 	}
+	return int64(math.Ceil(d.Seconds()))
+}
 
-	if count > int64(rateLimit.Max) {
-		log.Warnf("Rate limit exceeded for %s: %d requests", key, count)
-		return echo.ErrTooManyRequests
+// algorithm returns the algorithm of the limit, defaulting to RateLimitSlidingWindow
+func (limit RateLimit) algorithm() RateLimitAlgorithm {
+	if limit.Algorithm == "" {
+		return RateLimitSlidingWindow
 	}
+	return limit.Algorithm
+}
 
+// validateRateLimits checks the static limits of the endpoint, when it is registered
+func (ep *Endpoint) validateRateLimits() error {
+	for _, limit := range ep.RateLimits {
+		if err := limit.validate(); err != nil {
+			return errors.Errorf("endpoint %s: %v", ep.Name, err)
+		}
+	}
 	return nil
 }
 
-func getRedisHost() string {
+// validate checks that the limit can be applied
+func (limit RateLimit) validate() error {
+	if limit.Max < 1 {
+		return errors.Errorf("invalid rate limit: Max must be at least 1, got %d", limit.Max)
+	}
+
+	if limit.Window < time.Millisecond {
+		return errors.Errorf("invalid rate limit: Window must be at least 1ms, got %s", limit.Window)
+	}
+
+	switch limit.algorithm() {
+	case RateLimitSlidingWindow, RateLimitSlidingLog, RateLimitTokenBucket, RateLimitFixedWindow:
+		return nil
+	}
+
+	return errors.Errorf("invalid rate limit: unknown algorithm %q", limit.Algorithm)
+}
+
+// The functions below build a RateLimitResult from the state of an algorithm.
+// They are shared by the memory and Redis stores, so both report the same
+// headers. Times are in milliseconds.
+
+func fixedWindowResult(limit RateLimit, count int64, ttl int64) RateLimitResult {
+	result := RateLimitResult{
+		Allowed:   count <= int64(limit.Max),
+		Limit:     limit.Max,
+		Remaining: int(max(int64(limit.Max)-count, 0)),
+		Reset:     time.Duration(ttl) * time.Millisecond,
+	}
+	if !result.Allowed {
+		result.RetryAfter = result.Reset
+	}
+	return result
+}
+
+// slidingLogResult reports a log of count requests whose oldest and newest
+// requests expire in oldest and newest milliseconds
+func slidingLogResult(limit RateLimit, allowed bool, count int64, oldest int64, newest int64) RateLimitResult {
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.Max,
+		Remaining: int(max(int64(limit.Max)-count, 0)),
+		Reset:     time.Duration(max(newest, 0)) * time.Millisecond,
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(max(oldest, 1)) * time.Millisecond
+	}
+	return result
+}
+
+// slidingWindowEstimate is the number of requests made during the window
+// ending now, elapsed milliseconds into the current window. A request is
+// allowed while the estimate including it does not exceed Max.
+func slidingWindowEstimate(window int64, elapsed int64, current int64, previous int64) float64 {
+	return float64(previous)*float64(window-elapsed)/float64(window) + float64(current)
+}
+
+// slidingWindowResult reports the counters of the current and previous
+// windows, after the request was counted when allowed
+func slidingWindowResult(limit RateLimit, allowed bool, window int64, elapsed int64, current int64, previous int64) RateLimitResult {
+	estimate := slidingWindowEstimate(window, elapsed, current, previous)
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.Max,
+		Remaining: max(int(math.Floor(float64(limit.Max)-estimate)), 0),
+		Reset:     time.Duration(window-elapsed) * time.Millisecond,
+	}
+	if current > 0 {
+		result.Reset += time.Duration(window) * time.Millisecond
+	}
+
+	if !allowed {
+		// Requests that may already be counted for the next one to be allowed
+		budget := float64(limit.Max - 1)
+		var wait float64
+		if float64(current) <= budget && previous > 0 {
+			// The previous window fades enough before the current one ends
+			wait = float64(window-elapsed) - (budget-float64(current))*float64(window)/float64(previous)
+		} else {
+			// The current window becomes the previous one and must fade
+			wait = float64(window - elapsed)
+			if current > 0 {
+				wait += math.Max(float64(window)*(1-budget/float64(current)), 0)
+			}
+		}
+		result.RetryAfter = time.Duration(math.Max(math.Ceil(wait), 1)) * time.Millisecond
+	}
+
+	return result
+}
+
+// tokenBucketResult reports a bucket left with tokens, refilled at rate
+// tokens per millisecond
+func tokenBucketResult(limit RateLimit, allowed bool, tokens float64, rate float64) RateLimitResult {
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.Max,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration(math.Ceil((float64(limit.Max)-tokens)/rate)) * time.Millisecond,
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(math.Max(math.Ceil((1-tokens)/rate), 1)) * time.Millisecond
+	}
+	return result
+}
+
+// tokenBucketRate is the refill rate of a bucket, in tokens per millisecond
+func tokenBucketRate(limit RateLimit) float64 {
+	return float64(limit.Max) / float64(max(limit.Window.Milliseconds(), 1))
+}
+
+func getRedisHost(logger *slog.Logger) string {
 	host, ok := os.LookupEnv("REDIS_HOST")
 	if !ok {
-		log.Warn("REDIS_HOST environment variable not set, using default 'localhost'")
+		loggerOrDefault(logger).Warn("REDIS_HOST environment variable not set, using default 'localhost'")
 		return "localhost"
 	}
 
 	return host
 }
 
-func getRedisPort() string {
+func getRedisPort(logger *slog.Logger) string {
 	port, ok := os.LookupEnv("REDIS_PORT")
 	if !ok {
-		log.Warn("REDIS_PORT environment variable not set, using default '6379'")
+		loggerOrDefault(logger).Warn("REDIS_PORT environment variable not set, using default '6379'")
 		return "6379"
 	}
 
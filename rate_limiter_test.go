@@ -0,0 +1,378 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitStep is a request made after advancing the clock by wait
+type rateLimitStep struct {
+	wait    time.Duration
+	allowed bool
+}
+
+var rateLimitCases = []struct {
+	name  string
+	limit RateLimit
+	steps []rateLimitStep
+}{
+	{
+		"fixed window",
+		RateLimit{Max: 2, Window: time.Second, Algorithm: RateLimitFixedWindow},
+		[]rateLimitStep{{0, true}, {100 * time.Millisecond, true}, {100 * time.Millisecond, false}, {800 * time.Millisecond, true}, {0, true}, {0, false}},
+	},
+	{
+		"sliding log",
+		RateLimit{Max: 2, Window: time.Second, Algorithm: RateLimitSlidingLog},
+		[]rateLimitStep{{0, true}, {500 * time.Millisecond, true}, {400 * time.Millisecond, false}, {200 * time.Millisecond, true}, {0, false}, {500 * time.Millisecond, true}},
+	},
+	{
+		"sliding window",
+		RateLimit{Max: 4, Window: time.Second},
+		[]rateLimitStep{{0, true}, {0, true}, {0, true}, {0, true}, {0, false}, {1250 * time.Millisecond, true}, {0, false}, {500 * time.Millisecond, true}, {0, true}, {0, false}},
+	},
+	{
+		"token bucket",
+		RateLimit{Max: 2, Window: time.Second, Algorithm: RateLimitTokenBucket},
+		[]rateLimitStep{{0, true}, {0, true}, {0, false}, {499 * time.Millisecond, false}, {time.Millisecond, true}, {0, false}, {2 * time.Second, true}, {0, true}, {0, false}},
+	},
+}
+
+func TestMemoryRateLimitStore_Algorithms(t *testing.T) {
+	for _, tt := range rateLimitCases {
+		t.Run(tt.name, func(t *testing.T) {
+			// Start on a window boundary so the sliding window steps are predictable
+			now := time.UnixMilli(1_700_000_000_000)
+			store := NewMemoryRateLimitStore()
+			store.now = func() time.Time { return now }
+
+			for i, step := range tt.steps {
+				now = now.Add(step.wait)
+				result, err := store.Allow(context.Background(), "key", tt.limit)
+				require.NoError(t, err)
+				assert.Equal(t, step.allowed, result.Allowed, "step %d", i)
+				assert.Equal(t, tt.limit.Max, result.Limit)
+				if step.allowed {
+					assert.Zero(t, result.RetryAfter, "step %d", i)
+				} else {
+					assert.Positive(t, result.RetryAfter, "step %d", i)
+				}
+			}
+		})
+	}
+}
+
+// TestRedisRateLimitStore_MatchesMemory runs the Lua scripts on miniredis and
+// checks that they report the same results as the memory store
+func TestRedisRateLimitStore_MatchesMemory(t *testing.T) {
+	for _, tt := range rateLimitCases {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			t.Cleanup(func() { _ = client.Close() })
+
+			now := time.UnixMilli(1_700_000_000_000)
+			clock := func() time.Time { return now }
+			redisStore := NewRedisRateLimitStore(client)
+			redisStore.now = clock
+			memoryStore := NewMemoryRateLimitStore()
+			memoryStore.now = clock
+
+			for i, step := range tt.steps {
+				now = now.Add(step.wait)
+				server.FastForward(step.wait)
+
+				expected, err := memoryStore.Allow(context.Background(), "key", tt.limit)
+				require.NoError(t, err)
+				result, err := redisStore.Allow(context.Background(), "key", tt.limit)
+				require.NoError(t, err)
+				assert.Equal(t, expected, result, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestRateLimitStore_InvalidLimit(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	stores := map[string]RateLimitStore{"memory": NewMemoryRateLimitStore(), "redis": NewRedisRateLimitStore(client)}
+	for name, store := range stores {
+		_, err := store.Allow(context.Background(), "key", RateLimit{Max: 0, Window: time.Second})
+		assert.Error(t, err, name)
+		_, err = store.Allow(context.Background(), "key", RateLimit{Max: 1, Window: time.Second, Algorithm: "leaky"})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRateLimits_Validation(t *testing.T) {
+	assert.PanicsWithError(t, "DefaultRateLimits: invalid rate limit: Max must be at least 1, got 0", func() {
+		NewRestApp(RestAppOptions{LogLevel: LogLevelError, DefaultRateLimits: []RateLimit{{Window: time.Second}}})
+	})
+
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError, RateLimitStore: NewMemoryRateLimitStore()})
+	handler := func(c *EndpointContext) error { return c.NoContent() }
+	err := app.RegisterEndpoint(&Endpoint{
+		Name: "Invalid", Method: MethodGET, Path: "/invalid", Public: true, Handler: handler,
+		RateLimits: []RateLimit{{Max: 1, Window: time.Second, Algorithm: "leaky"}},
+	}, app.Group("/api"))
+	assert.EqualError(t, err, `endpoint Invalid: invalid rate limit: unknown algorithm "leaky"`)
+
+	require.NoError(t, app.RegisterEndpoint(&Endpoint{
+		Name: "Dynamic", Method: MethodGET, Path: "/dynamic", Public: true, Handler: handler,
+		RateLimiter: func(*EndpointContext) RateLimit { return RateLimit{Max: 1} },
+	}, app.Group("/api")))
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/dynamic", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "the limits of RateLimiter are validated per request")
+}
+
+func TestCheckRateLimit_Headers(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError, RateLimitStore: NewMemoryRateLimitStore()})
+	app.RegisterEndpoint(&Endpoint{
+		Name:   "Limited",
+		Method: MethodGET,
+		Path:   "/limited",
+		Public: true,
+		RateLimiter: func(*EndpointContext) RateLimit {
+			return RateLimit{Max: 2, Window: time.Minute, Algorithm: RateLimitFixedWindow}
+		},
+		Handler: func(c *EndpointContext) error { return c.NoContent() },
+	}, app.Group("/api"))
+
+	request := func() *http.Response {
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/limited", nil))
+		require.NoError(t, err)
+		return res
+	}
+
+	res := request()
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", res.Header.Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "60", res.Header.Get(HeaderRateLimitReset))
+	assert.Empty(t, res.Header.Get(HeaderRetryAfter))
+
+	request()
+	res = request()
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "0", res.Header.Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "60", res.Header.Get(HeaderRetryAfter))
+	body, _ := io.ReadAll(res.Body)
+	assert.Contains(t, string(body), RATE_LIMIT_EXCEEDED)
+}
+
+type testTenantPrincipal struct {
+	testPrincipal
+	tenant string
+}
+
+func (p testTenantPrincipal) GetTenantID() string { return p.tenant }
+
+func TestRateLimitKey_Strategies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/reports/1", nil)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.SetPath("/api/reports/:id")
+
+	e := &EndpointContext{
+		EchoCtx:   c,
+		Endpoint:  &Endpoint{Name: "GetReport"},
+		IpAddress: "10.0.0.1",
+		Principal: testTenantPrincipal{testPrincipal{id: "u1", role: "admin"}, "acme"},
+		Token:     testToken{valid: true},
+	}
+	anonymous := &EndpointContext{EchoCtx: c, Endpoint: e.Endpoint, IpAddress: "10.0.0.2"}
+
+	tests := []struct {
+		name      string
+		limit     RateLimit
+		key       string
+		anonymous string
+	}{
+		{"default", RateLimit{Window: time.Second}, "GetReport:ip:10.0.0.1:1000", "GetReport:ip:10.0.0.2:1000"},
+		{"fixed key", RateLimit{Window: time.Second, Key: "reports", KeyFunc: RateLimitByPrincipal}, "reports", "reports"},
+		{"principal", RateLimit{Window: time.Second, KeyFunc: RateLimitByPrincipal}, "GetReport:principal:u1:1000", "GetReport:ip:10.0.0.2:1000"},
+		{"role", RateLimit{Window: time.Minute, KeyFunc: RateLimitByRole}, "GetReport:role:admin:60000", "GetReport:ip:10.0.0.2:60000"},
+		{"tenant", RateLimit{Window: time.Second, KeyFunc: RateLimitByTenant, Shared: true}, "shared:tenant:acme:1000", "shared:ip:10.0.0.2:1000"},
+		{"token", RateLimit{Window: time.Second, KeyFunc: RateLimitByToken}, "GetReport:token:3c469e9d6c5875d37a43f353d4f88e61:1000", "GetReport:ip:10.0.0.2:1000"},
+		{"ip and route", RateLimit{Window: time.Second, KeyFunc: RateLimitByIPAndRoute, Shared: true}, "shared:ip:10.0.0.1:route:GET /api/reports/:id:1000", "shared:ip:10.0.0.2:route:GET /api/reports/:id:1000"},
+		{
+			"custom",
+			RateLimit{Window: time.Second, KeyFunc: func(e *EndpointContext) string { return e.EchoCtx.Request().Header.Get("X-Device") }},
+			"GetReport:ip:10.0.0.1:1000",
+			"GetReport:ip:10.0.0.2:1000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.key, rateLimitKey(e, tt.limit))
+			assert.Equal(t, tt.anonymous, rateLimitKey(anonymous, tt.limit))
+		})
+	}
+}
+
+func TestCheckRateLimit_StackedAndDefaultLimits(t *testing.T) {
+	app := NewRestApp(RestAppOptions{
+		LogLevel:          LogLevelError,
+		RateLimitStore:    NewMemoryRateLimitStore(),
+		DefaultRateLimits: []RateLimit{{Max: 1, Window: time.Minute, Algorithm: RateLimitFixedWindow}},
+	})
+	app.authorizer = func(c *EndpointContext) (Principal, AuthToken, error) {
+		return testPrincipal{id: c.EchoCtx.Request().Header.Get("X-User"), role: "user"}, testToken{valid: true}, nil
+	}
+
+	global := RateLimit{Max: 3, Window: time.Minute, Key: "global", Algorithm: RateLimitFixedWindow}
+	perUser := RateLimit{Max: 2, Window: time.Minute, KeyFunc: RateLimitByPrincipal, Algorithm: RateLimitFixedWindow}
+	handler := func(c *EndpointContext) error { return c.NoContent() }
+	app.RegisterEndpoints([]*Endpoint{
+		{Name: "Stacked", Method: MethodGET, Path: "/stacked", RateLimits: []RateLimit{perUser, global}, Handler: handler},
+		{Name: "Defaulted", Method: MethodGET, Path: "/defaulted", Handler: handler},
+		{Name: "Exempt", Method: MethodGET, Path: "/exempt", RateLimitExempt: true, Handler: handler},
+	}, app.Group("/api"))
+
+	request := func(path string, user string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-User", user)
+		res, err := app.Test(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := request("/api/stacked", "u1")
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get(HeaderRateLimitRemaining), "the headers describe the most restrictive limit")
+	assert.Equal(t, "2", res.Header.Get(HeaderRateLimitLimit))
+
+	assert.Equal(t, http.StatusNoContent, request("/api/stacked", "u1").StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, request("/api/stacked", "u1").StatusCode, "per user limit")
+
+	assert.Equal(t, http.StatusNoContent, request("/api/stacked", "u2").StatusCode)
+	res = request("/api/stacked", "u3")
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode, "global limit")
+	assert.Equal(t, "3", res.Header.Get(HeaderRateLimitLimit))
+
+	assert.Equal(t, http.StatusNoContent, request("/api/defaulted", "u1").StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, request("/api/defaulted", "u1").StatusCode)
+
+	for range 3 {
+		res = request("/api/exempt", "u1")
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.Empty(t, res.Header.Get(HeaderRateLimitLimit))
+	}
+}
+
+func TestCheckRateLimit_RejectedRequestsCountAgainstEarlierLimits(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError, RateLimitStore: NewMemoryRateLimitStore()})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+
+	first := RateLimit{Max: 2, Window: time.Minute, Key: "first", Algorithm: RateLimitFixedWindow}
+	second := RateLimit{Max: 1, Window: time.Minute, Key: "second", Algorithm: RateLimitFixedWindow}
+	handler := func(c *EndpointContext) error { return c.NoContent() }
+	require.NoError(t, app.RegisterEndpoints([]*Endpoint{
+		{Name: "Both", Method: MethodGET, Path: "/both", RateLimits: []RateLimit{first, second}, Handler: handler},
+		{Name: "First", Method: MethodGET, Path: "/first", RateLimits: []RateLimit{first}, Handler: handler},
+	}, app.Group("/api")))
+
+	request := func(path string) int {
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusNoContent, request("/api/both"))
+	assert.Equal(t, http.StatusTooManyRequests, request("/api/both"), "rejected by the second limit")
+	assert.Equal(t, http.StatusTooManyRequests, request("/api/first"), "the rejected request was recorded in the first limit")
+}
+
+func TestNewRedisClient_Modes(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *RedisConfig
+		client any
+	}{
+		{"standalone", &RedisConfig{Addrs: []string{"localhost:6379"}}, &redis.Client{}},
+		{"sentinel", &RedisConfig{Addrs: []string{"localhost:26379"}, MasterName: "mymaster"}, &redis.Client{}},
+		{"cluster seeds", &RedisConfig{Addrs: []string{"localhost:7000", "localhost:7001"}}, &redis.ClusterClient{}},
+		{"cluster endpoint", &RedisConfig{Addrs: []string{"localhost:7000"}, Cluster: true}, &redis.ClusterClient{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newRedisClient(tt.config, nil)
+			t.Cleanup(func() { _ = client.Close() })
+			assert.IsType(t, tt.client, client)
+		})
+	}
+}
+
+func TestCheckRateLimit_RedisOptions(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("limiter", "secret")
+
+	app := NewRestApp(RestAppOptions{
+		LogLevel:           LogLevelError,
+		EnableRateLimiter:  true,
+		Redis:              &RedisConfig{Addrs: []string{server.Addr()}, Username: "limiter", Password: "secret"},
+		RateLimitKeyPrefix: "billing:",
+	})
+	t.Cleanup(func() { _ = app.Destroy() })
+
+	app.RegisterEndpoint(&Endpoint{
+		Name:       "Limited",
+		Method:     MethodGET,
+		Path:       "/limited",
+		Public:     true,
+		RateLimits: []RateLimit{{Max: 1, Window: time.Minute, Key: "limited", Algorithm: RateLimitFixedWindow}},
+		Handler:    func(c *EndpointContext) error { return c.NoContent() },
+	}, app.Group("/api"))
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/limited", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, []string{"{billing:limited}:fw"}, server.Keys())
+}
+
+func TestCheckRateLimit_StoreFailure(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	server.Close()
+
+	for _, failOpen := range []bool{false, true} {
+		app := NewRestApp(RestAppOptions{LogLevel: LogLevelError, RedisClient: client, RateLimitFailOpen: failOpen})
+		app.RegisterEndpoint(&Endpoint{
+			Name:       "Limited",
+			Method:     MethodGET,
+			Path:       "/limited",
+			Public:     true,
+			RateLimits: []RateLimit{{Max: 1, Window: time.Minute}},
+			Handler:    func(c *EndpointContext) error { return c.NoContent() },
+		}, app.Group("/api"))
+
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/limited", nil))
+		require.NoError(t, err)
+		if failOpen {
+			assert.Equal(t, http.StatusNoContent, res.StatusCode)
+			continue
+		}
+
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		body, _ := io.ReadAll(res.Body)
+		assert.Contains(t, string(body), RATE_LIMIT_UNAVAILABLE)
+
+		require.NoError(t, app.Destroy())
+		assert.NotErrorIs(t, client.Ping(context.Background()).Err(), redis.ErrClosed, "injected clients are not closed by Destroy")
+	}
+}
@@ -0,0 +1,180 @@
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-errors/errors"
+)
+
+// endpointRegistry keeps the endpoints registered in the application and
+// whether they are enabled
+type endpointRegistry struct {
+	mu       sync.RWMutex
+	routes   []endpointRoute      // Registered endpoints, in registration order
+	byName   map[string]*Endpoint // Registered endpoints by name
+	disabled map[*Endpoint]bool   // Endpoints disabled at registration or with DisableEndpoint
+}
+
+// endpointRoute is an endpoint registered under a router group. The same
+// endpoint may be registered under several groups.
+type endpointRoute struct {
+	endpoint *Endpoint
+	path     string // Path including the router group prefix
+}
+
+// add registers ep under path. It fails when another endpoint has the name of
+// ep, or when the method and path of ep are already registered, regardless of
+// the names of the path parameters. Endpoints
+// without name cannot be looked up by name.
+func (r *endpointRegistry) add(ep *Endpoint, path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if other, ok := r.byName[ep.Name]; ok && ep.Name != "" && other != ep {
+		return errors.Errorf("an endpoint named %s is already registered", ep.Name)
+	}
+
+	for _, route := range r.routes {
+		if route.endpoint.Method == ep.Method && routePattern(route.path) == routePattern(path) {
+			if route.path != path {
+				return errors.Errorf("the route %s %s of endpoint %s is already registered by endpoint %s as %s",
+					strings.ToUpper(string(ep.Method)), path, ep.Name, route.endpoint.Name, route.path)
+			}
+			return errors.Errorf("the route %s %s of endpoint %s is already registered by endpoint %s",
+				strings.ToUpper(string(ep.Method)), path, ep.Name, route.endpoint.Name)
+		}
+	}
+
+	if r.byName == nil {
+		r.byName = make(map[string]*Endpoint)
+		r.disabled = make(map[*Endpoint]bool)
+	}
+
+	if _, ok := r.disabled[ep]; !ok {
+		r.disabled[ep] = ep.Disabled
+	}
+	if ep.Name != "" {
+		r.byName[ep.Name] = ep
+	}
+	r.routes = append(r.routes, endpointRoute{endpoint: ep, path: path})
+	return nil
+}
+
+// routePattern replaces the parameters of path with a placeholder, since the router matches /devices/:id and /devices/:deviceId
+// the same way
+func routePattern(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = ":"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// snapshot returns the registered routes, in registration order
+func (r *endpointRegistry) snapshot() []endpointRoute {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]endpointRoute(nil), r.routes...)
+}
+
+// enabled reports whether ep serves requests. Endpoints that are not
+// registered are enabled unless Endpoint.Disabled is set.
+func (r *endpointRegistry) enabled(ep *Endpoint) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	disabled, ok := r.disabled[ep]
+	if !ok {
+		return !ep.Disabled
+	}
+	return !disabled
+}
+
+// setEnabled enables or disables the endpoint named name
+func (r *endpointRegistry) setEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ep, ok := r.byName[name]
+	if !ok {
+		return errors.Errorf("the endpoint %s is not registered", name)
+	}
+	r.disabled[ep] = !enabled
+	return nil
+}
+
+// path returns the path the endpoint named name was first registered under
+func (r *endpointRegistry) path(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, route := range r.routes {
+		if route.endpoint.Name == name {
+			return route.path, true
+		}
+	}
+	return "", false
+}
+
+// EnableEndpoint makes the endpoint named name serve requests again
+func (receiver *RestApp) EnableEndpoint(name string) error {
+	return receiver.registry.setEnabled(name, true)
+}
+
+// DisableEndpoint makes the endpoint named name answer 404 until it is
+// enabled again, e.g. to switch off a feature at runtime
+func (receiver *RestApp) DisableEndpoint(name string) error {
+	return receiver.registry.setEnabled(name, false)
+}
+
+// IsEndpointEnabled reports whether the endpoint named name is registered and
+// serves requests
+func (receiver *RestApp) IsEndpointEnabled(name string) bool {
+	receiver.registry.mu.RLock()
+	ep, ok := receiver.registry.byName[name]
+	receiver.registry.mu.RUnlock()
+	return ok && receiver.registry.enabled(ep)
+}
+
+// URL builds the path of the endpoint named name, replacing its path
+// parameters with params, e.g. URL("GetDevice", map[string]any{"id": 42})
+// returns "/api/devices/42". Values are escaped. Endpoints registered under
+// several groups get the path of the first one.
+func (receiver *RestApp) URL(name string, params map[string]any) (string, error) {
+	path, ok := receiver.registry.path(name)
+	if !ok {
+		return "", errors.Errorf("the endpoint %s is not registered", name)
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		var param string
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			param = segment[1:]
+		case segment == "*":
+			param = "*"
+		default:
+			continue
+		}
+
+		value, ok := params[param]
+		if !ok {
+			return "", errors.Errorf("the parameter %s of endpoint %s is missing", param, name)
+		}
+
+		if param == "*" {
+			// Wildcards may span several segments
+			segments[i] = (&url.URL{Path: fmt.Sprint(value)}).EscapedPath()
+		} else {
+			segments[i] = url.PathEscape(fmt.Sprint(value))
+		}
+	}
+
+	return strings.Join(segments, "/"), nil
+}
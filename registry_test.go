@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterEndpoint(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+	api := app.Group("/api")
+
+	noContent := func(c *EndpointContext) error { return c.NoContent() }
+
+	err := app.RegisterEndpoint(&Endpoint{Name: "Trace", Method: "Trace", Path: "/trace", Handler: noContent}, api)
+	assert.ErrorContains(t, err, "unsupported HTTP method", "unknown methods fail instead of exiting")
+
+	devices := &Endpoint{Name: "GetDevice", Method: MethodGET, Path: "/devices/:id", Handler: noContent}
+	require.NoError(t, app.RegisterEndpoint(devices, api))
+	require.NoError(t, app.RegisterEndpoint(devices, app.Group("/v2")), "an endpoint may be registered under several groups")
+
+	err = app.RegisterEndpoint(&Endpoint{Name: "GetDevice", Method: MethodGET, Path: "/other", Handler: noContent}, api)
+	assert.ErrorContains(t, err, "an endpoint named GetDevice is already registered")
+
+	err = app.RegisterEndpoint(&Endpoint{Name: "FindDevice", Method: MethodGET, Path: "/devices/:id", Handler: noContent}, api)
+	assert.ErrorContains(t, err, "the route GET /api/devices/:id of endpoint FindDevice is already registered by endpoint GetDevice")
+
+	err = app.RegisterEndpoint(&Endpoint{Name: "GetDeviceByID", Method: MethodGET, Path: "/devices/:deviceId", Handler: noContent}, api)
+	assert.ErrorContains(t, err, "the route GET /api/devices/:deviceId of endpoint GetDeviceByID is already registered by endpoint GetDevice as /api/devices/:id",
+		"the router matches both paths the same way")
+	require.NoError(t, app.RegisterEndpoint(&Endpoint{Name: "DeviceFiles", Method: MethodGET, Path: "/devices/*", Handler: noContent}, api),
+		"wildcards do not conflict with parameters")
+
+	err = app.RegisterEndpoints([]*Endpoint{
+		{Name: "DeviceOptions", Method: MethodOPTIONS, Path: "/devices", Handler: func(c *EndpointContext) error {
+			c.EchoCtx.Response().Header().Set("Allow", "GET, OPTIONS")
+			return c.NoContent()
+		}},
+		{Name: "Tagged", Method: MethodGET, Path: "/tagged", Handler: noContent, Middlewares: []MiddlewareFunc{
+			func(next HandlerFunc) HandlerFunc {
+				return func(c Context) error {
+					c.Response().Header().Set("X-Endpoint-Middleware", "1")
+					return next(c)
+				}
+			},
+		}},
+	}, api)
+	require.NoError(t, err)
+
+	res, err := app.Test(httptest.NewRequest(http.MethodOptions, "/api/devices", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "GET, OPTIONS", res.Header.Get("Allow"))
+
+	// Preflight requests are still answered by the CORS middleware
+	req := httptest.NewRequest(http.MethodOptions, "/api/devices", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	res, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "*", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.NotEqual(t, "GET, OPTIONS", res.Header.Get("Allow"))
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/tagged", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "1", res.Header.Get("X-Endpoint-Middleware"))
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/v2/devices/d1", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Empty(t, res.Header.Get("X-Endpoint-Middleware"), "endpoint middlewares only run for their endpoint")
+}
+
+func TestEnableEndpoint(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+	api := app.Group("/api")
+
+	noContent := func(c *EndpointContext) error { return c.NoContent() }
+	require.NoError(t, app.RegisterEndpoints([]*Endpoint{
+		{Name: "Export", Method: MethodGET, Path: "/export", Handler: noContent},
+		{Name: "Beta", Method: MethodGET, Path: "/beta", Handler: noContent, Disabled: true},
+	}, api))
+
+	status := func(path string) int {
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusNoContent, status("/api/export"))
+	assert.Equal(t, http.StatusNotFound, status("/api/beta"))
+	assert.False(t, app.IsEndpointEnabled("Beta"))
+
+	require.NoError(t, app.DisableEndpoint("Export"))
+	require.NoError(t, app.EnableEndpoint("Beta"))
+	assert.Equal(t, http.StatusNotFound, status("/api/export"))
+	assert.Equal(t, http.StatusNoContent, status("/api/beta"))
+	assert.True(t, app.IsEndpointEnabled("Beta"))
+
+	assert.Error(t, app.EnableEndpoint("Missing"))
+	assert.False(t, app.IsEndpointEnabled("Missing"))
+}
+
+func TestURL(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	api := app.Group("/api")
+
+	noContent := func(c *EndpointContext) error { return c.NoContent() }
+	require.NoError(t, app.RegisterEndpoints([]*Endpoint{
+		{Name: "GetRecording", Method: MethodGET, Path: "/cameras/:cameraId/recordings/:id", Handler: noContent},
+		{Name: "GetFile", Method: MethodGET, Path: "/files/*", Handler: noContent},
+	}, api))
+
+	url, err := app.URL("GetRecording", map[string]any{"cameraId": 7, "id": "a b/c"})
+	require.NoError(t, err)
+	assert.Equal(t, "/api/cameras/7/recordings/a%20b%2Fc", url)
+
+	url, err = app.URL("GetFile", map[string]any{"*": "videos/2024/clip 1.mp4"})
+	require.NoError(t, err)
+	assert.Equal(t, "/api/files/videos/2024/clip%201.mp4", url)
+
+	_, err = app.URL("GetRecording", map[string]any{"cameraId": 7})
+	assert.ErrorContains(t, err, "the parameter id of endpoint GetRecording is missing")
+
+	_, err = app.URL("Missing", nil)
+	assert.Error(t, err)
+}
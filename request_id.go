@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRequestIDLength limits the incoming request IDs that are kept
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request ctx belongs to, or an
+// empty string. EndpointContext.Context() and the contexts derived from it
+// carry the ID, so repositories and other services can log it.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID id, e.g. to
+// correlate background work with the request that started it
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDMiddleware gives every request an ID, taken from the X-Request-ID
+// header when valid or generated otherwise. The ID is sent back in the
+// X-Request-ID response header and stored in the request context.
+func requestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !isValidRequestID(id) {
+				id = uuid.NewString()
+				req.Header.Set(echo.HeaderXRequestID, id)
+			}
+
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.SetRequest(req.WithContext(WithRequestID(req.Context(), id)))
+			return next(c)
+		}
+	}
+}
+
+// isValidRequestID accepts printable ASCII IDs without spaces, so clients
+// cannot inject line breaks or other content into the logs
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := range len(id) {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// contextLogHandler adds the request ID and the trace and span IDs of the
+// context to the log records, unless the logger already has them, like the one
+// of EndpointContext.Logger
+type contextLogHandler struct {
+	slog.Handler
+	hasRequestID bool
+	hasTraceID   bool
+}
+
+func (h contextLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" && !h.hasRequestID {
+		record.AddAttrs(slog.String("requestId", id))
+	}
+
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() && !h.hasTraceID {
+		record.AddAttrs(
+			slog.String("traceId", spanContext.TraceID().String()),
+			slog.String("spanId", spanContext.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextLogHandler{
+		Handler:      h.Handler.WithAttrs(attrs),
+		hasRequestID: h.hasRequestID || hasLogAttr(attrs, "requestId"),
+		hasTraceID:   h.hasTraceID || hasLogAttr(attrs, "traceId"),
+	}
+}
+
+func (h contextLogHandler) WithGroup(name string) slog.Handler {
+	return contextLogHandler{Handler: h.Handler.WithGroup(name), hasRequestID: h.hasRequestID, hasTraceID: h.hasTraceID}
+}
+
+// hasLogAttr reports whether attrs has an attribute named key
+func hasLogAttr(attrs []slog.Attr, key string) bool {
+	return slices.ContainsFunc(attrs, func(attr slog.Attr) bool { return attr.Key == key })
+}
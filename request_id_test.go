@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+)
+
+func TestRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError, LogFormat: LogFormatJSON, LogOutput: &logs})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+
+	var endpointID, contextID string
+	api := app.Group("/api")
+	app.RegisterEndpoint(&Endpoint{Name: "Echo", Method: MethodGET, Path: "/echo", Handler: func(c *EndpointContext) error {
+		endpointID = c.RequestID
+		contextID = RequestIDFromContext(c.Context())
+		c.Errorf("handled")
+		return c.NoContent()
+	}}, api)
+	app.RegisterEndpoint(&Endpoint{Name: "Fail", Method: MethodGET, Path: "/fail", Handler: func(c *EndpointContext) error {
+		return http_errors.NotFoundError("Report not found")
+	}}, api)
+
+	send := func(path string, id string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+		res, err := app.Test(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := send("/api/echo", "")
+	generated := res.Header.Get("X-Request-ID")
+	assert.NoError(t, uuid.Validate(generated), "a UUID is generated when the header is missing")
+	assert.Equal(t, generated, endpointID)
+	assert.Equal(t, generated, contextID, "the handler context carries the ID")
+
+	var record map[string]any
+	require.NoError(t, sonic.Unmarshal(logs.Bytes(), &record))
+	logs.Reset()
+	assert.Equal(t, "handled", record["msg"])
+	assert.Equal(t, generated, record["requestId"])
+
+	res = send("/api/echo", "client-id-1")
+	assert.Equal(t, "client-id-1", res.Header.Get("X-Request-ID"), "valid incoming IDs are kept")
+	assert.Equal(t, "client-id-1", endpointID)
+
+	res = send("/api/echo", "bad id\twith spaces")
+	assert.NotEqual(t, "bad id\twith spaces", res.Header.Get("X-Request-ID"))
+	assert.NoError(t, uuid.Validate(res.Header.Get("X-Request-ID")), "invalid incoming IDs are replaced")
+
+	res = send("/api/echo", strings.Repeat("a", maxRequestIDLength+1))
+	assert.NoError(t, uuid.Validate(res.Header.Get("X-Request-ID")), "long incoming IDs are replaced")
+
+	res = send("/api/fail", "client-id-2")
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+	var body http_errors.ErrorResponse
+	require.NoError(t, sonic.ConfigDefault.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, "client-id-2", body.RequestID, "error responses carry the ID")
+
+	res = send("/api/unknown", "client-id-3")
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Equal(t, "client-id-3", res.Header.Get("X-Request-ID"), "unmatched routes get an ID too")
+}
@@ -0,0 +1,227 @@
+// Package resttest provides helpers to test RestApp endpoints in-process,
+// without Redis or a real authentication service.
+package resttest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	rest "github.com/xompass/vsaas-rest"
+)
+
+// Harness wraps a RestApp whose authorizer and rate limit store are fakes
+// controlled by the test.
+type Harness struct {
+	App            *rest.RestApp
+	RateLimitStore *FakeRateLimitStore
+	t              testing.TB
+	mu             sync.RWMutex
+	principal      rest.Principal
+	token          rest.AuthToken
+	authErr        error
+}
+
+// New creates a harness around a new RestApp. The Authorizer and
+// RateLimitStore of options are replaced by the harness fakes.
+func New(t testing.TB, options ...rest.RestAppOptions) *Harness {
+	t.Helper()
+
+	var appOptions rest.RestAppOptions
+	if len(options) > 0 {
+		appOptions = options[0]
+	} else {
+		appOptions.LogLevel = rest.LogLevelError
+	}
+
+	h := &Harness{
+		RateLimitStore: NewFakeRateLimitStore(),
+		t:              t,
+	}
+
+	appOptions.Authorizer = h.authorize
+	appOptions.RateLimitStore = h.RateLimitStore
+	h.App = rest.NewRestApp(appOptions)
+
+	t.Cleanup(func() {
+		_ = h.App.Destroy()
+	})
+
+	return h
+}
+
+func (h *Harness) authorize(*rest.EndpointContext) (rest.Principal, rest.AuthToken, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.principal, h.token, h.authErr
+}
+
+// AuthenticateAs makes the following requests run as principal with token
+func (h *Harness) AuthenticateAs(principal rest.Principal, token rest.AuthToken) *Harness {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.principal, h.token, h.authErr = principal, token, nil
+	return h
+}
+
+// Anonymous makes the following requests run without a principal
+func (h *Harness) Anonymous() *Harness {
+	return h.AuthenticateAs(nil, nil)
+}
+
+// FailAuthorization makes the authorizer return err
+func (h *Harness) FailAuthorization(err error) *Harness {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.principal, h.token, h.authErr = nil, nil, err
+	return h
+}
+
+// Do runs req through the application and fails the test if it does not complete
+func (h *Harness) Do(req *http.Request) *http.Response {
+	h.t.Helper()
+
+	res, err := h.App.Test(req)
+	if err != nil {
+		h.t.Fatalf("resttest: %v", err)
+	}
+	return res
+}
+
+// Request builds and runs a request. A non-nil body is encoded as JSON unless
+// it is already an io.Reader.
+func (h *Harness) Request(method string, path string, body any, headers ...map[string]string) *http.Response {
+	h.t.Helper()
+
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+	default:
+		data, err := sonic.Marshal(b)
+		if err != nil {
+			h.t.Fatalf("resttest: encoding body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for _, hs := range headers {
+		for key, value := range hs {
+			req.Header.Set(key, value)
+		}
+	}
+
+	return h.Do(req)
+}
+
+// DecodeJSON reads the response body into target and closes it
+func DecodeJSON(t testing.TB, res *http.Response, target any) {
+	t.Helper()
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("resttest: reading body: %v", err)
+	}
+
+	if err := sonic.Unmarshal(data, target); err != nil {
+		t.Fatalf("resttest: decoding %q: %v", string(data), err)
+	}
+}
+
+// Principal is a static rest.Principal
+type Principal struct {
+	ID   string
+	Role string
+}
+
+func (p Principal) GetPrincipalID() string   { return p.ID }
+func (p Principal) GetPrincipalRole() string { return p.Role }
+
+// Token is a static rest.ScopedAuthToken. The zero value is an invalid token.
+type Token struct {
+	Valid     bool
+	UserID    string
+	UserType  string
+	Value     string
+	ExpiresAt int64
+	Scopes    []string
+}
+
+func (t Token) IsValid() bool       { return t.Valid }
+func (t Token) GetUserId() string   { return t.UserID }
+func (t Token) GetUserType() string { return t.UserType }
+func (t Token) GetToken() string    { return t.Value }
+func (t Token) GetExpiresAt() int64 { return t.ExpiresAt }
+
+func (t Token) HasScope(scope string) bool { return slices.Contains(t.Scopes, scope) }
+
+// FakeRateLimitStore is an in-memory rest.RateLimitStore that counts the
+// requests of each key and allows up to Max of them, whatever the algorithm of
+// the limit. Windows never expire unless Reset is called, which keeps tests
+// deterministic.
+type FakeRateLimitStore struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	err    error
+}
+
+func NewFakeRateLimitStore() *FakeRateLimitStore {
+	return &FakeRateLimitStore{counts: map[string]int64{}}
+}
+
+func (s *FakeRateLimitStore) Allow(ctx context.Context, key string, limit rest.RateLimit) (rest.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return rest.RateLimitResult{}, s.err
+	}
+
+	s.counts[key]++
+	count := s.counts[key]
+	result := rest.RateLimitResult{
+		Allowed:   count <= int64(limit.Max),
+		Limit:     limit.Max,
+		Remaining: int(max(int64(limit.Max)-count, 0)),
+		Reset:     limit.Window,
+	}
+	if !result.Allowed {
+		result.RetryAfter = limit.Window
+	}
+	return result, nil
+}
+
+// SetErr makes Allow fail with err. A nil err restores the store.
+func (s *FakeRateLimitStore) SetErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Count returns the number of requests recorded for key
+func (s *FakeRateLimitStore) Count(key string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[key]
+}
+
+// Reset clears all the counters
+func (s *FakeRateLimitStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts = map[string]int64{}
+}
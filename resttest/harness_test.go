@@ -0,0 +1,84 @@
+package resttest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rest "github.com/xompass/vsaas-rest"
+	"github.com/xompass/vsaas-rest/http_errors"
+)
+
+type role string
+
+func (r role) RoleName() string { return string(r) }
+
+func newHarness(t *testing.T) *Harness {
+	h := New(t)
+	api := h.App.Group("/api")
+
+	h.App.RegisterEndpoint(&rest.Endpoint{
+		Name:   "GetReport",
+		Method: rest.MethodGET,
+		Path:   "/reports",
+		Roles:  []rest.EndpointRole{role("admin")},
+		RateLimiter: func(*rest.EndpointContext) rest.RateLimit {
+			return rest.RateLimit{Max: 2, Window: time.Minute, Key: "reports"}
+		},
+		Handler: func(c *rest.EndpointContext) error {
+			return c.JSON(map[string]string{"user": c.Principal.GetPrincipalID()})
+		},
+	}, api)
+
+	return h
+}
+
+func TestHarness_Authorization(t *testing.T) {
+	h := newHarness(t)
+
+	res := h.Request(http.MethodGet, "/api/reports", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	h.AuthenticateAs(Principal{ID: "u1", Role: "viewer"}, Token{Valid: true})
+	res = h.Request(http.MethodGet, "/api/reports", nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	h.AuthenticateAs(Principal{ID: "u2", Role: "admin"}, Token{Valid: true})
+	res = h.Request(http.MethodGet, "/api/reports", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var body map[string]string
+	DecodeJSON(t, res, &body)
+	assert.Equal(t, "u2", body["user"])
+
+	h.FailAuthorization(http_errors.UnauthorizedError("token revoked"))
+	res = h.Request(http.MethodGet, "/api/reports", nil)
+	var errBody http_errors.ErrorResponse
+	DecodeJSON(t, res, &errBody)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, "token revoked", errBody.Message)
+}
+
+func TestHarness_RateLimit(t *testing.T) {
+	h := newHarness(t)
+	h.AuthenticateAs(Principal{ID: "u1", Role: "admin"}, Token{Valid: true})
+
+	for range 2 {
+		assert.Equal(t, http.StatusOK, h.Request(http.MethodGet, "/api/reports", nil).StatusCode)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, h.Request(http.MethodGet, "/api/reports", nil).StatusCode)
+	assert.Equal(t, int64(3), h.RateLimitStore.Count("reports"))
+
+	h.RateLimitStore.Reset()
+	assert.Equal(t, http.StatusOK, h.Request(http.MethodGet, "/api/reports", nil).StatusCode)
+
+	h.RateLimitStore.SetErr(errors.New("store unavailable"))
+	res := h.Request(http.MethodGet, "/api/reports", nil)
+	var errBody http_errors.ErrorResponse
+	DecodeJSON(t, res, &errBody)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, rest.RATE_LIMIT_UNAVAILABLE, errBody.ErrorCode)
+}
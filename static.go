@@ -212,6 +212,11 @@ func (receiver *RestApp) setupSPAFallback(config StaticConfig) {
 	originalHandler := receiver.EchoApp.HTTPErrorHandler
 
 	receiver.EchoApp.HTTPErrorHandler = func(err error, c echo.Context) {
+		// Errors already answered, e.g. by the audit stage of an endpoint
+		if c.Response().Committed {
+			return
+		}
+
 		// Only handle 404 errors for SPA fallback
 		if he, ok := err.(*echo.HTTPError); ok && he.Code == http.StatusNotFound {
 			requestPath := c.Request().URL.Path
@@ -0,0 +1,148 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	tracerName             = "github.com/xompass/vsaas-rest" // Instrumentation scope of the request spans
+	tracingShutdownTimeout = 10 * time.Second                // Max time Destroy waits for the spans to be exported
+)
+
+// TracingConfig configures the OpenTelemetry tracing of the application: a
+// server span per request named after the endpoint, child spans for its
+// stages and a span per repository operation
+type TracingConfig struct {
+	Enabled bool
+
+	// TracerProvider creates the spans. Defaults to a provider exporting to
+	// Exporter or, without Exporter, to otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
+	// Exporter receives the spans in batches when TracerProvider is not set,
+	// e.g. an OTLP exporter. The provider is shut down by Destroy.
+	Exporter sdktrace.SpanExporter
+	// ServiceName is the service.name of the spans sent to Exporter. Defaults
+	// to RestAppOptions.Name
+	ServiceName string
+	// Propagator reads the parent span from the request headers. Defaults to
+	// W3C Trace Context and Baggage
+	Propagator propagation.TextMapPropagator
+}
+
+// appTracing starts the spans of the requests
+type appTracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	provider   trace.TracerProvider
+	owned      *sdktrace.TracerProvider // Provider created for TracingConfig.Exporter, shut down by Destroy
+}
+
+func newAppTracing(config TracingConfig, appName string) *appTracing {
+	tracing := &appTracing{
+		provider:   config.TracerProvider,
+		propagator: config.Propagator,
+	}
+
+	if tracing.provider == nil && config.Exporter != nil {
+		serviceName := config.ServiceName
+		if serviceName == "" {
+			serviceName = appName
+		}
+
+		tracing.owned = sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(config.Exporter),
+			sdktrace.WithResource(sdkresource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+		)
+		tracing.provider = tracing.owned
+	}
+
+	if tracing.provider == nil {
+		tracing.provider = otel.GetTracerProvider()
+	}
+
+	if tracing.propagator == nil {
+		tracing.propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	}
+
+	tracing.tracer = tracing.provider.Tracer(tracerName)
+	return tracing
+}
+
+// startRequest starts the server span of a request of ep, child of the span
+// of the traceparent header if any. The returned function ends it with the
+// status of the response.
+func (t *appTracing) startRequest(c echo.Context, ep *Endpoint) (context.Context, func(status int)) {
+	req := c.Request()
+	ctx := t.propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	ctx, span := t.tracer.Start(ctx, ep.Name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.HTTPRoute(c.Path()),
+			semconv.URLPath(req.URL.Path),
+			semconv.ClientAddress(c.RealIP()),
+			semconv.UserAgentOriginal(req.UserAgent()),
+		),
+	)
+
+	return ctx, func(status int) {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		span.End()
+	}
+}
+
+// shutdown flushes and stops the provider created for TracingConfig.Exporter
+func (t *appTracing) shutdown(ctx context.Context) error {
+	if t == nil || t.owned == nil {
+		return nil
+	}
+	return t.owned.Shutdown(ctx)
+}
+
+// Tracer returns the tracer of the application, to add spans to the ones of
+// the requests. It does not record anything when tracing is disabled.
+func (receiver *RestApp) Tracer() trace.Tracer {
+	if receiver == nil || receiver.tracing == nil {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return receiver.tracing.tracer
+}
+
+// traceStage runs a stage of the request in a child span named name. The
+// context of eCtx is the one of the span while the stage runs, so the
+// repository spans of the handler are its children.
+func (eCtx *EndpointContext) traceStage(name string, stage func() error) error {
+	if eCtx.App == nil || eCtx.App.tracing == nil {
+		return stage()
+	}
+
+	parent := eCtx.context
+	ctx, span := eCtx.App.tracing.tracer.Start(parent, name)
+	eCtx.context = ctx
+	defer func() {
+		eCtx.context = parent
+		span.End()
+	}()
+
+	if err := stage(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
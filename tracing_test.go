@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/http_errors"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	var logs bytes.Buffer
+	app := NewRestApp(RestAppOptions{
+		LogLevel:  LogLevelInfo,
+		LogFormat: LogFormatJSON,
+		LogOutput: &logs,
+		Tracing:   &TracingConfig{Enabled: true, TracerProvider: provider},
+	})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+
+	var handlerSpan trace.SpanContext
+	api := app.Group("/api")
+	app.RegisterEndpoint(&Endpoint{Name: "GetDevice", Method: MethodGET, Path: "/devices/:id", Handler: func(c *EndpointContext) error {
+		handlerSpan = trace.SpanContextFromContext(c.Context())
+		c.Logger().Info("handled")
+		if c.EchoCtx.Param("id") == "missing" {
+			return http_errors.NotFoundError("Device not found")
+		}
+		return c.NoContent()
+	}}, api)
+
+	// Parent span of the client, in W3C Trace Context format
+	parentTraceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/devices/d1", nil)
+	req.Header.Set("traceparent", "00-"+parentTraceID+"-00f067aa0ba902b7-01")
+	res, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 5)
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+
+	server := byName["GetDevice"]
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, parentTraceID, server.SpanContext.TraceID().String(), "the trace of the traceparent header is continued")
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Contains(t, server.Attributes, semconv.HTTPRoute("/api/devices/:id"))
+
+	for _, stage := range []string{"parseBody", "authorize", "rateLimit", "handler"} {
+		require.Contains(t, byName, stage)
+		assert.Equal(t, server.SpanContext.SpanID(), byName[stage].Parent.SpanID(), stage)
+	}
+	assert.Equal(t, byName["handler"].SpanContext.SpanID(), handlerSpan.SpanID(), "the handler context is the one of its span")
+
+	records := logRecords(t, &logs)
+	require.NotEmpty(t, records)
+	assert.Equal(t, "handled", records[0]["msg"])
+	assert.Equal(t, parentTraceID, records[0]["traceId"])
+
+	exporter.Reset()
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/devices/missing", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	var body http_errors.ErrorResponse
+	require.NoError(t, sonic.ConfigDefault.NewDecoder(res.Body).Decode(&body))
+	spans = exporter.GetSpans()
+	require.NotEmpty(t, spans)
+	assert.Equal(t, spans[0].SpanContext.TraceID().String(), body.TraceID, "error responses carry the trace ID")
+}
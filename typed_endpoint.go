@@ -0,0 +1,285 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/xompass/vsaas-rest/database"
+	"github.com/xompass/vsaas-rest/http_errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Empty is the Body, Params or Resp of a typed endpoint without request body,
+// parameters or response body. Typed endpoints with an Empty response answer 204.
+type Empty struct{}
+
+// TypedHandler handles the requests of a typed endpoint. body and params are
+// parsed, sanitized and validated before it runs, and the returned response
+// is serialized.
+type TypedHandler[Body, Params, Resp any] func(ctx *EndpointContext, body Body, params Params) (Resp, error)
+
+// typedParamField is a field of a Params struct bound to a request parameter
+type typedParamField struct {
+	index []int
+	param Param
+}
+
+// paramResultTypes are the types of the values parsed for each parameter type
+var paramResultTypes = map[string]reflect.Type{
+	string(QueryParamTypeString):   reflect.TypeOf(""),
+	string(QueryParamTypeInt):      reflect.TypeOf(0),
+	string(QueryParamTypeFloat):    reflect.TypeOf(float64(0)),
+	string(QueryParamTypeBool):     reflect.TypeOf(false),
+	string(QueryParamTypeDate):     reflect.TypeOf(time.Time{}),
+	string(QueryParamTypeDateTime): reflect.TypeOf(time.Time{}),
+	string(QueryParamTypeObjectID): reflect.TypeOf(bson.ObjectID{}),
+	string(QueryParamTypeFilter):   reflect.TypeOf(&database.FilterBuilder{}),
+	string(QueryParamTypeWhere):    reflect.TypeOf(&database.WhereBuilder{}),
+}
+
+// NewTypedEndpoint builds an endpoint whose handler gets a concrete body and
+// parameters struct and returns the response, e.g.
+//
+//	type DeviceParams struct {
+//		ID     bson.ObjectID           `path:"id"`
+//		Filter *database.FilterBuilder `query:"filter"`
+//		Tenant string                  `header:"X-Tenant-Id,required"`
+//	}
+//
+//	rest.NewTypedEndpoint(rest.Endpoint{Name: "GetDevice", Method: rest.MethodGET, Path: "/devices/:id"},
+//		func(ctx *rest.EndpointContext, _ rest.Empty, params DeviceParams) (*Device, error) { ... })
+//
+// The fields of Params tagged with query, path or header are added to
+// Endpoint.Accepts. The tag holds the parameter name followed by the optional
+// "required" flag and parameter type, e.g. `query:"from,required,date"`. The
+// type defaults to the one of the field: string, int, float, bool, datetime
+// for time.Time, objectid for bson.ObjectID, filter for *database.FilterBuilder
+// and where for *database.WhereBuilder. Pointer fields are nil when the
+// parameter is absent.
+//
+// Body is bound like Endpoint.BodyParams. The response is sent as JSON with a
+// 200 status, 201 for ActionTypeCreate endpoints and 204 when Resp is Empty,
+// unless the handler already sent a response. Invalid Body or Params types are
+// reported by RestApp.RegisterEndpoint.
+func NewTypedEndpoint[Body, Params, Resp any](ep Endpoint, handler TypedHandler[Body, Params, Resp]) *Endpoint {
+	endpoint := &ep
+	endpoint.responseType = reflect.TypeFor[Resp]()
+
+	fields, err := typedParamFields(reflect.TypeFor[Params]())
+	if err == nil {
+		err = endpoint.setTypedBody(reflect.TypeFor[Body]())
+	}
+	if err == nil && endpoint.Handler != nil {
+		err = errors.New("the handler is set by NewTypedEndpoint")
+	}
+	if err != nil {
+		endpoint.typedErr = errors.Errorf("invalid typed endpoint %s: %v", ep.Name, err)
+		return endpoint
+	}
+
+	accepts := make([]Param, 0, len(endpoint.Accepts)+len(fields))
+	accepts = append(accepts, endpoint.Accepts...)
+	for _, field := range fields {
+		accepts = append(accepts, field.param)
+	}
+	endpoint.Accepts = accepts
+
+	endpoint.Handler = func(ctx *EndpointContext) error {
+		var body Body
+		if endpoint.BodyParams != nil {
+			parsed, ok := ctx.ParsedBody.(*Body)
+			if !ok {
+				return http_errors.InternalServerError("The request body was not parsed")
+			}
+			body = *parsed
+		}
+
+		var params Params
+		if err := bindTypedParams(ctx, reflect.ValueOf(&params).Elem(), fields); err != nil {
+			return err
+		}
+
+		response, err := handler(ctx, body, params)
+		if err != nil {
+			return err
+		}
+
+		if ctx.EchoCtx.Response().Committed {
+			return nil
+		}
+		if _, ok := any(response).(Empty); ok {
+			return ctx.NoContent()
+		}
+		return ctx.JSON(response, endpoint.typedStatus())
+	}
+
+	return endpoint
+}
+
+// setTypedBody binds the request body to bodyType, unless it is Empty
+func (ep *Endpoint) setTypedBody(bodyType reflect.Type) error {
+	if bodyType == reflect.TypeFor[Empty]() {
+		return nil
+	}
+
+	if bodyType.Kind() != reflect.Struct {
+		return errors.Errorf("the body type %s is not a struct", bodyType)
+	}
+
+	if ep.Method != MethodPOST && ep.Method != MethodPUT && ep.Method != MethodPATCH {
+		return errors.Errorf("%s requests have no body", strings.ToUpper(string(ep.Method)))
+	}
+
+	ep.BodyParams = func() any { return reflect.New(bodyType).Interface() }
+	return nil
+}
+
+// typedStatus returns the status of the successful responses of a typed endpoint
+func (ep *Endpoint) typedStatus() int {
+	if ep.responseType == reflect.TypeFor[Empty]() {
+		return http.StatusNoContent
+	}
+	if ep.ActionType == string(ActionTypeCreate) {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
+
+// typedParamFields returns the fields of paramsType bound to request parameters
+func typedParamFields(paramsType reflect.Type) ([]typedParamField, error) {
+	if paramsType.Kind() != reflect.Struct {
+		return nil, errors.Errorf("the params type %s is not a struct", paramsType)
+	}
+
+	var fields []typedParamField
+	for i := range paramsType.NumField() {
+		field := paramsType.Field(i)
+		for _, in := range []ParamLocation{InQuery, InPath, InHeader} {
+			tag, ok := field.Tag.Lookup(string(in))
+			if !ok {
+				continue
+			}
+
+			if !field.IsExported() {
+				return nil, errors.Errorf("the field %s is not exported", field.Name)
+			}
+
+			param, err := typedParam(in, tag, field)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, typedParamField{index: field.Index, param: param})
+		}
+	}
+	return fields, nil
+}
+
+// typedParam parses the tag of a Params field
+func typedParam(in ParamLocation, tag string, field reflect.StructField) (Param, error) {
+	options := strings.Split(tag, ",")
+	param := Param{in: in, name: options[0], required: in == InPath}
+	if param.name == "" {
+		param.name = field.Name
+	}
+	if in == InHeader {
+		param.name = http.CanonicalHeaderKey(param.name)
+	}
+
+	for _, option := range options[1:] {
+		switch {
+		case option == "required":
+			param.required = true
+		case paramResultTypes[option] != nil:
+			param.paramType = option
+		default:
+			return param, errors.Errorf("unknown option %q of field %s", option, field.Name)
+		}
+	}
+
+	fieldType := field.Type
+	if fieldType.Kind() == reflect.Ptr && fieldType != paramResultTypes[string(QueryParamTypeFilter)] &&
+		fieldType != paramResultTypes[string(QueryParamTypeWhere)] {
+		fieldType = fieldType.Elem()
+	}
+
+	if param.paramType == "" {
+		param.paramType = defaultParamType(fieldType)
+	}
+
+	resultType := paramResultTypes[param.paramType]
+	if resultType == nil || !resultType.ConvertibleTo(fieldType) ||
+		(fieldType.Kind() == reflect.String) != (resultType.Kind() == reflect.String) {
+		return param, errors.Errorf("the field %s of type %s cannot hold a %s parameter", field.Name, field.Type, param.paramType)
+	}
+
+	return param, nil
+}
+
+// defaultParamType returns the parameter type of the fields of type t
+func defaultParamType(t reflect.Type) string {
+	switch t {
+	case paramResultTypes[string(QueryParamTypeDateTime)]:
+		return string(QueryParamTypeDateTime)
+	case paramResultTypes[string(QueryParamTypeObjectID)]:
+		return string(QueryParamTypeObjectID)
+	case paramResultTypes[string(QueryParamTypeFilter)]:
+		return string(QueryParamTypeFilter)
+	case paramResultTypes[string(QueryParamTypeWhere)]:
+		return string(QueryParamTypeWhere)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return string(QueryParamTypeString)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return string(QueryParamTypeInt)
+	case reflect.Float32, reflect.Float64:
+		return string(QueryParamTypeFloat)
+	case reflect.Bool:
+		return string(QueryParamTypeBool)
+	}
+	return ""
+}
+
+// bindTypedParams sets the fields of params to the parsed request parameters
+func bindTypedParams(ctx *EndpointContext, params reflect.Value, fields []typedParamField) error {
+	var paramErrors ParamErrors
+	for _, field := range fields {
+		var parsed map[string]any
+		switch field.param.in {
+		case InQuery:
+			parsed = ctx.ParsedQuery
+		case InPath:
+			parsed = ctx.ParsedPath
+		case InHeader:
+			parsed = ctx.ParsedHeader
+		}
+
+		value, ok := parsed[field.param.name]
+		if !ok || value == nil {
+			continue
+		}
+
+		target := params.FieldByIndex(field.index)
+		if target.Kind() == reflect.Ptr && target.Type() != reflect.TypeOf(value) {
+			target.Set(reflect.New(target.Type().Elem()))
+			target = target.Elem()
+		}
+
+		v := reflect.ValueOf(value)
+		if v.CanInt() && target.CanInt() && target.OverflowInt(v.Int()) ||
+			v.CanFloat() && target.CanFloat() && target.OverflowFloat(v.Float()) {
+			paramErrors = append(paramErrors, http_errors.BadRequestError("Invalid parameter", "Parameter "+field.param.name+" is out of range"))
+			continue
+		}
+		target.Set(v.Convert(target.Type()))
+	}
+
+	if len(paramErrors) > 0 {
+		return paramErrors
+	}
+	return nil
+}
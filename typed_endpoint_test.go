@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xompass/vsaas-rest/database"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type typedDeviceParams struct {
+	ID      bson.ObjectID           `path:"id"`
+	Limit   int32                   `query:"limit"`
+	Ratio   *float64                `query:"ratio"`
+	Since   time.Time               `query:"since,date"`
+	Verbose bool                    `query:"verbose"`
+	Filter  *database.FilterBuilder `query:"filter"`
+	Tenant  string                  `header:"x-tenant-id,required"`
+	ignored string
+}
+
+type typedDeviceBody struct {
+	Name string `json:"name" normalize:"trim" validate:"required"`
+}
+
+type typedDevice struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Tenant string `json:"tenant"`
+}
+
+func TestNewTypedEndpoint(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	app.authorizer = authorizerFor(testPrincipal{id: "u1"}, testToken{valid: true})
+	api := app.Group("/api")
+
+	var got typedDeviceParams
+	getDevice := NewTypedEndpoint(Endpoint{Name: "GetDevice", Method: MethodGET, Path: "/devices/:id"},
+		func(ctx *EndpointContext, _ Empty, params typedDeviceParams) (*typedDevice, error) {
+			got = params
+			return &typedDevice{ID: params.ID.Hex(), Tenant: params.Tenant}, nil
+		})
+
+	createDevice := NewTypedEndpoint(Endpoint{Name: "CreateDevice", Method: MethodPOST, Path: "/devices", ActionType: string(ActionTypeCreate)},
+		func(ctx *EndpointContext, body typedDeviceBody, params struct {
+			Tenant string `header:"X-Tenant-Id"`
+		}) (typedDevice, error) {
+			return typedDevice{Name: body.Name, Tenant: params.Tenant}, nil
+		})
+
+	deleteDevice := NewTypedEndpoint(Endpoint{Name: "DeleteDevice", Method: MethodDELETE, Path: "/devices/:id"},
+		func(ctx *EndpointContext, _ Empty, _ Empty) (Empty, error) { return Empty{}, nil })
+
+	require.NoError(t, app.RegisterEndpoints([]*Endpoint{getDevice, createDevice, deleteDevice}, api))
+
+	id := bson.NewObjectID()
+	req := httptest.NewRequest(http.MethodGet, "/api/devices/"+id.Hex()+`?limit=20&ratio=0.5&since=2024-03-01&verbose&filter={"limit":5}`, nil)
+	req.Header.Set("X-Tenant-Id", "acme")
+	res, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var device typedDevice
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&device))
+	assert.Equal(t, typedDevice{ID: id.Hex(), Tenant: "acme"}, device)
+	assert.Equal(t, id, got.ID)
+	assert.Equal(t, int32(20), got.Limit)
+	require.NotNil(t, got.Ratio)
+	assert.Equal(t, 0.5, *got.Ratio)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), got.Since)
+	assert.True(t, got.Verbose)
+	require.NotNil(t, got.Filter)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/devices/"+id.Hex(), nil)
+	req.Header.Set("X-Tenant-Id", "acme")
+	_, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Nil(t, got.Ratio, "absent pointer parameters are nil")
+	assert.Zero(t, got.Limit)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/devices/"+id.Hex()+"?limit=3000000000", nil)
+	req.Header.Set("X-Tenant-Id", "acme")
+	res, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "values overflowing the field are rejected")
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/devices/"+id.Hex(), nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "required headers are enforced")
+
+	req = httptest.NewRequest(http.MethodPost, "/api/devices", strings.NewReader(`{"name":"  Lobby  "}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant-Id", "acme")
+	res, err = app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&device))
+	assert.Equal(t, typedDevice{Name: "Lobby", Tenant: "acme"}, device)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/devices", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "the body is validated")
+
+	res, err = app.Test(httptest.NewRequest(http.MethodDelete, "/api/devices/"+id.Hex(), nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	doc := app.OpenAPI(OpenAPIConfig{Title: "test"})
+	get := doc.Paths["/api/devices/{id}"]["get"]
+	require.NotNil(t, get)
+	assert.Len(t, get.Parameters, 7)
+	assert.NotNil(t, get.Responses["200"].Content[string(ContentTypeJSON)].Schema)
+	assert.Contains(t, doc.Paths["/api/devices"]["post"].Responses, "201")
+	assert.Contains(t, doc.Paths["/api/devices/{id}"]["delete"].Responses, "204")
+}
+
+func TestNewTypedEndpoint_InvalidTypes(t *testing.T) {
+	app := NewRestApp(RestAppOptions{LogLevel: LogLevelError})
+	api := app.Group("/api")
+
+	err := app.RegisterEndpoint(NewTypedEndpoint(Endpoint{Name: "BadParam", Method: MethodGET, Path: "/bad"},
+		func(ctx *EndpointContext, _ Empty, params struct {
+			Limit string `query:"limit,int"`
+		}) (Empty, error) {
+			return Empty{}, nil
+		}), api)
+	assert.ErrorContains(t, err, "invalid typed endpoint BadParam: the field Limit of type string cannot hold a int parameter")
+
+	err = app.RegisterEndpoint(NewTypedEndpoint(Endpoint{Name: "BodyOnGet", Method: MethodGET, Path: "/body"},
+		func(ctx *EndpointContext, body typedDeviceBody, _ Empty) (Empty, error) {
+			return Empty{}, nil
+		}), api)
+	assert.ErrorContains(t, err, "GET requests have no body")
+}